@@ -17,6 +17,7 @@ const jsFiles = [
     'static/js/card-renderer.js',
     'static/js/drag-drop.js',
     'static/js/groups.js',
+    'static/js/events.js',
     'static/js/app.js'
 ];
 
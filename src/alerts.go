@@ -0,0 +1,617 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Alert rule metrics
+const (
+	alertMetricTemperature = "temperature"
+	alertMetricHumidity    = "humidity"
+	alertMetricBattery     = "battery"
+	alertMetricStale       = "stale"
+)
+
+// Alert states and notification statuses
+const (
+	alertPending  = "pending"
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+const (
+	// alertQueueSize bounds the notifications waiting to be delivered
+	alertQueueSize = 64
+
+	// alertWebhookTimeout bounds a single webhook request
+	alertWebhookTimeout = 10 * time.Second
+)
+
+var (
+	alertFiringGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "govee_alert_firing",
+			Help: "Alerts per rule and device: 1 while firing, 0 while pending",
+		},
+		[]string{"rule", "name"},
+	)
+
+	alertNotificationsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "govee_alert_notifications_total",
+			Help: "Alert notifications sent per webhook and result (success, failure)",
+		},
+		[]string{"webhook", "result"},
+	)
+)
+
+// alertRule is a validated AlertRule
+type alertRule struct {
+	name       string
+	metric     string
+	above      *float64
+	below      *float64
+	hysteresis float64
+	forDur     time.Duration
+	repeat     time.Duration
+	devices    map[string]bool
+	groups     map[string]bool
+	webhooks   []string
+}
+
+// alertWebhook is a validated AlertWebhook with its parsed body template
+type alertWebhook struct {
+	name    string
+	url     string
+	method  string
+	headers map[string]string
+	body    *template.Template
+}
+
+// alertSample is what the engine knows about one device at evaluation time
+type alertSample struct {
+	govee   KnownGovee
+	reading *lastLoggedValues // nil if the device has never been seen
+	stale   bool
+	age     time.Duration // time since the last reading
+}
+
+// alertState tracks one pending or firing alert
+type alertState struct {
+	Rule         string     `json:"rule"`
+	Device       string     `json:"device"`
+	DisplayName  string     `json:"displayName"`
+	Group        string     `json:"group"`
+	Metric       string     `json:"metric"`
+	State        string     `json:"state"`
+	Value        float64    `json:"value"`
+	Threshold    *float64   `json:"threshold,omitempty"`
+	Since        time.Time  `json:"since"`
+	FiringSince  *time.Time `json:"firingSince,omitempty"`
+	LastNotified *time.Time `json:"lastNotified,omitempty"`
+}
+
+// alertNotification is the data passed to webhook body templates
+type alertNotification struct {
+	Status      string     `json:"status"`
+	Rule        string     `json:"rule"`
+	Device      string     `json:"device"`
+	DisplayName string     `json:"displayName"`
+	Group       string     `json:"group"`
+	Metric      string     `json:"metric"`
+	Value       float64    `json:"value"`
+	Threshold   *float64   `json:"threshold,omitempty"`
+	StartsAt    time.Time  `json:"startsAt"`
+	EndsAt      *time.Time `json:"endsAt,omitempty"`
+	Message     string     `json:"message"`
+}
+
+// alertDelivery is one queued webhook request
+type alertDelivery struct {
+	webhook      *alertWebhook
+	notification alertNotification
+}
+
+// alertEngine evaluates rules against device samples and tracks alert state
+type alertEngine struct {
+	mu       sync.Mutex
+	rules    []*alertRule
+	webhooks map[string]*alertWebhook
+	states   map[string]*alertState // keyed by rule and device MAC
+}
+
+var (
+	alerts          = &alertEngine{webhooks: map[string]*alertWebhook{}, states: map[string]*alertState{}}
+	alertDeliveries = make(chan alertDelivery, alertQueueSize)
+)
+
+// defaultAlertBody is used for webhooks without a body template
+var defaultAlertBody = template.Must(template.New("default").Funcs(alertTemplateFuncs).Parse("{{ json . }}"))
+
+var alertTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// optionalDuration parses a duration that defaults to zero when empty
+func optionalDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("negative duration %s", s)
+	}
+	return d, err
+}
+
+// stringSet converts a list of names into a lookup set, or nil if empty
+func stringSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// compileAlertRule validates a configured rule
+func compileAlertRule(rule AlertRule) (*alertRule, error) {
+	if rule.Name == "" {
+		return nil, fmt.Errorf("rule has no name")
+	}
+	compiled := &alertRule{
+		name:       rule.Name,
+		metric:     strings.ToLower(rule.Metric),
+		above:      rule.Above,
+		below:      rule.Below,
+		hysteresis: rule.Hysteresis,
+		devices:    stringSet(rule.Devices),
+		groups:     stringSet(rule.Groups),
+		webhooks:   rule.Webhooks,
+	}
+
+	switch compiled.metric {
+	case alertMetricTemperature, alertMetricHumidity, alertMetricBattery:
+		if (rule.Above == nil) == (rule.Below == nil) {
+			return nil, fmt.Errorf("rule '%s' needs exactly one of above or below", rule.Name)
+		}
+	case alertMetricStale:
+	default:
+		return nil, fmt.Errorf("rule '%s' has unknown metric '%s'", rule.Name, rule.Metric)
+	}
+	if rule.Hysteresis < 0 {
+		return nil, fmt.Errorf("rule '%s' has negative hysteresis", rule.Name)
+	}
+
+	var err error
+	if compiled.forDur, err = optionalDuration(rule.For); err != nil {
+		return nil, fmt.Errorf("rule '%s': invalid for: %v", rule.Name, err)
+	}
+	if compiled.repeat, err = optionalDuration(rule.Repeat); err != nil {
+		return nil, fmt.Errorf("rule '%s': invalid repeat: %v", rule.Name, err)
+	}
+	return compiled, nil
+}
+
+// compileAlertWebhook validates a configured webhook and parses its body template
+func compileAlertWebhook(webhook AlertWebhook) (*alertWebhook, error) {
+	if webhook.Name == "" || webhook.URL == "" {
+		return nil, fmt.Errorf("webhook needs a name and url")
+	}
+	compiled := &alertWebhook{
+		name:    webhook.Name,
+		url:     webhook.URL,
+		method:  strings.ToUpper(webhook.Method),
+		headers: webhook.Headers,
+		body:    defaultAlertBody,
+	}
+	if compiled.method == "" {
+		compiled.method = http.MethodPost
+	}
+	if webhook.Body != "" {
+		body, err := template.New(webhook.Name).Funcs(alertTemplateFuncs).Parse(webhook.Body)
+		if err != nil {
+			return nil, fmt.Errorf("webhook '%s': invalid body template: %v", webhook.Name, err)
+		}
+		compiled.body = body
+	}
+	return compiled, nil
+}
+
+// applyAlertsConfig replaces the alert rules and webhooks; state of rules that
+// still exist is kept so a reload does not re-notify firing alerts
+func applyAlertsConfig(config *Config) {
+	rules := make([]*alertRule, 0, len(config.Alerts.Rules))
+	ruleNames := make(map[string]bool)
+	for _, rule := range config.Alerts.Rules {
+		compiled, err := compileAlertRule(rule)
+		if err != nil {
+			log.Printf("Alerts: Skipping rule: %v", err)
+			continue
+		}
+		if ruleNames[compiled.name] {
+			log.Printf("Alerts: Skipping duplicate rule '%s'", compiled.name)
+			continue
+		}
+		ruleNames[compiled.name] = true
+		rules = append(rules, compiled)
+	}
+
+	webhooks := make(map[string]*alertWebhook)
+	for _, webhook := range config.Alerts.Webhooks {
+		compiled, err := compileAlertWebhook(webhook)
+		if err != nil {
+			log.Printf("Alerts: Skipping webhook: %v", err)
+			continue
+		}
+		webhooks[compiled.name] = compiled
+	}
+
+	alerts.mu.Lock()
+	alerts.rules = rules
+	alerts.webhooks = webhooks
+	for key, state := range alerts.states {
+		if !ruleNames[state.Rule] {
+			alertFiringGauge.DeleteLabelValues(state.Rule, state.Device)
+			delete(alerts.states, key)
+		}
+	}
+	alerts.mu.Unlock()
+
+	if len(rules) > 0 {
+		log.Printf("Alerts: Loaded %d rules and %d webhooks", len(rules), len(webhooks))
+	}
+}
+
+// appliesTo reports whether a rule covers a device
+func (r *alertRule) appliesTo(govee KnownGovee) bool {
+	if r.metric == alertMetricBattery && govee.Virtual != nil {
+		return false // Virtual devices have no battery
+	}
+	if r.devices == nil && r.groups == nil {
+		return true
+	}
+	if r.devices[govee.Name] {
+		return true
+	}
+	// A rule for a group also covers the groups nested in it
+	for _, group := range groupAncestors(govee.Group) {
+		if r.groups[group] {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the current value, whether the alert condition holds and
+// whether the value has recovered past the hysteresis band. ok is false when
+// the sample carries nothing to evaluate for this rule.
+func (r *alertRule) check(sample alertSample) (value float64, active, recovered, ok bool) {
+	if r.metric == alertMetricStale {
+		if sample.reading == nil {
+			return 0, false, true, false
+		}
+		return sample.age.Seconds(), sample.stale, !sample.stale, true
+	}
+
+	// A stale device has no current value; its alerts stay as they are
+	if sample.reading == nil || sample.stale {
+		return 0, false, false, false
+	}
+	switch r.metric {
+	case alertMetricTemperature:
+		value = sample.reading.Temperature
+	case alertMetricHumidity:
+		value = sample.reading.Humidity
+	case alertMetricBattery:
+		value = float64(sample.reading.Battery)
+	}
+	if r.above != nil {
+		return value, value > *r.above, value <= *r.above-r.hysteresis, true
+	}
+	return value, value < *r.below, value >= *r.below+r.hysteresis, true
+}
+
+// threshold returns the configured bound of a value rule
+func (r *alertRule) threshold() *float64 {
+	if r.above != nil {
+		return r.above
+	}
+	return r.below
+}
+
+func alertKey(rule, device string) string {
+	return rule + "\x00" + device
+}
+
+// evaluate runs every rule against the samples. When complete is set the
+// samples cover all configured devices, and alerts of other devices are dropped.
+func (e *alertEngine) evaluate(samples []alertSample, complete bool, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, sample := range samples {
+		for _, rule := range e.rules {
+			if !rule.appliesTo(sample.govee) {
+				continue
+			}
+			key := alertKey(rule.name, sample.govee.MAC)
+			seen[key] = true
+			e.evaluateRuleLocked(rule, key, sample, now)
+		}
+	}
+
+	if complete {
+		for key, state := range e.states {
+			if !seen[key] {
+				alertFiringGauge.DeleteLabelValues(state.Rule, state.Device)
+				delete(e.states, key)
+			}
+		}
+	}
+}
+
+// evaluateRuleLocked advances the state of one rule for one device.
+// Caller must hold e.mu.
+func (e *alertEngine) evaluateRuleLocked(rule *alertRule, key string, sample alertSample, now time.Time) {
+	value, active, recovered, ok := rule.check(sample)
+	if !ok {
+		return
+	}
+
+	state := e.states[key]
+	switch {
+	case state == nil:
+		if !active {
+			return
+		}
+		state = &alertState{
+			Rule:        rule.name,
+			Device:      sample.govee.Name,
+			DisplayName: sample.govee.DisplayName,
+			Group:       sample.govee.Group,
+			Metric:      rule.metric,
+			State:       alertPending,
+			Value:       value,
+			Threshold:   rule.threshold(),
+			Since:       now,
+		}
+		e.states[key] = state
+		alertFiringGauge.WithLabelValues(rule.name, state.Device).Set(0)
+		if rule.forDur == 0 {
+			e.fireLocked(rule, state, now)
+		}
+
+	case state.State == alertPending:
+		state.Value = value
+		if !active {
+			alertFiringGauge.DeleteLabelValues(rule.name, state.Device)
+			delete(e.states, key)
+		} else if now.Sub(state.Since) >= rule.forDur {
+			e.fireLocked(rule, state, now)
+		}
+
+	default: // firing
+		state.Value = value
+		if recovered {
+			e.notifyLocked(rule, state, alertResolved, now)
+			alertFiringGauge.DeleteLabelValues(rule.name, state.Device)
+			delete(e.states, key)
+		} else if rule.repeat > 0 && now.Sub(*state.LastNotified) >= rule.repeat {
+			e.notifyLocked(rule, state, alertFiring, now)
+		}
+	}
+}
+
+// fireLocked moves a pending alert to firing and notifies. Caller must hold e.mu.
+func (e *alertEngine) fireLocked(rule *alertRule, state *alertState, now time.Time) {
+	firingSince := now
+	state.State = alertFiring
+	state.FiringSince = &firingSince
+	alertFiringGauge.WithLabelValues(rule.name, state.Device).Set(1)
+	log.Printf("Alerts: '%s' firing for '%s' (%s %.2f)", rule.name, state.Device, rule.metric, state.Value)
+	e.notifyLocked(rule, state, alertFiring, now)
+}
+
+// notifyLocked queues a notification to the rule's webhooks. Caller must hold e.mu.
+func (e *alertEngine) notifyLocked(rule *alertRule, state *alertState, status string, now time.Time) {
+	notifiedAt := now
+	state.LastNotified = &notifiedAt
+	if status == alertResolved {
+		log.Printf("Alerts: '%s' resolved for '%s' (%s %.2f)", rule.name, state.Device, rule.metric, state.Value)
+	}
+
+	notification := alertNotification{
+		Status:      status,
+		Rule:        rule.name,
+		Device:      state.Device,
+		DisplayName: state.DisplayName,
+		Group:       state.Group,
+		Metric:      rule.metric,
+		Value:       state.Value,
+		Threshold:   state.Threshold,
+		StartsAt:    *state.FiringSince,
+		Message:     alertMessage(rule, state, status),
+	}
+	if status == alertResolved {
+		notification.EndsAt = &notifiedAt
+	}
+
+	names := rule.webhooks
+	if len(names) == 0 {
+		for name := range e.webhooks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		webhook, ok := e.webhooks[name]
+		if !ok {
+			log.Printf("Alerts: Rule '%s' refers to unknown webhook '%s'", rule.name, name)
+			continue
+		}
+		select {
+		case alertDeliveries <- alertDelivery{webhook: webhook, notification: notification}:
+		default:
+			log.Printf("Alerts: Notification queue full, dropping '%s' notification for '%s'", rule.name, state.Device)
+		}
+	}
+}
+
+// alertMessage is a one-line human readable summary of a notification
+func alertMessage(rule *alertRule, state *alertState, status string) string {
+	name := state.DisplayName
+	if name == "" {
+		name = state.Device
+	}
+	if status == alertResolved {
+		return fmt.Sprintf("[RESOLVED] %s: %s", rule.name, name)
+	}
+	switch {
+	case rule.metric == alertMetricStale:
+		return fmt.Sprintf("[FIRING] %s: %s has not reported for %s", rule.name, name, time.Duration(state.Value*float64(time.Second)).Round(time.Second))
+	case rule.above != nil:
+		return fmt.Sprintf("[FIRING] %s: %s %s %.2f is above %.2f", rule.name, name, rule.metric, state.Value, *rule.above)
+	default:
+		return fmt.Sprintf("[FIRING] %s: %s %s %.2f is below %.2f", rule.name, name, rule.metric, state.Value, *rule.below)
+	}
+}
+
+// renameDevices moves the alerts of renamed devices, keyed by MAC, to their new
+// names, so they carry on without being notified again. Every old series is
+// deleted before any new one is set, so devices can swap names.
+func (e *alertEngine) renameDevices(renamed map[string]KnownGovee) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	moved := make(map[*alertState]KnownGovee)
+	for mac, govee := range renamed {
+		for _, rule := range e.rules {
+			if state, ok := e.states[alertKey(rule.name, mac)]; ok {
+				alertFiringGauge.DeleteLabelValues(state.Rule, state.Device)
+				moved[state] = govee
+			}
+		}
+	}
+	for state, govee := range moved {
+		state.Device, state.DisplayName, state.Group = govee.Name, govee.DisplayName, govee.Group
+		firing := 0.0
+		if state.State == alertFiring {
+			firing = 1
+		}
+		alertFiringGauge.WithLabelValues(state.Rule, state.Device).Set(firing)
+	}
+}
+
+// snapshot returns the pending and firing alerts sorted by rule and device
+func (e *alertEngine) snapshot() []alertState {
+	e.mu.Lock()
+	list := make([]alertState, 0, len(e.states))
+	for _, state := range e.states {
+		list = append(list, *state)
+	}
+	e.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Rule != list[j].Rule {
+			return list[i].Rule < list[j].Rule
+		}
+		return list[i].Device < list[j].Device
+	})
+	return list
+}
+
+// evaluateReadingAlerts evaluates the rules for a newly accepted reading
+func evaluateReadingAlerts(govee KnownGovee, reading lastLoggedValues, now time.Time) {
+	alerts.evaluate([]alertSample{{govee: govee, reading: &reading}}, false, now)
+}
+
+// evaluateAllAlertsLocked evaluates the rules for every configured device.
+// Caller must hold mutex.
+func evaluateAllAlertsLocked(now time.Time) {
+	samples := make([]alertSample, 0, len(knownGovees))
+	for _, govee := range knownGovees {
+		sample := alertSample{govee: govee}
+		if values, ok := deviceLastLoggedVals[govee.MAC]; ok {
+			sample.reading = &values
+		}
+		if lastSeen, ok := lastUpdateTime[govee.MAC]; ok {
+			sample.age = now.Sub(lastSeen)
+			sample.stale = deviceStatuses[govee.MAC] == "stale"
+		}
+		samples = append(samples, sample)
+	}
+	alerts.evaluate(samples, true, now)
+}
+
+// runAlertNotifier delivers queued notifications until ctx is canceled
+func runAlertNotifier(ctx context.Context) {
+	client := &http.Client{Timeout: alertWebhookTimeout}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case delivery := <-alertDeliveries:
+			result := "success"
+			if err := deliverAlert(ctx, client, delivery); err != nil {
+				result = "failure"
+				log.Printf("Alerts: Webhook '%s' failed: %v", delivery.webhook.name, err)
+			}
+			alertNotificationsCounter.WithLabelValues(delivery.webhook.name, result).Inc()
+		}
+	}
+}
+
+// deliverAlert renders the webhook body and sends it
+func deliverAlert(ctx context.Context, client *http.Client, delivery alertDelivery) error {
+	var body bytes.Buffer
+	if err := delivery.webhook.body.Execute(&body, delivery.notification); err != nil {
+		return fmt.Errorf("rendering body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, delivery.webhook.method, delivery.webhook.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range delivery.webhook.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// handleAlerts serves the pending and firing alerts at /api/alerts
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, alerts.snapshot())
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+// drainAlertDeliveries returns the notifications queued so far
+func drainAlertDeliveries() []alertNotification {
+	var notifications []alertNotification
+	for {
+		select {
+		case delivery := <-alertDeliveries:
+			notifications = append(notifications, delivery.notification)
+		default:
+			return notifications
+		}
+	}
+}
+
+// newTestAlertEngine returns an engine with a single webhook and the given rules
+func newTestAlertEngine(t *testing.T, rules ...AlertRule) *alertEngine {
+	t.Helper()
+	drainAlertDeliveries()
+	t.Cleanup(func() { drainAlertDeliveries() })
+
+	engine := &alertEngine{
+		webhooks: map[string]*alertWebhook{"test": {name: "test", url: "http://127.0.0.1", method: http.MethodPost, body: defaultAlertBody}},
+		states:   map[string]*alertState{},
+	}
+	for _, rule := range rules {
+		compiled, err := compileAlertRule(rule)
+		if err != nil {
+			t.Fatalf("compile rule: %v", err)
+		}
+		engine.rules = append(engine.rules, compiled)
+		t.Cleanup(func() { alertFiringGauge.DeleteLabelValues(rule.Name, "Freezer") })
+	}
+	return engine
+}
+
+func freezerSample(temperature float64) alertSample {
+	return alertSample{
+		govee:   KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Freezer", Group: "Kitchen"},
+		reading: &lastLoggedValues{Temperature: temperature, Humidity: 40, Battery: 80},
+	}
+}
+
+func TestCompileAlertRule(t *testing.T) {
+	tests := []struct {
+		name string
+		rule AlertRule
+		ok   bool
+	}{
+		{"above", AlertRule{Name: "a", Metric: "temperature", Above: floatPtr(-10)}, true},
+		{"below", AlertRule{Name: "a", Metric: "Battery", Below: floatPtr(10)}, true},
+		{"stale", AlertRule{Name: "a", Metric: "stale", For: "10m"}, true},
+		{"no name", AlertRule{Metric: "temperature", Above: floatPtr(1)}, false},
+		{"no bound", AlertRule{Name: "a", Metric: "humidity"}, false},
+		{"both bounds", AlertRule{Name: "a", Metric: "humidity", Above: floatPtr(70), Below: floatPtr(30)}, false},
+		{"unknown metric", AlertRule{Name: "a", Metric: "pressure", Above: floatPtr(1)}, false},
+		{"bad for", AlertRule{Name: "a", Metric: "stale", For: "soon"}, false},
+		{"negative hysteresis", AlertRule{Name: "a", Metric: "temperature", Above: floatPtr(1), Hysteresis: -1}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileAlertRule(tt.rule); (err == nil) != tt.ok {
+				t.Errorf("compileAlertRule(%+v) error = %v, want ok=%v", tt.rule, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAlertHysteresisAndRepeat(t *testing.T) {
+	engine := newTestAlertEngine(t, AlertRule{
+		Name: "Freezer warm", Metric: "temperature", Above: floatPtr(-10), Hysteresis: 2, Repeat: "1h",
+	})
+	start := time.Now()
+
+	engine.evaluate([]alertSample{freezerSample(-8)}, false, start)
+	notifications := drainAlertDeliveries()
+	if len(notifications) != 1 || notifications[0].Status != alertFiring || notifications[0].Value != -8 {
+		t.Fatalf("expected one firing notification, got %+v", notifications)
+	}
+	if got := testutil.ToFloat64(alertFiringGauge.WithLabelValues("Freezer warm", "Freezer")); got != 1 {
+		t.Errorf("firing gauge = %v, want 1", got)
+	}
+
+	// Back below the threshold but inside the hysteresis band: still firing, no repeat yet
+	engine.evaluate([]alertSample{freezerSample(-11)}, false, start.Add(time.Minute))
+	if n := drainAlertDeliveries(); len(n) != 0 {
+		t.Errorf("unexpected notifications inside hysteresis band: %+v", n)
+	}
+
+	// Repeat interval elapsed
+	engine.evaluate([]alertSample{freezerSample(-11)}, false, start.Add(61*time.Minute))
+	if n := drainAlertDeliveries(); len(n) != 1 || n[0].Status != alertFiring {
+		t.Errorf("expected a repeated firing notification, got %+v", n)
+	}
+
+	// Recovered past the hysteresis band
+	engine.evaluate([]alertSample{freezerSample(-12)}, false, start.Add(62*time.Minute))
+	notifications = drainAlertDeliveries()
+	if len(notifications) != 1 || notifications[0].Status != alertResolved || notifications[0].EndsAt == nil {
+		t.Fatalf("expected a resolved notification, got %+v", notifications)
+	}
+	if len(engine.snapshot()) != 0 {
+		t.Errorf("resolved alert still tracked: %+v", engine.snapshot())
+	}
+}
+
+func TestAlertMinimumDuration(t *testing.T) {
+	engine := newTestAlertEngine(t, AlertRule{Name: "Freezer warm", Metric: "temperature", Above: floatPtr(-10), For: "5m"})
+	start := time.Now()
+
+	engine.evaluate([]alertSample{freezerSample(-8)}, false, start)
+	if states := engine.snapshot(); len(states) != 1 || states[0].State != alertPending {
+		t.Fatalf("expected a pending alert, got %+v", states)
+	}
+
+	// A dip below the threshold before the duration elapses cancels it
+	engine.evaluate([]alertSample{freezerSample(-15)}, false, start.Add(time.Minute))
+	if states := engine.snapshot(); len(states) != 0 {
+		t.Fatalf("pending alert not cancelled: %+v", states)
+	}
+
+	engine.evaluate([]alertSample{freezerSample(-8)}, false, start.Add(2*time.Minute))
+	engine.evaluate([]alertSample{freezerSample(-8)}, false, start.Add(6*time.Minute))
+	if n := drainAlertDeliveries(); len(n) != 0 {
+		t.Fatalf("fired before the minimum duration: %+v", n)
+	}
+	engine.evaluate([]alertSample{freezerSample(-8)}, false, start.Add(7*time.Minute))
+	if states := engine.snapshot(); len(states) != 1 || states[0].State != alertFiring {
+		t.Errorf("expected a firing alert, got %+v", states)
+	}
+	if n := drainAlertDeliveries(); len(n) != 1 {
+		t.Errorf("expected one notification, got %+v", n)
+	}
+}
+
+func TestStaleAlert(t *testing.T) {
+	engine := newTestAlertEngine(t, AlertRule{Name: "Offline", Metric: "stale", Groups: []string{"Kitchen"}})
+	now := time.Now()
+
+	stale := freezerSample(-18)
+	stale.stale = true
+	stale.age = 10 * time.Minute
+	other := alertSample{govee: KnownGovee{MAC: "AA:BB:CC:DD:EE:02", Name: "Attic"}, reading: stale.reading, stale: true}
+
+	engine.evaluate([]alertSample{stale, other}, true, now)
+	states := engine.snapshot()
+	if len(states) != 1 || states[0].Device != "Freezer" || states[0].State != alertFiring {
+		t.Fatalf("expected only the kitchen sensor to fire, got %+v", states)
+	}
+
+	// The next reading resolves it
+	engine.evaluate([]alertSample{freezerSample(-18)}, false, now.Add(time.Minute))
+	notifications := drainAlertDeliveries()
+	if len(notifications) != 2 || notifications[1].Status != alertResolved {
+		t.Errorf("expected firing then resolved, got %+v", notifications)
+	}
+}
+
+func TestAlertSurvivesRename(t *testing.T) {
+	engine := newTestAlertEngine(t, AlertRule{Name: "Freezer warm", Metric: "temperature", Above: floatPtr(-10)})
+	t.Cleanup(func() { alertFiringGauge.DeleteLabelValues("Freezer warm", "Chest Freezer") })
+	start := time.Now()
+
+	engine.evaluate([]alertSample{freezerSample(-8)}, false, start)
+	drainAlertDeliveries()
+
+	// The alert moves on reload, before the silent device sends another reading
+	renamed := freezerSample(-7)
+	renamed.govee.Name = "Chest Freezer"
+	engine.renameDevices(map[string]KnownGovee{renamed.govee.MAC: renamed.govee})
+	states := engine.snapshot()
+	if len(states) != 1 || states[0].Device != "Chest Freezer" || !states[0].FiringSince.Equal(start) {
+		t.Fatalf("alert after rename = %+v, want the one firing since the start", states)
+	}
+	if alertFiringGauge.DeleteLabelValues("Freezer warm", "Freezer") {
+		t.Error("firing gauge still has the old name")
+	}
+	if got := testutil.ToFloat64(alertFiringGauge.WithLabelValues("Freezer warm", "Chest Freezer")); got != 1 {
+		t.Errorf("firing gauge = %v, want 1", got)
+	}
+
+	engine.evaluate([]alertSample{renamed}, true, start.Add(time.Minute))
+	if n := drainAlertDeliveries(); len(n) != 0 {
+		t.Errorf("rename re-sent the alert: %+v", n)
+	}
+}
+
+func TestDeliverAlertTemplate(t *testing.T) {
+	var gotBody, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		gotAuth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	webhook, err := compileAlertWebhook(AlertWebhook{
+		Name:    "chat",
+		URL:     server.URL,
+		Headers: map[string]string{"authorization": "Bearer secret"},
+		Body:    `{"text": {{ json .Message }}, "status": "{{ .Status }}"}`,
+	})
+	if err != nil {
+		t.Fatalf("compile webhook: %v", err)
+	}
+
+	notification := alertNotification{Status: alertFiring, Message: `Freezer "warm"`}
+	if err := deliverAlert(context.Background(), server.Client(), alertDelivery{webhook: webhook, notification: notification}); err != nil {
+		t.Fatalf("deliverAlert: %v", err)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(gotBody), &payload); err != nil || payload["text"] != `Freezer "warm"` || payload["status"] != "firing" {
+		t.Errorf("body = %s (%v)", gotBody, err)
+	}
+	if gotAuth != "Bearer secret" {
+		t.Errorf("Authorization = %q", gotAuth)
+	}
+
+	if _, err := compileAlertWebhook(AlertWebhook{Name: "bad", URL: server.URL, Body: "{{ .Nope"}); err == nil {
+		t.Error("invalid template accepted")
+	}
+}
+
+func TestAlertRulesFromConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	yaml := `alerts:
+  rules:
+    - name: Freezer warm
+      metric: temperature
+      above: -10
+      devices: [Freezer]
+  webhooks:
+    - name: ops
+      url: http://example.invalid/hook
+`
+	if err := os.WriteFile("config.yaml", []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := initConfig()
+	if err != nil {
+		t.Fatalf("initConfig: %v", err)
+	}
+	if len(config.Alerts.Rules) != 1 || config.Alerts.Rules[0].Above == nil || *config.Alerts.Rules[0].Above != -10 ||
+		config.Alerts.Rules[0].Below != nil {
+		t.Errorf("rules = %+v", config.Alerts.Rules)
+	}
+	if len(config.Alerts.Webhooks) != 1 || config.Alerts.Webhooks[0].Name != "ops" {
+		t.Errorf("webhooks = %+v", config.Alerts.Webhooks)
+	}
+}
+
+func TestHandleAlerts(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleAlerts(rec, httptest.NewRequest(http.MethodGet, "/api/alerts", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("GET: status = %d, content type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	handleAlerts(rec, httptest.NewRequest(http.MethodPost, "/api/alerts", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status = %d, want 405", rec.Code)
+	}
+}
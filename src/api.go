@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ungroupedName is the group reported for devices without one, matching the dashboard
+const ungroupedName = "Ungrouped"
+
+// apiOffsets is the calibration of a device as served by the API
+type apiOffsets struct {
+	Temperature float64 `json:"temperature"`
+	Humidity    float64 `json:"humidity"`
+}
+
+// apiReading is the latest calibrated reading of a device
+type apiReading struct {
+	Temperature float64 `json:"temperature"`
+	Humidity    float64 `json:"humidity"`
+	Battery     *int    `json:"battery,omitempty"` // Unset for virtual devices
+}
+
+// thresholdEvaluation classifies a reading against the configured thresholds as
+// "low", "high" or "ok" (battery is only ever "low" or "ok")
+type thresholdEvaluation struct {
+	Temperature string `json:"temperature"`
+	Humidity    string `json:"humidity"`
+	Battery     string `json:"battery,omitempty"`
+}
+
+// apiDevice is the JSON representation of a configured device
+type apiDevice struct {
+	MAC         string               `json:"mac"`
+	Name        string               `json:"name"`
+	DisplayName string               `json:"displayName"`
+	Group       string               `json:"group"`
+	Model       string               `json:"model,omitempty"`
+	Offsets     apiOffsets           `json:"offsets"`
+	Virtual     string               `json:"virtual,omitempty"` // The expressions of a virtual device
+	Status      string               `json:"status"`
+	Reading     *apiReading          `json:"reading,omitempty"`
+	Limits      Thresholds           `json:"limits"`
+	Thresholds  *thresholdEvaluation `json:"thresholds,omitempty"`
+	FirstSeen   *time.Time           `json:"firstSeen,omitempty"`
+	LastSeen    *time.Time           `json:"lastSeen,omitempty"`
+}
+
+// apiGroup summarizes the devices of one group, including those of the groups
+// nested in it. The aggregates only cover active devices and are omitted when
+// there are none.
+type apiGroup struct {
+	Name          string         `json:"name"`
+	Devices       []string       `json:"devices"`
+	Statuses      map[string]int `json:"statuses"`
+	ActiveDevices int            `json:"activeDevices"`
+	Temperature   *groupStats    `json:"temperature,omitempty"`
+	Humidity      *groupStats    `json:"humidity,omitempty"`
+	Battery       *groupStats    `json:"battery,omitempty"`
+}
+
+// classify returns "low", "high" or "ok" for value against the given band
+func classify(value, low, high float64) string {
+	switch {
+	case value < low:
+		return "low"
+	case value > high:
+		return "high"
+	default:
+		return "ok"
+	}
+}
+
+// evaluateThresholds classifies a reading against the device's resolved thresholds
+func evaluateThresholds(t Thresholds, reading apiReading) *thresholdEvaluation {
+	evaluation := &thresholdEvaluation{
+		Temperature: classify(reading.Temperature, t.TemperatureLow, t.TemperatureHigh),
+		Humidity:    classify(reading.Humidity, t.HumidityLow, t.HumidityHigh),
+	}
+	if reading.Battery != nil {
+		evaluation.Battery = "ok"
+		if float64(*reading.Battery) <= t.BatteryLow {
+			evaluation.Battery = "low"
+		}
+	}
+	return evaluation
+}
+
+// apiDeviceStatusLocked returns the tracked status of a device, or computes it
+// when no status check has run yet. Caller must hold mutex.
+func apiDeviceStatusLocked(govee KnownGovee, staleThreshold time.Duration, now time.Time) string {
+	if status, ok := deviceStatuses[govee.MAC]; ok {
+		return status
+	}
+	if govee.StaleThreshold > 0 {
+		staleThreshold = govee.StaleThreshold
+	}
+	return deviceStatusLocked(govee.MAC, staleThreshold, now)
+}
+
+// snapshotDevices builds the API view of every configured device, sorted by name
+func snapshotDevices() []apiDevice {
+	staleThreshold := parseDuration(liveConfig().Metrics.StaleThreshold)
+	now := time.Now()
+
+	mutex.Lock()
+	devices := make([]apiDevice, 0, len(knownGovees))
+	for mac, govee := range knownGovees {
+		device := apiDevice{
+			MAC:         mac,
+			Name:        govee.Name,
+			DisplayName: govee.DisplayName,
+			Group:       govee.Group,
+			Model:       govee.Model,
+			Offsets:     apiOffsets{Temperature: govee.TempOffset, Humidity: govee.HumidityOffset},
+			Status:      apiDeviceStatusLocked(govee, staleThreshold, now),
+			Limits:      govee.Thresholds,
+		}
+		if govee.Virtual != nil {
+			device.MAC, device.Virtual = "", govee.Virtual.describe()
+		}
+		if values, ok := deviceLastLoggedVals[mac]; ok {
+			device.Reading = &apiReading{
+				Temperature: values.Temperature,
+				Humidity:    values.Humidity,
+			}
+			if govee.Virtual == nil {
+				device.Reading.Battery = &values.Battery
+			}
+			device.Thresholds = evaluateThresholds(govee.Thresholds, *device.Reading)
+		}
+		if firstSeen, ok := deviceFirstSeen[mac]; ok {
+			device.FirstSeen = &firstSeen
+		}
+		if lastSeen, ok := lastUpdateTime[mac]; ok {
+			device.LastSeen = &lastSeen
+		}
+		devices = append(devices, device)
+	}
+	mutex.Unlock()
+
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices
+}
+
+// snapshotGroups groups the configured devices, sorted by group name. A device
+// in a nested group such as "House/Upstairs" also counts towards "House".
+func snapshotGroups() []apiGroup {
+	byName := make(map[string]*apiGroup)
+	for _, device := range snapshotDevices() {
+		names := groupAncestors(device.Group)
+		if len(names) == 0 {
+			names = []string{ungroupedName}
+		}
+		for _, name := range names {
+			group, ok := byName[name]
+			if !ok {
+				group = &apiGroup{Name: name, Devices: []string{}, Statuses: make(map[string]int)}
+				for _, status := range statusLabels {
+					group.Statuses[status] = 0
+				}
+				byName[name] = group
+			}
+			group.add(device)
+		}
+	}
+
+	groups := make([]apiGroup, 0, len(byName))
+	for _, group := range byName {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups
+}
+
+// handleDevices serves /api/devices
+func handleDevices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, snapshotDevices())
+	case http.MethodPost:
+		createDevice(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDevice serves /api/devices/{name}
+func handleDevice(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPatch:
+		updateDevice(w, r)
+		return
+	case http.MethodDelete:
+		deleteDevice(w, r)
+		return
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.PathValue("name")
+	for _, device := range snapshotDevices() {
+		if device.Name == name {
+			writeJSON(w, http.StatusOK, device)
+			return
+		}
+	}
+	http.Error(w, "Unknown device "+name, http.StatusNotFound)
+}
+
+// handleGroups serves /api/groups
+func handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshotGroups())
+}
+
+// writeJSON encodes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
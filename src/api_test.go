@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withCurrentConfig installs config as the live config for the duration of a test.
+func withCurrentConfig(t *testing.T, config *Config) {
+	t.Helper()
+	currentConfigMu.Lock()
+	orig := currentConfig
+	currentConfig = config
+	currentConfigMu.Unlock()
+	t.Cleanup(func() {
+		currentConfigMu.Lock()
+		currentConfig = orig
+		currentConfigMu.Unlock()
+	})
+}
+
+func apiTestConfig() *Config {
+	config := &Config{}
+	config.Metrics.StaleThreshold = "5m"
+	config.Thresholds.Temperature.Low = 0
+	config.Thresholds.Temperature.High = 35
+	config.Thresholds.Humidity.Low = 30
+	config.Thresholds.Humidity.High = 70
+	config.Thresholds.Battery.Low = 5
+	return config
+}
+
+func TestSnapshotDevices(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	config := apiTestConfig()
+	withCurrentConfig(t, config)
+	thresholds := globalThresholds(config)
+
+	now := time.Now()
+	mutex.Lock()
+	knownGovees["AA:BB:CC:DD:EE:01"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Office", DisplayName: "Office Desk", Group: "Upstairs", TempOffset: -0.5, Thresholds: thresholds}
+	knownGovees["AA:BB:CC:DD:EE:02"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:02", Name: "Attic", DisplayName: "Attic", Group: "Upstairs", Thresholds: thresholds}
+	knownGovees["AA:BB:CC:DD:EE:03"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:03", Name: "Cellar", DisplayName: "Cellar", Thresholds: thresholds}
+	deviceFirstSeen["AA:BB:CC:DD:EE:01"] = now.Add(-time.Hour)
+	lastUpdateTime["AA:BB:CC:DD:EE:01"] = now.Add(-time.Minute)
+	deviceLastLoggedVals["AA:BB:CC:DD:EE:01"] = lastLoggedValues{Temperature: 36.5, Humidity: 50, Battery: 4}
+	deviceFirstSeen["AA:BB:CC:DD:EE:02"] = now.Add(-time.Hour)
+	lastUpdateTime["AA:BB:CC:DD:EE:02"] = now.Add(-10 * time.Minute)
+	deviceLastLoggedVals["AA:BB:CC:DD:EE:02"] = lastLoggedValues{Temperature: 20, Humidity: 20, Battery: 80}
+	mutex.Unlock()
+
+	devices := snapshotDevices()
+	if len(devices) != 3 {
+		t.Fatalf("got %d devices, want 3", len(devices))
+	}
+	if devices[0].Name != "Attic" || devices[1].Name != "Cellar" || devices[2].Name != "Office" {
+		t.Fatalf("devices not sorted by name: %+v", devices)
+	}
+
+	attic, cellar, office := devices[0], devices[1], devices[2]
+	if attic.Status != "stale" || cellar.Status != "never_seen" || office.Status != "active" {
+		t.Errorf("statuses = %s/%s/%s, want stale/never_seen/active", attic.Status, cellar.Status, office.Status)
+	}
+	if cellar.Reading != nil || cellar.Thresholds != nil || cellar.LastSeen != nil {
+		t.Errorf("never seen device should have no reading: %+v", cellar)
+	}
+	if office.MAC != "AA:BB:CC:DD:EE:01" || office.DisplayName != "Office Desk" || office.Offsets.Temperature != -0.5 {
+		t.Errorf("office config fields = %+v", office)
+	}
+	want := thresholdEvaluation{Temperature: "high", Humidity: "ok", Battery: "low"}
+	if office.Thresholds == nil || *office.Thresholds != want {
+		t.Errorf("office thresholds = %+v, want %+v", office.Thresholds, want)
+	}
+	if attic.Thresholds == nil || attic.Thresholds.Humidity != "low" {
+		t.Errorf("attic thresholds = %+v, want humidity low", attic.Thresholds)
+	}
+}
+
+func TestDeviceAndGroupHandlers(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	withCurrentConfig(t, apiTestConfig())
+
+	mutex.Lock()
+	knownGovees["AA:BB:CC:DD:EE:01"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Office", Group: "Upstairs"}
+	knownGovees["AA:BB:CC:DD:EE:02"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:02", Name: "Attic", Group: "Upstairs"}
+	knownGovees["AA:BB:CC:DD:EE:03"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:03", Name: "Cellar"}
+	lastUpdateTime["AA:BB:CC:DD:EE:01"] = time.Now()
+	mutex.Unlock()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/devices", handleDevices)
+	mux.HandleFunc("/api/devices/{name}", handleDevice)
+	mux.HandleFunc("/api/groups", handleGroups)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/devices/Office")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/devices/Office: status = %d", rec.Code)
+	}
+	var device apiDevice
+	if err := json.Unmarshal(rec.Body.Bytes(), &device); err != nil || device.Name != "Office" || device.Status != "active" {
+		t.Errorf("unexpected device response %s (%v)", rec.Body.String(), err)
+	}
+
+	if rec := get("/api/devices/Garage"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown device: status = %d, want 404", rec.Code)
+	}
+
+	rec = get("/api/groups")
+	var groups []apiGroup
+	if err := json.Unmarshal(rec.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("decode groups: %v", err)
+	}
+	if len(groups) != 2 || groups[0].Name != ungroupedName || groups[1].Name != "Upstairs" {
+		t.Fatalf("unexpected groups: %s", rec.Body.String())
+	}
+	if len(groups[1].Devices) != 2 || groups[1].Statuses["active"] != 1 || groups[1].Statuses["never_seen"] != 1 {
+		t.Errorf("Upstairs group = %+v", groups[1])
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/groups", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE /api/groups: status = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// calibration maps a raw sensor value to a calibrated one, either as
+// gain * raw + offset or by interpolating between reference points
+type calibration struct {
+	gain   float64
+	offset float64
+	points []CalibrationPoint // sorted by Raw; overrides gain and offset when set
+}
+
+// compileCalibration validates a calibration block; it returns nil when the
+// block is empty so uncalibrated devices only use their offsets
+func compileCalibration(c Calibration) (*calibration, error) {
+	if c.Gain == nil && c.Offset == 0 && len(c.Points) == 0 {
+		return nil, nil
+	}
+
+	if len(c.Points) > 0 {
+		if c.Gain != nil || c.Offset != 0 {
+			return nil, fmt.Errorf("points cannot be combined with gain or offset")
+		}
+		points := append([]CalibrationPoint(nil), c.Points...)
+		sort.Slice(points, func(i, j int) bool { return points[i].Raw < points[j].Raw })
+		for i := 1; i < len(points); i++ {
+			if points[i].Raw == points[i-1].Raw {
+				return nil, fmt.Errorf("duplicate reference point for raw value %g", points[i].Raw)
+			}
+		}
+		return &calibration{points: points}, nil
+	}
+
+	gain := 1.0
+	if c.Gain != nil {
+		gain = *c.Gain
+	}
+	if gain <= 0 || math.IsNaN(gain) || math.IsInf(gain, 0) {
+		return nil, fmt.Errorf("gain must be a positive number, got %g", gain)
+	}
+	return &calibration{gain: gain, offset: c.Offset}, nil
+}
+
+// apply calibrates a raw value; a nil calibration returns it unchanged
+func (c *calibration) apply(raw float64) float64 {
+	if c == nil {
+		return raw
+	}
+	if len(c.points) == 0 {
+		return c.gain*raw + c.offset
+	}
+	if len(c.points) == 1 {
+		return raw + c.points[0].Actual - c.points[0].Raw
+	}
+
+	// Interpolate within the enclosing segment, or extrapolate from the outermost one
+	i := sort.Search(len(c.points), func(i int) bool { return c.points[i].Raw >= raw })
+	switch {
+	case i == 0:
+		i = 1
+	case i == len(c.points):
+		i = len(c.points) - 1
+	}
+	lo, hi := c.points[i-1], c.points[i]
+	return lo.Actual + (raw-lo.Raw)*(hi.Actual-lo.Actual)/(hi.Raw-lo.Raw)
+}
+
+// describe summarizes the calibration for the device log
+func (c *calibration) describe() string {
+	switch {
+	case c == nil:
+		return "none"
+	case len(c.points) > 0:
+		return fmt.Sprintf("%d points", len(c.points))
+	default:
+		return fmt.Sprintf("x%.3f%+.2f", c.gain, c.offset)
+	}
+}
+
+// calibrateReading applies a device's calibration and offsets to a raw reading
+// and clamps humidity to the physically possible range
+func calibrateReading(govee KnownGovee, temperature, humidity float64) (float64, float64) {
+	temperature = govee.TempCalibration.apply(temperature) + govee.TempOffset
+	humidity = govee.HumidityCalibration.apply(humidity) + govee.HumidityOffset
+	return temperature, math.Max(0, math.Min(100, humidity))
+}
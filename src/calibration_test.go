@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCompileCalibration(t *testing.T) {
+	gain := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		config  Calibration
+		wantNil bool
+		wantErr bool
+	}{
+		{"empty", Calibration{}, true, false},
+		{"offset only", Calibration{Offset: 0.5}, false, false},
+		{"gain and offset", Calibration{Gain: gain(1.02), Offset: -0.3}, false, false},
+		{"zero gain", Calibration{Gain: gain(0)}, true, true},
+		{"negative gain", Calibration{Gain: gain(-1)}, true, true},
+		{"points", Calibration{Points: []CalibrationPoint{{Raw: 20, Actual: 20}, {Raw: -18, Actual: -19.5}}}, false, false},
+		{"duplicate points", Calibration{Points: []CalibrationPoint{{Raw: 20, Actual: 20}, {Raw: 20, Actual: 21}}}, true, true},
+		{"points with gain", Calibration{Gain: gain(1), Points: []CalibrationPoint{{Raw: 20, Actual: 20}}}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := compileCalibration(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (c == nil) != tt.wantNil {
+				t.Errorf("calibration = %+v, wantNil %v", c, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestCalibrationApply(t *testing.T) {
+	gain := 1.1
+	linear, _ := compileCalibration(Calibration{Gain: &gain, Offset: -1})
+	single, _ := compileCalibration(Calibration{Points: []CalibrationPoint{{Raw: 20, Actual: 20.5}}})
+	// Correct at 20°C but reads 1.5°C warm in the freezer; points are deliberately unsorted
+	points, _ := compileCalibration(Calibration{Points: []CalibrationPoint{
+		{Raw: 20, Actual: 20},
+		{Raw: -18, Actual: -19.5},
+		{Raw: 40, Actual: 41},
+	}})
+
+	tests := []struct {
+		name string
+		c    *calibration
+		raw  float64
+		want float64
+	}{
+		{"nil is identity", nil, 21.3, 21.3},
+		{"gain and offset", linear, 20, 21},
+		{"single point shifts", single, 5, 5.5},
+		{"at reference point", points, 20, 20},
+		{"interpolated low segment", points, 1, 0.25},
+		{"interpolated high segment", points, 30, 30.5},
+		{"extrapolated below", points, -20, -21.578947},
+		{"extrapolated above", points, 50, 51.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.apply(tt.raw); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("apply(%v) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalibrateReadingClampsHumidity(t *testing.T) {
+	gain := 1.2
+	humidity, _ := compileCalibration(Calibration{Gain: &gain})
+	govee := KnownGovee{HumidityCalibration: humidity, HumidityOffset: -2}
+
+	if _, h := calibrateReading(govee, 20, 90); h != 100 {
+		t.Errorf("humidity = %v, want 100", h)
+	}
+	if _, h := calibrateReading(govee, 20, 1); h != 0 {
+		t.Errorf("humidity = %v, want 0", h)
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Calibration session states
+const (
+	calibrationRunning   = "running"
+	calibrationFinished  = "finished"
+	calibrationCancelled = "cancelled"
+)
+
+const (
+	defaultCalibrationDuration = 30 * time.Minute
+	minCalibrationDuration     = time.Minute
+
+	// calibrationMinSamples is the number of readings a device needs before an
+	// offset is suggested for it
+	calibrationMinSamples = 3
+)
+
+// calibrationRequest starts a session on POST /api/calibration
+type calibrationRequest struct {
+	Devices           []string `json:"devices"`
+	Reference         string   `json:"reference,omitempty"`         // Device trusted as correct
+	ReferenceHumidity *float64 `json:"referenceHumidity,omitempty"` // Known humidity, e.g. 75 for a salt test
+	Duration          string   `json:"duration,omitempty"`
+}
+
+// calibrationApplyRequest optionally limits which devices POST /api/calibration/apply updates
+type calibrationApplyRequest struct {
+	Devices []string `json:"devices,omitempty"`
+}
+
+// runningStats accumulates the mean and spread of a series of values
+type runningStats struct {
+	n     int
+	sum   float64
+	sumSq float64
+}
+
+func (s *runningStats) add(v float64) {
+	s.n++
+	s.sum += v
+	s.sumSq += v * v
+}
+
+func (s runningStats) mean() float64 {
+	return s.sum / float64(s.n)
+}
+
+// stddev is the population standard deviation
+func (s runningStats) stddev() float64 {
+	m := s.mean()
+	return math.Sqrt(math.Max(0, s.sumSq/float64(s.n)-m*m))
+}
+
+// calibrationSamples holds the readings of one device with its offsets removed
+type calibrationSamples struct {
+	temperature runningStats
+	humidity    runningStats
+}
+
+// calibrationMetricResult compares one metric of a device against the reference
+type calibrationMetricResult struct {
+	Mean            float64 `json:"mean"`   // With the current offset applied
+	Spread          float64 `json:"spread"` // Standard deviation of the readings
+	Bias            float64 `json:"bias"`   // Mean minus reference
+	CurrentOffset   float64 `json:"currentOffset"`
+	SuggestedOffset float64 `json:"suggestedOffset"`
+}
+
+// calibrationResult is the outcome of a session for one device
+type calibrationResult struct {
+	Name        string                   `json:"name"`
+	Samples     int                      `json:"samples"`
+	Temperature *calibrationMetricResult `json:"temperature,omitempty"`
+	Humidity    *calibrationMetricResult `json:"humidity,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+}
+
+// calibrationReferenceValues are the values the devices are compared against
+type calibrationReferenceValues struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	Humidity    *float64 `json:"humidity,omitempty"`
+}
+
+// calibrationStatus is the JSON representation of a session
+type calibrationStatus struct {
+	State             string                     `json:"state"`
+	Devices           []string                   `json:"devices"`
+	Reference         string                     `json:"reference,omitempty"`
+	ReferenceHumidity *float64                   `json:"referenceHumidity,omitempty"`
+	ReferenceValues   calibrationReferenceValues `json:"referenceValues"`
+	StartedAt         time.Time                  `json:"startedAt"`
+	EndsAt            time.Time                  `json:"endsAt"`
+	FinishedAt        *time.Time                 `json:"finishedAt,omitempty"`
+	AppliedAt         *time.Time                 `json:"appliedAt,omitempty"`
+	Results           []calibrationResult        `json:"results"`
+}
+
+// calibrationSession collects readings of co-located sensors
+type calibrationSession struct {
+	devices           []string
+	reference         string
+	referenceHumidity *float64
+	startedAt         time.Time
+	endsAt            time.Time
+	state             string
+	finishedAt        *time.Time
+	appliedAt         *time.Time
+	samples           map[string]*calibrationSamples
+	timer             *time.Timer
+}
+
+var (
+	calibrationMu     = &sync.Mutex{}
+	activeCalibration *calibrationSession // The running or most recent session
+)
+
+// newCalibrationSession validates a request against the configured devices
+func newCalibrationSession(req calibrationRequest, configured map[string]bool, now time.Time) (*calibrationSession, error) {
+	duration := defaultCalibrationDuration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %q", req.Duration)
+		}
+		duration = d
+	}
+	if duration < minCalibrationDuration {
+		return nil, fmt.Errorf("duration must be at least %v", minCalibrationDuration)
+	}
+	if h := req.ReferenceHumidity; h != nil && (*h <= 0 || *h >= 100) {
+		return nil, fmt.Errorf("referenceHumidity must be between 0 and 100")
+	}
+
+	s := &calibrationSession{
+		reference:         strings.TrimSpace(req.Reference),
+		referenceHumidity: req.ReferenceHumidity,
+		startedAt:         now,
+		endsAt:            now.Add(duration),
+		state:             calibrationRunning,
+		samples:           make(map[string]*calibrationSamples),
+	}
+
+	// The reference device is sampled like the others even when not listed
+	names := append([]string(nil), req.Devices...)
+	if s.reference != "" {
+		names = append(names, s.reference)
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if !configured[name] {
+			return nil, fmt.Errorf("unknown device %q", name)
+		}
+		if _, ok := s.samples[name]; ok {
+			continue
+		}
+		s.samples[name] = &calibrationSamples{}
+		s.devices = append(s.devices, name)
+	}
+	sort.Strings(s.devices)
+
+	// Without a reference the devices are compared against their average; a
+	// reference humidity alone is enough for a single-sensor salt test
+	switch {
+	case len(s.devices) == 0:
+		return nil, fmt.Errorf("no devices to calibrate")
+	case s.reference == "" && s.referenceHumidity == nil && len(s.devices) < 2:
+		return nil, fmt.Errorf("at least two devices are required without a reference device or referenceHumidity")
+	}
+	return s, nil
+}
+
+// record adds a reading with the device's current offsets removed
+func (s *calibrationSession) record(govee KnownGovee, temperature, humidity float64) {
+	samples, ok := s.samples[govee.Name]
+	if !ok || s.state != calibrationRunning {
+		return
+	}
+	samples.temperature.add(temperature - govee.TempOffset)
+	samples.humidity.add(humidity - govee.HumidityOffset)
+}
+
+// results compares every device against the reference using the current offsets
+func (s *calibrationSession) results(offsets map[string][2]float64) (results []calibrationResult, refTemp, refHumidity *float64) {
+	// Means as reported with the current offsets
+	type reported struct{ temperature, humidity float64 }
+	means := make(map[string]reported)
+	for _, name := range s.devices {
+		samples := s.samples[name]
+		if samples.temperature.n >= calibrationMinSamples {
+			means[name] = reported{
+				temperature: samples.temperature.mean() + offsets[name][0],
+				humidity:    samples.humidity.mean() + offsets[name][1],
+			}
+		}
+	}
+
+	switch {
+	case s.reference != "":
+		if m, ok := means[s.reference]; ok {
+			refTemp, refHumidity = &m.temperature, &m.humidity
+		}
+	case len(means) >= 2:
+		var t, h float64
+		for _, m := range means {
+			t += m.temperature
+			h += m.humidity
+		}
+		t /= float64(len(means))
+		h /= float64(len(means))
+		refTemp, refHumidity = &t, &h
+	}
+	if s.referenceHumidity != nil {
+		refHumidity = s.referenceHumidity
+	}
+
+	compare := func(stats runningStats, mean, offset float64, ref *float64) *calibrationMetricResult {
+		if ref == nil {
+			return nil
+		}
+		bias := mean - *ref
+		return &calibrationMetricResult{
+			Mean:            roundTo(mean, 2),
+			Spread:          roundTo(stats.stddev(), 2),
+			Bias:            roundTo(bias, 2),
+			CurrentOffset:   offset,
+			SuggestedOffset: roundTo(offset-bias, 2),
+		}
+	}
+
+	for _, name := range s.devices {
+		samples := s.samples[name]
+		result := calibrationResult{Name: name, Samples: samples.temperature.n}
+		m, ok := means[name]
+		switch {
+		case !ok:
+			result.Error = fmt.Sprintf("not enough readings (need %d)", calibrationMinSamples)
+		case refTemp == nil && refHumidity == nil:
+			result.Error = "no reference readings yet"
+		default:
+			result.Temperature = compare(samples.temperature, m.temperature, offsets[name][0], refTemp)
+			result.Humidity = compare(samples.humidity, m.humidity, offsets[name][1], refHumidity)
+		}
+		results = append(results, result)
+	}
+	return results, refTemp, refHumidity
+}
+
+// roundTo rounds v to the given number of decimals
+func roundTo(v float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(v*scale) / scale
+}
+
+// currentOffsets returns the configured offsets of every sensor by name; virtual
+// devices have none to calibrate
+func currentOffsets() map[string][2]float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	offsets := make(map[string][2]float64, len(knownGovees))
+	for _, govee := range knownGovees {
+		if govee.Virtual == nil {
+			offsets[govee.Name] = [2]float64{govee.TempOffset, govee.HumidityOffset}
+		}
+	}
+	return offsets
+}
+
+// statusLocked builds the JSON view of the session. Caller must hold calibrationMu.
+func (s *calibrationSession) statusLocked(offsets map[string][2]float64) calibrationStatus {
+	results, refTemp, refHumidity := s.results(offsets)
+	var values calibrationReferenceValues
+	if refTemp != nil {
+		t := roundTo(*refTemp, 2)
+		values.Temperature = &t
+	}
+	if refHumidity != nil {
+		h := roundTo(*refHumidity, 2)
+		values.Humidity = &h
+	}
+	return calibrationStatus{
+		State:             s.state,
+		Devices:           s.devices,
+		Reference:         s.reference,
+		ReferenceHumidity: s.referenceHumidity,
+		ReferenceValues:   values,
+		StartedAt:         s.startedAt,
+		EndsAt:            s.endsAt,
+		FinishedAt:        s.finishedAt,
+		AppliedAt:         s.appliedAt,
+		Results:           results,
+	}
+}
+
+// stopLocked ends the session in the given state. Caller must hold calibrationMu.
+func (s *calibrationSession) stopLocked(state string, now time.Time) {
+	if s.state != calibrationRunning {
+		return
+	}
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.state = state
+	s.finishedAt = &now
+	log.Printf("Calibration: Session %s", state)
+}
+
+// recordCalibrationSample feeds an accepted reading to the running session, if any
+func recordCalibrationSample(govee KnownGovee, temperature, humidity float64) {
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+	if activeCalibration != nil {
+		activeCalibration.record(govee, temperature, humidity)
+	}
+}
+
+// handleCalibration starts (POST), reports (GET) and cancels (DELETE) a calibration session
+func handleCalibration(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		offsets := currentOffsets()
+		calibrationMu.Lock()
+		defer calibrationMu.Unlock()
+		if activeCalibration == nil {
+			http.Error(w, "No calibration session", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, activeCalibration.statusLocked(offsets))
+	case http.MethodPost:
+		startCalibration(w, r)
+	case http.MethodDelete:
+		offsets := currentOffsets()
+		calibrationMu.Lock()
+		defer calibrationMu.Unlock()
+		if activeCalibration == nil || activeCalibration.state != calibrationRunning {
+			http.Error(w, "No calibration session running", http.StatusNotFound)
+			return
+		}
+		activeCalibration.stopLocked(calibrationCancelled, time.Now())
+		writeJSON(w, http.StatusOK, activeCalibration.statusLocked(offsets))
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// startCalibration starts a session unless one is already running
+func startCalibration(w http.ResponseWriter, r *http.Request) {
+	var req calibrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offsets := currentOffsets()
+	configured := make(map[string]bool, len(offsets))
+	for name := range offsets {
+		configured[name] = true
+	}
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+	if activeCalibration != nil && activeCalibration.state == calibrationRunning {
+		http.Error(w, "A calibration session is already running", http.StatusConflict)
+		return
+	}
+
+	session, err := newCalibrationSession(req, configured, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	session.timer = time.AfterFunc(session.endsAt.Sub(session.startedAt), func() {
+		calibrationMu.Lock()
+		defer calibrationMu.Unlock()
+		session.stopLocked(calibrationFinished, time.Now())
+	})
+	activeCalibration = session
+
+	log.Printf("Calibration: Session started for %s until %s",
+		strings.Join(session.devices, ", "), session.endsAt.Format(time.RFC3339))
+	writeJSON(w, http.StatusCreated, session.statusLocked(offsets))
+}
+
+// handleCalibrationApply writes the suggested offsets of a finished session to
+// config.yaml. Like the device API it needs server.apiToken, and the change is
+// validated and applied at once.
+func handleCalibrationApply(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !authorizeDeviceEdit(w, r) {
+		return
+	}
+	var req calibrationApplyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	deviceEditMu.Lock()
+	defer deviceEditMu.Unlock()
+
+	offsets := currentOffsets()
+	calibrationMu.Lock()
+	session := activeCalibration
+	if session == nil || session.state != calibrationFinished {
+		calibrationMu.Unlock()
+		http.Error(w, "No finished calibration session", http.StatusConflict)
+		return
+	}
+
+	selected := make(map[string]bool, len(req.Devices))
+	for _, name := range req.Devices {
+		selected[name] = true
+	}
+	results, _, _ := session.results(offsets)
+	calibrationMu.Unlock()
+	updates := make(map[string][2]float64)
+	for _, result := range results {
+		if len(selected) > 0 && !selected[result.Name] {
+			continue
+		}
+		if result.Error != "" {
+			continue
+		}
+		update := offsets[result.Name]
+		if result.Temperature != nil {
+			update[0] = result.Temperature.SuggestedOffset
+		}
+		if result.Humidity != nil {
+			update[1] = result.Humidity.SuggestedOffset
+		}
+		updates[result.Name] = update
+	}
+	if len(updates) == 0 {
+		http.Error(w, "No suggested offsets to apply", http.StatusConflict)
+		return
+	}
+
+	config := liveConfig()
+	devices := append([]Device{}, config.Devices...)
+	for i := range devices {
+		if update, ok := updates[devices[i].Name]; ok {
+			devices[i].Offsets.Temperature, devices[i].Offsets.Humidity = update[0], update[1]
+		}
+	}
+	if !validateDeviceEdit(w, config, devices) {
+		return
+	}
+
+	if err := updateDeviceOffsetsInConfigFile(configFilePath, updates); err != nil {
+		log.Printf("Calibration: Failed to apply offsets: %v", err)
+		http.Error(w, "Failed to update config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for name, update := range updates {
+		log.Printf("Calibration: Set offsets of '%s' to %.2f°C / %.2f%%", name, update[0], update[1])
+	}
+	if !applyDeviceEdit(w) {
+		return
+	}
+
+	calibrationMu.Lock()
+	defer calibrationMu.Unlock()
+	now := time.Now()
+	session.appliedAt = &now
+	writeJSON(w, http.StatusOK, session.statusLocked(offsets))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewCalibrationSession(t *testing.T) {
+	configured := map[string]bool{"Office": true, "Attic": true, "Cellar": true}
+	humidity := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		req     calibrationRequest
+		wantErr string
+	}{
+		{"consensus", calibrationRequest{Devices: []string{"Office", "Attic"}}, ""},
+		{"reference added", calibrationRequest{Devices: []string{"Office"}, Reference: "Cellar"}, ""},
+		{"single device", calibrationRequest{Devices: []string{"Office"}}, "at least two devices"},
+		{"single device salt test", calibrationRequest{Devices: []string{"Office"}, ReferenceHumidity: humidity(75)}, ""},
+		{"no devices", calibrationRequest{ReferenceHumidity: humidity(75)}, "no devices"},
+		{"unknown device", calibrationRequest{Devices: []string{"Office", "Garage"}}, "unknown device"},
+		{"short duration", calibrationRequest{Devices: []string{"Office", "Attic"}, Duration: "10s"}, "at least"},
+		{"invalid duration", calibrationRequest{Devices: []string{"Office", "Attic"}, Duration: "soon"}, "invalid duration"},
+		{"invalid humidity", calibrationRequest{Devices: []string{"Office", "Attic"}, ReferenceHumidity: humidity(120)}, "referenceHumidity"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := newCalibrationSession(tt.req, configured, time.Now())
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.req.Reference != "" && s.samples[tt.req.Reference] == nil {
+				t.Errorf("reference device %s is not sampled", tt.req.Reference)
+			}
+		})
+	}
+}
+
+func TestCalibrationResults(t *testing.T) {
+	offsets := map[string][2]float64{"Office": {0.5, 0}, "Attic": {0, 0}, "Cellar": {0, 0}}
+	record := func(s *calibrationSession, name string, temperature, humidity float64) {
+		govee := KnownGovee{Name: name, TempOffset: offsets[name][0], HumidityOffset: offsets[name][1]}
+		for i := 0; i < calibrationMinSamples; i++ {
+			s.record(govee, temperature+offsets[name][0], humidity+offsets[name][1])
+		}
+	}
+	configured := map[string]bool{"Office": true, "Attic": true, "Cellar": true}
+
+	t.Run("consensus", func(t *testing.T) {
+		s, _ := newCalibrationSession(calibrationRequest{Devices: []string{"Office", "Attic"}}, configured, time.Now())
+		record(s, "Office", 21, 50) // reported as 21.5 with its offset
+		record(s, "Attic", 20, 46)
+
+		results, refTemp, refHumidity := s.results(offsets)
+		if *refTemp != 20.75 || *refHumidity != 48 {
+			t.Fatalf("reference = %v/%v, want 20.75/48", *refTemp, *refHumidity)
+		}
+		attic, office := results[0], results[1]
+		if office.Temperature.Bias != 0.75 || office.Temperature.SuggestedOffset != -0.25 {
+			t.Errorf("Office temperature = %+v, want bias 0.75 and offset -0.25", office.Temperature)
+		}
+		if attic.Humidity.SuggestedOffset != 2 {
+			t.Errorf("Attic humidity = %+v, want offset 2", attic.Humidity)
+		}
+	})
+
+	t.Run("reference device and salt test", func(t *testing.T) {
+		salt := 75.0
+		s, _ := newCalibrationSession(calibrationRequest{Devices: []string{"Office"}, Reference: "Cellar", ReferenceHumidity: &salt}, configured, time.Now())
+		record(s, "Office", 20, 73)
+		record(s, "Cellar", 19, 76.5)
+
+		results, _, _ := s.results(offsets)
+		cellar, office := results[0], results[1]
+		if office.Temperature.SuggestedOffset != -1 || office.Humidity.SuggestedOffset != 2 {
+			t.Errorf("Office = %+v / %+v, want offsets -1 and 2", office.Temperature, office.Humidity)
+		}
+		if cellar.Temperature.SuggestedOffset != 0 || cellar.Humidity.SuggestedOffset != -1.5 {
+			t.Errorf("Cellar = %+v / %+v, want offsets 0 and -1.5", cellar.Temperature, cellar.Humidity)
+		}
+	})
+
+	t.Run("single-sensor salt test", func(t *testing.T) {
+		salt := 75.0
+		s, err := newCalibrationSession(calibrationRequest{Devices: []string{"Attic"}, ReferenceHumidity: &salt}, configured, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		record(s, "Attic", 20, 72.5)
+
+		results, refTemp, refHumidity := s.results(offsets)
+		if refTemp != nil || *refHumidity != 75 {
+			t.Fatalf("reference = %v/%v, want no temperature and humidity 75", refTemp, *refHumidity)
+		}
+		if len(results) != 1 || results[0].Temperature != nil || results[0].Humidity == nil || results[0].Humidity.SuggestedOffset != 2.5 {
+			t.Errorf("Attic = %+v, want only a humidity offset of 2.5", results)
+		}
+	})
+
+	t.Run("not enough readings", func(t *testing.T) {
+		s, _ := newCalibrationSession(calibrationRequest{Devices: []string{"Office", "Attic"}}, configured, time.Now())
+		record(s, "Office", 21, 50)
+
+		results, refTemp, _ := s.results(offsets)
+		if refTemp != nil {
+			t.Errorf("reference = %v, want none from a single device", *refTemp)
+		}
+		for _, result := range results {
+			if result.Error == "" {
+				t.Errorf("%s: expected an error, got %+v", result.Name, result)
+			}
+		}
+	})
+}
+
+func TestCalibrationHandlers(t *testing.T) {
+	setupDeviceAPI(t, "server:\n  apiToken: \"s3cret\"\ndevices:\n  - mac: \"AA:BB:CC:DD:EE:01\"\n    name: \"Office\"\n  - mac: \"AA:BB:CC:DD:EE:02\"\n    name: \"Attic\"\n")
+	t.Cleanup(func() {
+		calibrationMu.Lock()
+		if activeCalibration != nil && activeCalibration.timer != nil {
+			activeCalibration.timer.Stop()
+		}
+		activeCalibration = nil
+		calibrationMu.Unlock()
+	})
+	mutex.Lock()
+	office := knownGovees["AA:BB:CC:DD:EE:01"]
+	attic := knownGovees["AA:BB:CC:DD:EE:02"]
+	mutex.Unlock()
+
+	doAs := func(token, method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler := handleCalibration
+		if strings.HasSuffix(path, "/apply") {
+			handler = handleCalibrationApply
+		}
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		handler(rec, req)
+		return rec
+	}
+	do := func(method, path, body string) *httptest.ResponseRecorder { return doAs("s3cret", method, path, body) }
+
+	if rec := do(http.MethodGet, "/api/calibration", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET without session = %d, want 404", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/calibration", `{"devices":["Office","Attic"],"duration":"1h"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("POST = %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/calibration", `{"devices":["Office","Attic"]}`); rec.Code != http.StatusConflict {
+		t.Errorf("second POST = %d, want 409", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/calibration/apply", ""); rec.Code != http.StatusConflict {
+		t.Errorf("apply while running = %d, want 409", rec.Code)
+	}
+
+	for i := 0; i < calibrationMinSamples; i++ {
+		recordCalibrationSample(office, 21, 52)
+		recordCalibrationSample(attic, 20, 48)
+	}
+	calibrationMu.Lock()
+	activeCalibration.stopLocked(calibrationFinished, time.Now())
+	calibrationMu.Unlock()
+
+	if rec := doAs("", http.MethodPost, "/api/calibration/apply", `{"devices":["Attic"]}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("apply without token = %d, want 401", rec.Code)
+	}
+	rec := do(http.MethodPost, "/api/calibration/apply", `{"devices":["Attic"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("apply = %d: %s", rec.Code, rec.Body)
+	}
+	data, _ := os.ReadFile(configFilePath)
+	if !strings.Contains(string(data), "temperature: 0.5") || !strings.Contains(string(data), "humidity: 2.0") {
+		t.Errorf("Attic offsets not written:\n%s", data)
+	}
+	if strings.Count(string(data), "offsets:") != 1 {
+		t.Errorf("only Attic should have been updated:\n%s", data)
+	}
+	if got := currentOffsets()["Attic"]; got != [2]float64{0.5, 2} {
+		t.Errorf("Attic offsets not applied: %v", got)
+	}
+}
@@ -2,32 +2,166 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 )
 
-// Device represents a known Govee H5075 device
+// Device represents a known Govee thermo-hygrometer
 type Device struct {
 	MAC         string `mapstructure:"mac"`
 	Name        string `mapstructure:"name"`
 	DisplayName string `mapstructure:"displayName"` // Optional display name for the dashboard UI
 	Group       string `mapstructure:"group"`       // Optional grouping (e.g., "Upstairs", "Downstairs", "Indoor", "Outdoor")
+	Model       string `mapstructure:"model"`       // Optional model (e.g., "H5075", "H5179"); auto-detected when empty
 	Offsets     struct {
 		Temperature float64 `mapstructure:"temperature"`
 		Humidity    float64 `mapstructure:"humidity"`
 	} `mapstructure:"offsets"`
+	Calibration struct {
+		Temperature Calibration `mapstructure:"temperature"`
+		Humidity    Calibration `mapstructure:"humidity"`
+	} `mapstructure:"calibration"` // Optional; applied to the raw reading before the offsets
+	Filters          *FilterConfig      `mapstructure:"filters"`          // Optional; replaces the global filters for this device
+	StalePolicy      string             `mapstructure:"stalePolicy"`      // Optional; overrides metrics.stalePolicy
+	StaleThreshold   string             `mapstructure:"staleThreshold"`   // Optional; overrides metrics.staleThreshold
+	StaleMisses      *int               `mapstructure:"staleMisses"`      // Optional; overrides metrics.staleMisses
+	StaleGracePeriod string             `mapstructure:"staleGracePeriod"` // Optional; overrides metrics.staleGracePeriod
+	Thresholds       ThresholdOverrides `mapstructure:"thresholds"`       // Optional overrides of the group and global thresholds
+	Labels           map[string]string  `mapstructure:"labels"`           // Optional; added to the device's metrics, overriding the global labels
+}
+
+// VirtualDevice is a sensor computed from other devices and Open-Meteo. The
+// expression is evaluated once for temperature and once for humidity, with
+// device names standing for the metric being computed.
+type VirtualDevice struct {
+	Name        string             `mapstructure:"name"`
+	DisplayName string             `mapstructure:"displayName"`
+	Group       string             `mapstructure:"group"`
+	Expression  string             `mapstructure:"expression"`  // e.g. "avg(Office, Attic)" or "Attic - openmeteo"
+	Temperature string             `mapstructure:"temperature"` // Optional; replaces expression for temperature
+	Humidity    string             `mapstructure:"humidity"`    // Optional; replaces expression for humidity
+	Thresholds  ThresholdOverrides `mapstructure:"thresholds"`
+	Labels      map[string]string  `mapstructure:"labels"`
+}
+
+// FilterConfig configures the filters applied to calibrated readings before they are exported
+type FilterConfig struct {
+	MaxRate struct {
+		Temperature float64 `mapstructure:"temperature"` // °C per minute; 0 disables
+		Humidity    float64 `mapstructure:"humidity"`    // % per minute; 0 disables
+	} `mapstructure:"maxRate"`
+	Median int     `mapstructure:"median"` // Rolling median window in readings; 0 or 1 disables
+	EMA    float64 `mapstructure:"ema"`    // Weight of a new reading in the moving average (0-1]; 0 disables
+}
+
+// Calibration corrects a raw value as gain * raw + offset, or by piecewise-linear
+// interpolation between reference points
+type Calibration struct {
+	Gain   *float64           `mapstructure:"gain"`
+	Offset float64            `mapstructure:"offset"`
+	Points []CalibrationPoint `mapstructure:"points"`
+}
+
+// CalibrationPoint pairs a raw sensor value with the actual (reference) value
+type CalibrationPoint struct {
+	Raw    float64 `mapstructure:"raw"`
+	Actual float64 `mapstructure:"actual"`
+}
+
+// ThresholdOverrides overrides individual thresholds; unset values are inherited
+type ThresholdOverrides struct {
+	Temperature struct {
+		Min  *float64 `mapstructure:"min"`
+		Max  *float64 `mapstructure:"max"`
+		Low  *float64 `mapstructure:"low"`
+		High *float64 `mapstructure:"high"`
+	} `mapstructure:"temperature"`
+	Humidity struct {
+		Low  *float64 `mapstructure:"low"`
+		High *float64 `mapstructure:"high"`
+	} `mapstructure:"humidity"`
+	Battery struct {
+		Low *float64 `mapstructure:"low"`
+	} `mapstructure:"battery"`
+}
+
+// Group holds settings shared by the devices of a group
+type Group struct {
+	Name       string             `mapstructure:"name"`
+	Thresholds ThresholdOverrides `mapstructure:"thresholds"` // Optional overrides of the global thresholds
+}
+
+// DerivedMetricsConfig toggles the psychrometric metrics computed from each reading
+type DerivedMetricsConfig struct {
+	DewPoint              bool `mapstructure:"dewPoint"`
+	AbsoluteHumidity      bool `mapstructure:"absoluteHumidity"`
+	VapourPressureDeficit bool `mapstructure:"vapourPressureDeficit"`
+	HeatIndex             bool `mapstructure:"heatIndex"`
+	Humidex               bool `mapstructure:"humidex"`
+}
+
+// AlertRule raises an alert when a device metric crosses a threshold or a device goes stale
+type AlertRule struct {
+	Name       string   `mapstructure:"name"`
+	Metric     string   `mapstructure:"metric"`     // temperature, humidity, battery or stale
+	Above      *float64 `mapstructure:"above"`      // Fire when the value is above this
+	Below      *float64 `mapstructure:"below"`      // Fire when the value is below this
+	Hysteresis float64  `mapstructure:"hysteresis"` // Distance the value must move back past the threshold to resolve
+	For        string   `mapstructure:"for"`        // How long the condition must hold before firing
+	Repeat     string   `mapstructure:"repeat"`     // Re-notify interval while firing; empty to notify once
+	Devices    []string `mapstructure:"devices"`    // Device names; with groups empty, the rule applies to all devices
+	Groups     []string `mapstructure:"groups"`
+	Webhooks   []string `mapstructure:"webhooks"` // Webhook names; empty to notify all webhooks
+}
+
+// AlertWebhook is an HTTP endpoint that receives alert notifications
+type AlertWebhook struct {
+	Name    string            `mapstructure:"name"`
+	URL     string            `mapstructure:"url"`
+	Method  string            `mapstructure:"method"`  // Defaults to POST
+	Headers map[string]string `mapstructure:"headers"` // e.g. Authorization
+	Body    string            `mapstructure:"body"`    // Go template; defaults to the notification as JSON
+}
+
+// MQTTConfig configures publishing of readings to an MQTT broker
+type MQTTConfig struct {
+	Enabled           bool   `mapstructure:"enabled"`
+	Broker            string `mapstructure:"broker"` // e.g. tcp://localhost:1883, ssl://broker:8883, ws://broker:9001
+	ClientID          string `mapstructure:"clientId"`
+	Username          string `mapstructure:"username"`
+	Password          string `mapstructure:"password"`
+	QoS               int    `mapstructure:"qos"`
+	Retain            bool   `mapstructure:"retain"`
+	Topic             string `mapstructure:"topic"`             // State topic template, e.g. govee/{{group}}/{{name}}/state
+	StatusTopic       string `mapstructure:"statusTopic"`       // Device status topic template
+	AvailabilityTopic string `mapstructure:"availabilityTopic"` // Exporter online/offline topic (last will)
+	TLS               struct {
+		CAFile             string `mapstructure:"caFile"`
+		CertFile           string `mapstructure:"certFile"`
+		KeyFile            string `mapstructure:"keyFile"`
+		InsecureSkipVerify bool   `mapstructure:"insecureSkipVerify"`
+	} `mapstructure:"tls"`
+	HomeAssistant struct {
+		Enabled bool   `mapstructure:"enabled"`
+		Prefix  string `mapstructure:"prefix"` // Discovery prefix configured in Home Assistant
+	} `mapstructure:"homeAssistant"`
 }
 
 // Config holds all configuration settings
 type Config struct {
 	Server struct {
-		Port string `mapstructure:"port"`
+		Port     string `mapstructure:"port"`
+		APIToken string `mapstructure:"apiToken"` // Bearer token for the device management API; empty disables it
 	} `mapstructure:"server"`
 
 	Bluetooth struct {
@@ -43,10 +177,33 @@ type Config struct {
 	} `mapstructure:"openmeteo"`
 
 	Metrics struct {
-		RefreshInterval string `mapstructure:"refreshInterval"`
-		StaleThreshold  string `mapstructure:"staleThreshold"`
+		RefreshInterval  string               `mapstructure:"refreshInterval"`
+		StaleThreshold   string               `mapstructure:"staleThreshold"`
+		StalePolicy      string               `mapstructure:"stalePolicy"`      // delete, keep or nan
+		StaleMisses      int                  `mapstructure:"staleMisses"`      // consecutive checks past the threshold before a device is stale
+		StaleGracePeriod string               `mapstructure:"staleGracePeriod"` // extra time past the threshold before a check counts as a miss
+		Derived          DerivedMetricsConfig `mapstructure:"derived"`
 	} `mapstructure:"metrics"`
 
+	History struct {
+		Enabled    bool   `mapstructure:"enabled"`
+		Resolution string `mapstructure:"resolution"`
+		Retention  string `mapstructure:"retention"`
+	} `mapstructure:"history"`
+
+	MQTT MQTTConfig `mapstructure:"mqtt"`
+
+	Alerts struct {
+		Rules    []AlertRule    `mapstructure:"rules"`
+		Webhooks []AlertWebhook `mapstructure:"webhooks"`
+	} `mapstructure:"alerts"`
+
+	// DataDir holds all persistent state (e.g. the history store); mount it as a volume in containers
+	DataDir string `mapstructure:"dataDir"`
+
+	// Labels are added to the metrics of every device
+	Labels map[string]string `mapstructure:"labels"`
+
 	Thresholds struct {
 		Temperature struct {
 			Min  float64 `mapstructure:"min"`
@@ -65,14 +222,21 @@ type Config struct {
 		} `mapstructure:"battery"`
 	} `mapstructure:"thresholds"`
 
-	Devices []Device `mapstructure:"devices"`
+	Filters FilterConfig `mapstructure:"filters"`
+	Groups  []Group      `mapstructure:"groups"`
+	Devices []Device     `mapstructure:"devices"`
+
+	VirtualDevices []VirtualDevice `mapstructure:"virtualDevices"`
+
+	sources  []ConfigSource // Where each value came from; set by initConfig
+	fileHash string         // SHA-256 of the config file it was loaded from; empty without one
 }
 
 // ConfigSource tracks where each config value came from
 type ConfigSource struct {
-	Key    string
-	Value  interface{}
-	Source string // "default", "config.yaml", or "environment"
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"` // "default", "config.yaml", or "environment"
 }
 
 // Default configuration values
@@ -80,14 +244,39 @@ const (
 	defaultPort               = "8080"
 	defaultRefreshInterval    = "30s"
 	defaultStaleThreshold     = "5m"
+	defaultStalePolicy        = stalePolicyDelete
+	defaultStaleMisses        = 1
+	defaultStaleGracePeriod   = "0s"
 	defaultScanInterval       = "15s"
 	defaultScanDuration       = "15s"
 	defaultOpenMeteoEnabled   = false
 	defaultOpenMeteoInterval  = "15m"
 	defaultOpenMeteoLatitude  = 53.35
 	defaultOpenMeteoLongitude = -6.26
+	defaultDerivedEnabled     = true
+	defaultHistoryEnabled     = false
+	defaultHistoryResolution  = "1m"
+	defaultHistoryRetention   = "720h"
+	defaultDataDir            = "data"
+	defaultMQTTEnabled        = false
+	defaultMQTTBroker         = "tcp://localhost:1883"
+	defaultMQTTQoS            = 0
+	defaultMQTTRetain         = false
+	defaultMQTTTopic          = "govee/{{name}}/state"
+	defaultMQTTStatusTopic    = "govee/{{name}}/status"
+	defaultMQTTAvailability   = "govee/availability"
+	defaultHADiscovery        = true
+	defaultHADiscoveryPrefix  = "homeassistant"
 )
 
+// secretConfigKeys are masked when configuration values are logged
+var secretConfigKeys = map[string]bool{
+	"server.apiToken":         true,
+	"mqtt.password":           true,
+	"alerts.webhooks.url":     true, // Webhook URLs often embed a token
+	"alerts.webhooks.headers": true,
+}
+
 // Default threshold values
 const (
 	defaultTemperatureMin           = -20.0
@@ -122,6 +311,34 @@ func initConfig() (*Config, []ConfigSource, error) {
 	viper.SetDefault("openmeteo.longitude", defaultOpenMeteoLongitude)
 	viper.SetDefault("metrics.refreshInterval", defaultRefreshInterval)
 	viper.SetDefault("metrics.staleThreshold", defaultStaleThreshold)
+	viper.SetDefault("metrics.stalePolicy", defaultStalePolicy)
+	viper.SetDefault("metrics.staleMisses", defaultStaleMisses)
+	viper.SetDefault("metrics.staleGracePeriod", defaultStaleGracePeriod)
+	viper.SetDefault("metrics.derived.dewPoint", defaultDerivedEnabled)
+	viper.SetDefault("metrics.derived.absoluteHumidity", defaultDerivedEnabled)
+	viper.SetDefault("metrics.derived.vapourPressureDeficit", defaultDerivedEnabled)
+	viper.SetDefault("metrics.derived.heatIndex", defaultDerivedEnabled)
+	viper.SetDefault("metrics.derived.humidex", defaultDerivedEnabled)
+	viper.SetDefault("history.enabled", defaultHistoryEnabled)
+	viper.SetDefault("history.resolution", defaultHistoryResolution)
+	viper.SetDefault("history.retention", defaultHistoryRetention)
+	viper.SetDefault("dataDir", defaultDataDir)
+	viper.SetDefault("mqtt.enabled", defaultMQTTEnabled)
+	viper.SetDefault("mqtt.broker", defaultMQTTBroker)
+	viper.SetDefault("mqtt.clientId", "")
+	viper.SetDefault("mqtt.username", "")
+	viper.SetDefault("mqtt.password", "")
+	viper.SetDefault("mqtt.qos", defaultMQTTQoS)
+	viper.SetDefault("mqtt.retain", defaultMQTTRetain)
+	viper.SetDefault("mqtt.topic", defaultMQTTTopic)
+	viper.SetDefault("mqtt.statusTopic", defaultMQTTStatusTopic)
+	viper.SetDefault("mqtt.availabilityTopic", defaultMQTTAvailability)
+	viper.SetDefault("mqtt.tls.caFile", "")
+	viper.SetDefault("mqtt.tls.certFile", "")
+	viper.SetDefault("mqtt.tls.keyFile", "")
+	viper.SetDefault("mqtt.tls.insecureSkipVerify", false)
+	viper.SetDefault("mqtt.homeAssistant.enabled", defaultHADiscovery)
+	viper.SetDefault("mqtt.homeAssistant.prefix", defaultHADiscoveryPrefix)
 	viper.SetDefault("thresholds.temperature.min", defaultTemperatureMin)
 	viper.SetDefault("thresholds.temperature.max", defaultTemperatureMax)
 	viper.SetDefault("thresholds.temperature.low", defaultTemperatureLowThreshold)
@@ -130,6 +347,10 @@ func initConfig() (*Config, []ConfigSource, error) {
 	viper.SetDefault("thresholds.humidity.high", defaultHumidityHighThreshold)
 	viper.SetDefault("thresholds.battery.low", defaultBatteryLowThreshold)
 	viper.SetDefault("devices", []Device{}) // Empty device list by default
+	viper.SetDefault("groups", []Group{})
+	viper.SetDefault("virtualDevices", []VirtualDevice{})
+	viper.SetDefault("alerts.rules", []AlertRule{})
+	viper.SetDefault("alerts.webhooks", []AlertWebhook{})
 
 	// Track configuration sources
 	sources := []ConfigSource{}
@@ -140,9 +361,11 @@ func initConfig() (*Config, []ConfigSource, error) {
 	viper.AddConfigPath(".")
 
 	configFileUsed := false
+	fileHash := ""
 	if err := viper.ReadInConfig(); err == nil {
 		configFileUsed = true
 		log.Printf("Loaded configuration from: %s", viper.ConfigFileUsed())
+		fileHash = configFileHash(viper.ConfigFileUsed())
 	} else {
 		log.Printf("No config.yaml found, using defaults and environment variables")
 	}
@@ -154,10 +377,39 @@ func initConfig() (*Config, []ConfigSource, error) {
 
 	// Bind specific environment variables with backward compatibility
 	viper.BindEnv("server.port", "PORT")
+	viper.BindEnv("server.apiToken", "API_TOKEN")
 	viper.BindEnv("bluetooth.scanInterval", "SCAN_INTERVAL")
 	viper.BindEnv("bluetooth.scanDuration", "SCAN_DURATION")
 	viper.BindEnv("metrics.refreshInterval", "REFRESH_INTERVAL")
 	viper.BindEnv("metrics.staleThreshold", "STALE_THRESHOLD")
+	viper.BindEnv("metrics.stalePolicy", "STALE_POLICY")
+	viper.BindEnv("metrics.staleMisses", "STALE_MISSES")
+	viper.BindEnv("metrics.staleGracePeriod", "STALE_GRACE_PERIOD")
+	viper.BindEnv("metrics.derived.dewPoint", "DERIVED_DEW_POINT")
+	viper.BindEnv("metrics.derived.absoluteHumidity", "DERIVED_ABSOLUTE_HUMIDITY")
+	viper.BindEnv("metrics.derived.vapourPressureDeficit", "DERIVED_VAPOUR_PRESSURE_DEFICIT")
+	viper.BindEnv("metrics.derived.heatIndex", "DERIVED_HEAT_INDEX")
+	viper.BindEnv("metrics.derived.humidex", "DERIVED_HUMIDEX")
+	viper.BindEnv("history.enabled", "HISTORY_ENABLED")
+	viper.BindEnv("history.resolution", "HISTORY_RESOLUTION")
+	viper.BindEnv("history.retention", "HISTORY_RETENTION")
+	viper.BindEnv("dataDir", "DATA_DIR")
+	viper.BindEnv("mqtt.enabled", "MQTT_ENABLED")
+	viper.BindEnv("mqtt.broker", "MQTT_BROKER")
+	viper.BindEnv("mqtt.clientId", "MQTT_CLIENT_ID")
+	viper.BindEnv("mqtt.username", "MQTT_USERNAME")
+	viper.BindEnv("mqtt.password", "MQTT_PASSWORD")
+	viper.BindEnv("mqtt.qos", "MQTT_QOS")
+	viper.BindEnv("mqtt.retain", "MQTT_RETAIN")
+	viper.BindEnv("mqtt.topic", "MQTT_TOPIC")
+	viper.BindEnv("mqtt.statusTopic", "MQTT_STATUS_TOPIC")
+	viper.BindEnv("mqtt.availabilityTopic", "MQTT_AVAILABILITY_TOPIC")
+	viper.BindEnv("mqtt.tls.caFile", "MQTT_TLS_CA_FILE")
+	viper.BindEnv("mqtt.tls.certFile", "MQTT_TLS_CERT_FILE")
+	viper.BindEnv("mqtt.tls.keyFile", "MQTT_TLS_KEY_FILE")
+	viper.BindEnv("mqtt.tls.insecureSkipVerify", "MQTT_TLS_INSECURE_SKIP_VERIFY")
+	viper.BindEnv("mqtt.homeAssistant.enabled", "MQTT_HA_DISCOVERY")
+	viper.BindEnv("mqtt.homeAssistant.prefix", "MQTT_HA_DISCOVERY_PREFIX")
 	viper.BindEnv("thresholds.temperature.min", "TEMPERATURE_MIN")
 	viper.BindEnv("thresholds.temperature.max", "TEMPERATURE_MAX")
 	viper.BindEnv("thresholds.temperature.low", "TEMPERATURE_LOW_THRESHOLD")
@@ -179,10 +431,39 @@ func initConfig() (*Config, []ConfigSource, error) {
 		envVar string
 	}{
 		{"server.port", config.Server.Port, "PORT"},
+		{"server.apiToken", config.Server.APIToken, "API_TOKEN"},
 		{"bluetooth.scanInterval", config.Bluetooth.ScanInterval, "SCAN_INTERVAL"},
 		{"bluetooth.scanDuration", config.Bluetooth.ScanDuration, "SCAN_DURATION"},
 		{"metrics.refreshInterval", config.Metrics.RefreshInterval, "REFRESH_INTERVAL"},
 		{"metrics.staleThreshold", config.Metrics.StaleThreshold, "STALE_THRESHOLD"},
+		{"metrics.stalePolicy", config.Metrics.StalePolicy, "STALE_POLICY"},
+		{"metrics.staleMisses", config.Metrics.StaleMisses, "STALE_MISSES"},
+		{"metrics.staleGracePeriod", config.Metrics.StaleGracePeriod, "STALE_GRACE_PERIOD"},
+		{"metrics.derived.dewPoint", config.Metrics.Derived.DewPoint, "DERIVED_DEW_POINT"},
+		{"metrics.derived.absoluteHumidity", config.Metrics.Derived.AbsoluteHumidity, "DERIVED_ABSOLUTE_HUMIDITY"},
+		{"metrics.derived.vapourPressureDeficit", config.Metrics.Derived.VapourPressureDeficit, "DERIVED_VAPOUR_PRESSURE_DEFICIT"},
+		{"metrics.derived.heatIndex", config.Metrics.Derived.HeatIndex, "DERIVED_HEAT_INDEX"},
+		{"metrics.derived.humidex", config.Metrics.Derived.Humidex, "DERIVED_HUMIDEX"},
+		{"history.enabled", config.History.Enabled, "HISTORY_ENABLED"},
+		{"history.resolution", config.History.Resolution, "HISTORY_RESOLUTION"},
+		{"history.retention", config.History.Retention, "HISTORY_RETENTION"},
+		{"dataDir", config.DataDir, "DATA_DIR"},
+		{"mqtt.enabled", config.MQTT.Enabled, "MQTT_ENABLED"},
+		{"mqtt.broker", config.MQTT.Broker, "MQTT_BROKER"},
+		{"mqtt.clientId", config.MQTT.ClientID, "MQTT_CLIENT_ID"},
+		{"mqtt.username", config.MQTT.Username, "MQTT_USERNAME"},
+		{"mqtt.password", config.MQTT.Password, "MQTT_PASSWORD"},
+		{"mqtt.qos", config.MQTT.QoS, "MQTT_QOS"},
+		{"mqtt.retain", config.MQTT.Retain, "MQTT_RETAIN"},
+		{"mqtt.topic", config.MQTT.Topic, "MQTT_TOPIC"},
+		{"mqtt.statusTopic", config.MQTT.StatusTopic, "MQTT_STATUS_TOPIC"},
+		{"mqtt.availabilityTopic", config.MQTT.AvailabilityTopic, "MQTT_AVAILABILITY_TOPIC"},
+		{"mqtt.tls.caFile", config.MQTT.TLS.CAFile, "MQTT_TLS_CA_FILE"},
+		{"mqtt.tls.certFile", config.MQTT.TLS.CertFile, "MQTT_TLS_CERT_FILE"},
+		{"mqtt.tls.keyFile", config.MQTT.TLS.KeyFile, "MQTT_TLS_KEY_FILE"},
+		{"mqtt.tls.insecureSkipVerify", config.MQTT.TLS.InsecureSkipVerify, "MQTT_TLS_INSECURE_SKIP_VERIFY"},
+		{"mqtt.homeAssistant.enabled", config.MQTT.HomeAssistant.Enabled, "MQTT_HA_DISCOVERY"},
+		{"mqtt.homeAssistant.prefix", config.MQTT.HomeAssistant.Prefix, "MQTT_HA_DISCOVERY_PREFIX"},
 		{"thresholds.temperature.min", config.Thresholds.Temperature.Min, "TEMPERATURE_MIN"},
 		{"thresholds.temperature.max", config.Thresholds.Temperature.Max, "TEMPERATURE_MAX"},
 		{"thresholds.temperature.low", config.Thresholds.Temperature.Low, "TEMPERATURE_LOW_THRESHOLD"},
@@ -190,6 +471,20 @@ func initConfig() (*Config, []ConfigSource, error) {
 		{"thresholds.humidity.low", config.Thresholds.Humidity.Low, "HUMIDITY_LOW_THRESHOLD"},
 		{"thresholds.humidity.high", config.Thresholds.Humidity.High, "HUMIDITY_HIGH_THRESHOLD"},
 		{"thresholds.battery.low", config.Thresholds.Battery.Low, "BATTERY_LOW_THRESHOLD"},
+		// Settings without an environment variable
+		{"openmeteo.enabled", config.OpenMeteo.Enabled, ""},
+		{"openmeteo.interval", config.OpenMeteo.Interval, ""},
+		{"openmeteo.latitude", config.OpenMeteo.Latitude, ""},
+		{"openmeteo.longitude", config.OpenMeteo.Longitude, ""},
+		{"filters.maxRate.temperature", config.Filters.MaxRate.Temperature, ""},
+		{"filters.maxRate.humidity", config.Filters.MaxRate.Humidity, ""},
+		{"filters.median", config.Filters.Median, ""},
+		{"filters.ema", config.Filters.EMA, ""},
+		{"groups", fmt.Sprintf("%d groups", len(config.Groups)), ""},
+		{"virtualDevices", fmt.Sprintf("%d virtual devices", len(config.VirtualDevices)), ""},
+		{"alerts.rules", fmt.Sprintf("%d rules", len(config.Alerts.Rules)), ""},
+		{"alerts.webhooks", fmt.Sprintf("%d webhooks", len(config.Alerts.Webhooks)), ""},
+		{"labels", fmt.Sprintf("%d labels", len(config.Labels)), ""},
 	}
 
 	// Add devices source information
@@ -207,26 +502,102 @@ func initConfig() (*Config, []ConfigSource, error) {
 
 	for _, item := range configKeys {
 		source := "default"
-		if os.Getenv(item.envVar) != "" {
+		if item.envVar != "" && os.Getenv(item.envVar) != "" {
 			source = "environment"
 		} else if configFileUsed && viper.InConfig(item.key) {
 			source = "config.yaml"
 		}
+		value := item.value
+		if secretConfigKeys[item.key] && value != "" {
+			value = redactedValue
+		}
 		sources = append(sources, ConfigSource{
 			Key:    item.key,
-			Value:  item.value,
+			Value:  value,
 			Source: source,
 		})
 	}
 
+	config.sources = sources
+	config.fileHash = fileHash
 	return &config, sources, nil
 }
 
+// configFileHash returns the SHA-256 of a file, or "" when it cannot be read
+func configFileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// configApplier applies a reloaded configuration to every subsystem. main sets it
+// before serving so handlers that edit config.yaml can apply their change at once.
+var configApplier func(*Config)
+
+// reloadMu serializes reloads from the file watcher and SIGHUP, since initConfig
+// works on the global viper instance
+var reloadMu sync.Mutex
+
+// reloadConfig re-reads and validates the configuration and passes it to
+// onReload. It keeps the existing config and returns false when the new one
+// cannot be loaded or has any problem, so a half-saved file is never applied.
+func reloadConfig(onReload func(*Config)) bool {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	return reloadConfigLocked(onReload)
+}
+
+// reloadConfigIfChanged reloads the configuration unless path holds the file that
+// is already in effect, e.g. one the device API just wrote and applied, or one
+// whose timestamp was the only thing touched. The check is made under reloadMu so
+// a reload that is still applying the same file is waited for, not repeated.
+func reloadConfigIfChanged(path string, onReload func(*Config)) bool {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	if hash := configFileHash(path); hash != "" && hash == liveConfig().fileHash {
+		return false
+	}
+	log.Println("Config file changed, reloading configuration...")
+	return reloadConfigLocked(onReload)
+}
+
+// reloadConfigLocked does the work of reloadConfig. Caller must hold reloadMu.
+func reloadConfigLocked(onReload func(*Config)) bool {
+	newConfig, _, err := initConfig()
+	if err == nil {
+		err = validateConfig(newConfig)
+	}
+	if err != nil {
+		log.Printf("Failed to reload configuration: %v. Keeping existing config.", err)
+		recordConfigReload(false, time.Now())
+		return false
+	}
+	recordConfigReload(true, time.Now())
+	if onReload != nil {
+		onReload(newConfig)
+	}
+	log.Println("Configuration reloaded successfully")
+	return true
+}
+
+// liveConfig returns the configuration currently in effect; it changes on reload
+func liveConfig() *Config {
+	currentConfigMu.RLock()
+	defer currentConfigMu.RUnlock()
+	if currentConfig == nil {
+		return &Config{}
+	}
+	return currentConfig
+}
+
 // watchConfigFile monitors the config.yaml file for changes and reloads configuration
 // The onReload callback is called when configuration is successfully reloaded
 func watchConfigFile(ctx context.Context, onReload func(*Config)) {
 	// Check if config.yaml exists
-	configPath := "config.yaml"
+	configPath := configFilePath
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.Printf("Config file watcher: %s not found, hot-reload disabled", configPath)
 		return
@@ -240,8 +611,12 @@ func watchConfigFile(ctx context.Context, onReload func(*Config)) {
 	}
 	defer watcher.Close()
 
-	// Add config file to watcher
+	// Watch the directory too: a file replaced by rename (editors, the device API)
+	// is a new inode that the watch on the file itself no longer follows
 	err = watcher.Add(configPath)
+	if err == nil {
+		err = watcher.Add(filepath.Dir(configPath))
+	}
 	if err != nil {
 		log.Printf("Failed to watch config file: %v. Hot-reload disabled.", err)
 		return
@@ -266,6 +641,14 @@ func watchConfigFile(ctx context.Context, onReload func(*Config)) {
 				return
 			}
 
+			if filepath.Base(event.Name) != filepath.Base(configPath) {
+				continue
+			}
+			if event.Op&fsnotify.Create == fsnotify.Create {
+				// Follow the new file, e.g. for in-place writes through a bind mount
+				watcher.Add(configPath)
+			}
+
 			// Watch for Write and Create events (editors may delete and recreate files)
 			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
 				// Debounce: reset timer if it exists, or create new one
@@ -274,20 +657,7 @@ func watchConfigFile(ctx context.Context, onReload func(*Config)) {
 				}
 
 				debounceTimer = time.AfterFunc(debounceDuration, func() {
-					log.Println("Config file changed, reloading configuration...")
-
-					// Reload configuration
-					newConfig, _, err := initConfig()
-					if err != nil {
-						log.Printf("Failed to reload configuration: %v. Keeping existing config.", err)
-						return
-					}
-
-					// Call the reload callback
-					if onReload != nil {
-						onReload(newConfig)
-					}
-					log.Println("Configuration reloaded successfully")
+					reloadConfigIfChanged(configPath, onReload)
 				})
 			}
 
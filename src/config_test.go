@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -118,3 +121,76 @@ func TestConfigWatcherContextCancellation(t *testing.T) {
 		t.Fatal("Config watcher did not stop after context cancellation")
 	}
 }
+
+func TestReloadConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	if err := os.WriteFile("config.yaml", []byte("server:\n  port: \"9191\"\nbluetooth:\n  scanInterval: 2m\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var reloaded *Config
+	if !reloadConfig(func(c *Config) { reloaded = c }) {
+		t.Fatal("reloadConfig returned false")
+	}
+	if reloaded == nil || reloaded.Server.Port != "9191" || reloaded.Bluetooth.ScanInterval != "2m" {
+		t.Errorf("reloaded config = %+v", reloaded)
+	}
+
+	// A config that cannot be decoded keeps the existing one
+	if err := os.WriteFile("config.yaml", []byte("devices: not-a-list\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reloadConfig(func(*Config) { t.Error("onReload called for an invalid config") }) {
+		t.Error("reloadConfig returned true for an invalid config")
+	}
+}
+
+func TestReloadConfigIfChanged(t *testing.T) {
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	if err := os.WriteFile("config.yaml", []byte("server:\n  port: \"9191\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := initConfig()
+	if err != nil {
+		t.Fatalf("initConfig: %v", err)
+	}
+	withCurrentConfig(t, config)
+	apply := func(c *Config) {
+		currentConfigMu.Lock()
+		currentConfig = c
+		currentConfigMu.Unlock()
+	}
+
+	// The file in effect is not reloaded again
+	if reloadConfigIfChanged("config.yaml", func(*Config) { t.Error("onReload called for the applied file") }) {
+		t.Error("reloadConfigIfChanged reloaded the applied file")
+	}
+
+	// Two watcher callbacks for the same edit reload it once
+	if err := os.WriteFile("config.yaml", []byte("server:\n  port: \"9292\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var reloads atomic.Int32
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reloadConfigIfChanged("config.yaml", func(c *Config) {
+				reloads.Add(1)
+				apply(c)
+			})
+		}()
+	}
+	wg.Wait()
+	if got := reloads.Load(); got != 1 {
+		t.Errorf("reloads = %d, want 1", got)
+	}
+	if got := liveConfig().Server.Port; got != "9292" {
+		t.Errorf("port = %s, want 9292", got)
+	}
+}
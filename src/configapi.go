@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// redactedValue replaces secrets in the config API and the sources log
+const redactedValue = "********"
+
+// apiConfig is the effective configuration served by /api/config
+type apiConfig struct {
+	Config  interface{}       `json:"config"`  // Keyed like config.yaml, with secrets redacted
+	Sources []ConfigSource    `json:"sources"` // Where each setting came from
+	Devices []apiConfigDevice `json:"devices"` // Device settings as resolved from the device, group and global values
+}
+
+// apiConfigDevice is the resolved configuration of one device
+type apiConfigDevice struct {
+	MAC              string            `json:"mac"`
+	Name             string            `json:"name"`
+	DisplayName      string            `json:"displayName"`
+	Group            string            `json:"group"`
+	Model            string            `json:"model"`             // "auto" when detected from advertisements, "virtual" for virtual devices
+	Virtual          string            `json:"virtual,omitempty"` // The expressions of a virtual device
+	Offsets          apiOffsets        `json:"offsets"`
+	Calibration      apiCalibration    `json:"calibration"`
+	Thresholds       Thresholds        `json:"thresholds"`
+	Filters          apiFilters        `json:"filters"`
+	StalePolicy      string            `json:"stalePolicy"`
+	StaleThreshold   string            `json:"staleThreshold"` // Empty when metrics.staleThreshold applies
+	StaleMisses      int               `json:"staleMisses"`
+	StaleGracePeriod string            `json:"staleGracePeriod"`
+	Labels           map[string]string `json:"labels"` // Custom metric labels, merged from the device and global labels
+}
+
+// apiCalibration describes the calibration of each metric
+type apiCalibration struct {
+	Temperature string `json:"temperature"`
+	Humidity    string `json:"humidity"`
+}
+
+// apiFilters is the filter chain that applies to a device
+type apiFilters struct {
+	MaxRateTemperature float64 `json:"maxRateTemperature"`
+	MaxRateHumidity    float64 `json:"maxRateHumidity"`
+	Median             int     `json:"median"`
+	EMA                float64 `json:"ema"`
+}
+
+// configTree converts a config value into maps keyed by its mapstructure tags, as
+// written in config.yaml. Values under secretConfigKeys are redacted; path is the
+// dotted key of v without slice indexes.
+func configTree(v reflect.Value, path string) interface{} {
+	if secretConfigKeys[path] {
+		return redact(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return configTree(v.Elem(), path)
+	case reflect.Struct:
+		tree := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+			if !field.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			key := name
+			if path != "" {
+				key = path + "." + name
+			}
+			tree[name] = configTree(v.Field(i), key)
+		}
+		return tree
+	case reflect.Slice:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = configTree(v.Index(i), path)
+		}
+		return list
+	case reflect.Map:
+		tree := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			tree[key.String()] = configTree(v.MapIndex(key), path)
+		}
+		return tree
+	default:
+		return v.Interface()
+	}
+}
+
+// redact hides a secret value, keeping map keys (e.g. header names) and empty values visible
+func redact(v reflect.Value) interface{} {
+	switch {
+	case v.Kind() == reflect.Map:
+		tree := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			tree[key.String()] = redactedValue
+		}
+		return tree
+	case v.IsZero():
+		return v.Interface()
+	default:
+		return redactedValue
+	}
+}
+
+// snapshotConfig builds the /api/config view of the live configuration
+func snapshotConfig() apiConfig {
+	config := liveConfig()
+	view := apiConfig{
+		Config:  configTree(reflect.ValueOf(*config), ""),
+		Sources: config.sources,
+		Devices: []apiConfigDevice{},
+	}
+	if view.Sources == nil {
+		view.Sources = []ConfigSource{}
+	}
+
+	mutex.Lock()
+	for mac, govee := range knownGovees {
+		device := apiConfigDevice{
+			MAC:         mac,
+			Name:        govee.Name,
+			DisplayName: govee.DisplayName,
+			Group:       govee.Group,
+			Model:       govee.Model,
+			Offsets:     apiOffsets{Temperature: govee.TempOffset, Humidity: govee.HumidityOffset},
+			Calibration: apiCalibration{
+				Temperature: govee.TempCalibration.describe(),
+				Humidity:    govee.HumidityCalibration.describe(),
+			},
+			Thresholds: govee.Thresholds,
+			Filters: apiFilters{
+				MaxRateTemperature: govee.Filters.MaxRate.Temperature,
+				MaxRateHumidity:    govee.Filters.MaxRate.Humidity,
+				Median:             govee.Filters.Median,
+				EMA:                govee.Filters.EMA,
+			},
+			StalePolicy:      govee.StalePolicy,
+			StaleMisses:      govee.StaleMisses,
+			StaleGracePeriod: govee.StaleGracePeriod.String(),
+			Labels:           govee.Labels,
+		}
+		switch {
+		case govee.Virtual != nil:
+			device.MAC, device.Model, device.Virtual = "", "virtual", govee.Virtual.describe()
+		case device.Model == "":
+			device.Model = "auto"
+		}
+		if govee.StaleThreshold > 0 {
+			device.StaleThreshold = govee.StaleThreshold.String()
+		}
+		if device.Labels == nil {
+			device.Labels = map[string]string{}
+		}
+		view.Devices = append(view.Devices, device)
+	}
+	mutex.Unlock()
+
+	sort.Slice(view.Devices, func(i, j int) bool { return view.Devices[i].Name < view.Devices[j].Name })
+	return view
+}
+
+// handleConfig serves /api/config
+func handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, snapshotConfig())
+}
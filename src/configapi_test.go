@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestHandleConfig(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+
+	yaml := `
+metrics:
+  staleThreshold: 10m
+mqtt:
+  password: hunter2
+alerts:
+  webhooks:
+    - name: ntfy
+      url: https://ntfy.sh/secret-topic
+      headers:
+        Authorization: Bearer token
+devices:
+  - mac: "a4:c1:38:00:00:01"
+    name: Office
+    displayName: Office Desk
+    group: Upstairs
+    offsets:
+      temperature: -0.5
+    calibration:
+      humidity:
+        gain: 1.1
+`
+	if err := os.WriteFile("config.yaml", []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SCAN_INTERVAL", "45s")
+	config, _, err := initConfig()
+	if err != nil {
+		t.Fatalf("initConfig: %v", err)
+	}
+	withCurrentConfig(t, config)
+	loadKnownGovees(config)
+
+	rec := httptest.NewRecorder()
+	handleConfig(rec, httptest.NewRequest(http.MethodGet, "/api/config", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var view struct {
+		Config struct {
+			Bluetooth map[string]interface{} `json:"bluetooth"`
+			MQTT      map[string]interface{} `json:"mqtt"`
+			Alerts    struct {
+				Webhooks []struct {
+					URL     string            `json:"url"`
+					Headers map[string]string `json:"headers"`
+				} `json:"webhooks"`
+			} `json:"alerts"`
+		} `json:"config"`
+		Sources []ConfigSource    `json:"sources"`
+		Devices []apiConfigDevice `json:"devices"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &view); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	if view.Config.Bluetooth["scanInterval"] != "45s" {
+		t.Errorf("bluetooth.scanInterval = %v, want 45s", view.Config.Bluetooth["scanInterval"])
+	}
+	if view.Config.MQTT["password"] != redactedValue {
+		t.Errorf("mqtt.password = %v, want it redacted", view.Config.MQTT["password"])
+	}
+	webhooks := view.Config.Alerts.Webhooks
+	if len(webhooks) != 1 || webhooks[0].URL != redactedValue || webhooks[0].Headers["authorization"] != redactedValue {
+		t.Errorf("webhooks = %+v, want url and header values redacted", webhooks)
+	}
+
+	sources := make(map[string]ConfigSource)
+	for _, s := range view.Sources {
+		sources[s.Key] = s
+	}
+	for key, want := range map[string]string{
+		"bluetooth.scanInterval": "environment",
+		"metrics.staleThreshold": "config.yaml",
+		"server.port":            "default",
+		"openmeteo.interval":     "default",
+		"devices":                "config.yaml",
+	} {
+		if got := sources[key].Source; got != want {
+			t.Errorf("source of %s = %q, want %q", key, got, want)
+		}
+	}
+	if sources["mqtt.password"].Value != redactedValue {
+		t.Errorf("mqtt.password source value = %v, want it redacted", sources["mqtt.password"].Value)
+	}
+
+	if len(view.Devices) != 1 {
+		t.Fatalf("got %d devices, want 1", len(view.Devices))
+	}
+	office := view.Devices[0]
+	if office.MAC != "A4:C1:38:00:00:01" || office.DisplayName != "Office Desk" || office.Group != "Upstairs" || office.Model != "auto" {
+		t.Errorf("device = %+v", office)
+	}
+	if office.Offsets.Temperature != -0.5 || office.Calibration.Humidity != "x1.100+0.00" || office.Calibration.Temperature != "none" {
+		t.Errorf("device calibration = %+v / %+v", office.Offsets, office.Calibration)
+	}
+
+	rec = httptest.NewRecorder()
+	handleConfig(rec, httptest.NewRequest(http.MethodPost, "/api/config", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want 405", rec.Code)
+	}
+}
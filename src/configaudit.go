@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxConfigHistory bounds the number of config changes kept for /api/config/history
+const maxConfigHistory = 50
+
+// configDevice identifies a device in a config change
+type configDevice struct {
+	MAC  string `json:"mac"`
+	Name string `json:"name"`
+}
+
+// configRename is a device whose MAC is unchanged but whose name changed
+type configRename struct {
+	MAC  string `json:"mac"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// configSettingChange is one setting whose value changed. Device settings are
+// keyed as devices.<name>.<setting>; secrets are redacted.
+type configSettingChange struct {
+	Key  string      `json:"key"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// configChange is the difference an applied reload made to the configuration
+type configChange struct {
+	Time     time.Time             `json:"time"`
+	FileHash string                `json:"fileHash"` // SHA-256 of the config file that was applied
+	Added    []configDevice        `json:"added"`
+	Removed  []configDevice        `json:"removed"`
+	Renamed  []configRename        `json:"renamed"`
+	Changes  []configSettingChange `json:"changes"`
+}
+
+var (
+	configHistoryMu = &sync.Mutex{}
+	configHistory   []configChange // Oldest first
+)
+
+// flattenConfigTree maps every leaf of a configTree to its dotted key. Lists are
+// leaves, so they are compared as a whole.
+func flattenConfigTree(prefix string, tree interface{}, out map[string]interface{}) {
+	m, ok := tree.(map[string]interface{})
+	if !ok {
+		out[prefix] = tree
+		return
+	}
+	for key, value := range m {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flattenConfigTree(key, value, out)
+	}
+}
+
+// flatConfig flattens a config value, redacting secrets; path is its key in config.yaml
+func flatConfig(v interface{}, path string) map[string]interface{} {
+	flat := make(map[string]interface{})
+	flattenConfigTree("", configTree(reflect.ValueOf(v), path), flat)
+	return flat
+}
+
+// diffSettings appends a change for every key whose value differs between previous and current
+func diffSettings(changes []configSettingChange, prefix string, previous, current map[string]interface{}) []configSettingChange {
+	keys := make(map[string]struct{}, len(previous)+len(current))
+	for key := range previous {
+		keys[key] = struct{}{}
+	}
+	for key := range current {
+		keys[key] = struct{}{}
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		if !reflect.DeepEqual(previous[key], current[key]) {
+			changes = append(changes, configSettingChange{Key: prefix + key, From: previous[key], To: current[key]})
+		}
+	}
+	return changes
+}
+
+// devicesByMAC indexes the configured devices by upper-case MAC
+func devicesByMAC(devices []Device) map[string]Device {
+	byMAC := make(map[string]Device, len(devices))
+	for _, device := range devices {
+		byMAC[strings.ToUpper(device.MAC)] = device
+	}
+	return byMAC
+}
+
+// diffConfig describes what changed from previous to current. Devices are matched
+// by MAC, so a device whose name changed is reported as renamed, not replaced.
+func diffConfig(previous, current *Config) configChange {
+	change := configChange{
+		FileHash: current.fileHash,
+		Added:    []configDevice{},
+		Removed:  []configDevice{},
+		Renamed:  []configRename{},
+		Changes:  []configSettingChange{},
+	}
+
+	// Everything but the devices, which are compared one by one below
+	oldSettings, newSettings := *previous, *current
+	oldSettings.Devices, newSettings.Devices = nil, nil
+	change.Changes = diffSettings(change.Changes, "", flatConfig(oldSettings, ""), flatConfig(newSettings, ""))
+
+	oldDevices, newDevices := devicesByMAC(previous.Devices), devicesByMAC(current.Devices)
+	macs := make([]string, 0, len(oldDevices)+len(newDevices))
+	for mac := range oldDevices {
+		macs = append(macs, mac)
+	}
+	for mac := range newDevices {
+		if _, ok := oldDevices[mac]; !ok {
+			macs = append(macs, mac)
+		}
+	}
+	sort.Strings(macs)
+
+	for _, mac := range macs {
+		before, hadBefore := oldDevices[mac]
+		after, hasAfter := newDevices[mac]
+		switch {
+		case !hadBefore:
+			change.Added = append(change.Added, configDevice{MAC: mac, Name: after.Name})
+		case !hasAfter:
+			change.Removed = append(change.Removed, configDevice{MAC: mac, Name: before.Name})
+		default:
+			if before.Name != after.Name {
+				change.Renamed = append(change.Renamed, configRename{MAC: mac, From: before.Name, To: after.Name})
+			}
+			// MAC case and the name are reported above
+			prefix := "devices." + after.Name + "."
+			before.MAC, before.Name = "", ""
+			after.MAC, after.Name = "", ""
+			change.Changes = diffSettings(change.Changes, prefix, flatConfig(before, "devices"), flatConfig(after, "devices"))
+		}
+	}
+	return change
+}
+
+// empty reports whether the reload changed nothing, e.g. only comments were edited
+func (c configChange) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Renamed) == 0 && len(c.Changes) == 0
+}
+
+// logConfigChange logs each part of a config change on its own line
+func logConfigChange(c configChange) {
+	if c.empty() {
+		log.Println("Config change: No effective changes")
+		return
+	}
+	for _, d := range c.Added {
+		log.Printf("Config change: Device '%s' (%s) added", d.Name, d.MAC)
+	}
+	for _, d := range c.Removed {
+		log.Printf("Config change: Device '%s' (%s) removed", d.Name, d.MAC)
+	}
+	for _, r := range c.Renamed {
+		log.Printf("Config change: Device %s renamed from '%s' to '%s'", r.MAC, r.From, r.To)
+	}
+	for _, s := range c.Changes {
+		log.Printf("Config change: %s: %s -> %s", s.Key, formatConfigValue(s.From), formatConfigValue(s.To))
+	}
+}
+
+// formatConfigValue prints a setting for the log, showing unset values as such
+func formatConfigValue(v interface{}) string {
+	if v == nil {
+		return "(unset)"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// recordConfigChange diffs an applied config against the previous one, logs the
+// diff and adds it to the history
+func recordConfigChange(previous, current *Config, now time.Time) {
+	if previous == nil || current == nil {
+		return
+	}
+	change := diffConfig(previous, current)
+	change.Time = now
+	logConfigChange(change)
+
+	configHistoryMu.Lock()
+	configHistory = append(configHistory, change)
+	if len(configHistory) > maxConfigHistory {
+		configHistory = configHistory[len(configHistory)-maxConfigHistory:]
+	}
+	configHistoryMu.Unlock()
+}
+
+// handleConfigHistory serves /api/config/history, newest change first
+func handleConfigHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	configHistoryMu.Lock()
+	history := make([]configChange, 0, len(configHistory))
+	for i := len(configHistory) - 1; i >= 0; i-- {
+		history = append(history, configHistory[i])
+	}
+	configHistoryMu.Unlock()
+
+	writeJSON(w, http.StatusOK, history)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDiffConfig(t *testing.T) {
+	high := 16.0
+	previous := &Config{}
+	previous.Thresholds.Temperature.High = 35
+	previous.MQTT.Password = "old"
+	previous.Devices = []Device{
+		{MAC: "A4:C1:38:00:00:01", Name: "Office"},
+		{MAC: "A4:C1:38:00:00:02", Name: "Attic"},
+		{MAC: "A4:C1:38:00:00:03", Name: "Cellar"},
+	}
+
+	current := &Config{fileHash: "abc123"}
+	current.Thresholds.Temperature.High = 30
+	current.MQTT.Password = "new"
+	current.Devices = []Device{
+		{MAC: "a4:c1:38:00:00:01", Name: "Office"},
+		{MAC: "A4:C1:38:00:00:03", Name: "Wine Cellar"},
+		{MAC: "A4:C1:38:00:00:04", Name: "Garage"},
+	}
+	current.Devices[0].Offsets.Temperature = -0.5
+	current.Devices[1].Thresholds.Temperature.High = &high
+
+	change := diffConfig(previous, current)
+	if change.FileHash != "abc123" {
+		t.Errorf("FileHash = %q, want abc123", change.FileHash)
+	}
+	if len(change.Added) != 1 || change.Added[0] != (configDevice{MAC: "A4:C1:38:00:00:04", Name: "Garage"}) {
+		t.Errorf("Added = %+v", change.Added)
+	}
+	if len(change.Removed) != 1 || change.Removed[0].Name != "Attic" {
+		t.Errorf("Removed = %+v", change.Removed)
+	}
+	if len(change.Renamed) != 1 || change.Renamed[0] != (configRename{MAC: "A4:C1:38:00:00:03", From: "Cellar", To: "Wine Cellar"}) {
+		t.Errorf("Renamed = %+v", change.Renamed)
+	}
+
+	want := []configSettingChange{
+		{Key: "thresholds.temperature.high", From: 35.0, To: 30.0},
+		{Key: "devices.Office.offsets.temperature", From: 0.0, To: -0.5},
+		{Key: "devices.Wine Cellar.thresholds.temperature.high", From: nil, To: 16.0},
+	}
+	if len(change.Changes) != len(want) {
+		t.Fatalf("Changes = %+v, want %+v", change.Changes, want)
+	}
+	for i, w := range want {
+		if change.Changes[i] != w {
+			t.Errorf("Changes[%d] = %+v, want %+v", i, change.Changes[i], w)
+		}
+	}
+
+	if !diffConfig(current, current).empty() {
+		t.Error("diff of a config with itself is not empty")
+	}
+}
+
+func TestConfigHistory(t *testing.T) {
+	configHistoryMu.Lock()
+	saved := configHistory
+	configHistory = nil
+	configHistoryMu.Unlock()
+	t.Cleanup(func() {
+		configHistoryMu.Lock()
+		configHistory = saved
+		configHistoryMu.Unlock()
+	})
+
+	previous := &Config{}
+	now := time.Now()
+	for i := 0; i < maxConfigHistory+5; i++ {
+		current := &Config{fileHash: string(rune('a' + i%26))}
+		current.Server.Port = string(rune('0' + i%10))
+		recordConfigChange(previous, current, now.Add(time.Duration(i)*time.Second))
+		previous = current
+	}
+
+	rec := httptest.NewRecorder()
+	handleConfigHistory(rec, httptest.NewRequest(http.MethodGet, "/api/config/history", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var history []configChange
+	if err := json.Unmarshal(rec.Body.Bytes(), &history); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != maxConfigHistory {
+		t.Fatalf("got %d entries, want %d", len(history), maxConfigHistory)
+	}
+	if !history[0].Time.After(history[1].Time) {
+		t.Error("history is not newest first")
+	}
+	if last := maxConfigHistory + 4; !history[0].Time.Equal(now.Add(time.Duration(last) * time.Second)) {
+		t.Errorf("newest entry at %v, want the last recorded change", history[0].Time)
+	}
+
+	rec = httptest.NewRecorder()
+	handleConfigHistory(rec, httptest.NewRequest(http.MethodDelete, "/api/config/history", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE status = %d, want 405", rec.Code)
+	}
+}
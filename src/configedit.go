@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// configFilePath is the config file read at startup, watched for hot-reload and
+// edited by the API
+const configFilePath = "config.yaml"
+
+// configFileMu serializes programmatic edits of the config file
+var configFileMu = &sync.Mutex{}
+
+// readConfigDocument parses the config file into a yaml.Node tree so it can be
+// edited without losing comments or key order
+func readConfigDocument(path string) (*yaml.Node, os.FileMode, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	// An empty file decodes to a zero node; start a fresh document instead
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, 0, fmt.Errorf("%s does not contain a YAML mapping", path)
+	}
+
+	return &doc, info.Mode().Perm(), nil
+}
+
+// writeConfigDocument serializes the document back to the config file. The file
+// is replaced atomically, so the watcher never reloads a half-written file.
+func writeConfigDocument(path string, doc *yaml.Node, mode os.FileMode) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+
+	return writeFileAtomic(path, buf.Bytes(), mode)
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it
+// over path. A file bind-mounted into a container cannot be replaced, so when
+// the rename fails it falls back to writing in place.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Chmod(mode)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		log.Printf("Warning: Cannot replace %s atomically (%v), writing it in place", path, err)
+		return os.WriteFile(path, data, mode)
+	}
+	return nil
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// ensureMappingValue returns the value node for key, appending a new node of the
+// given kind when the key is missing
+func ensureMappingValue(mapping *yaml.Node, key string, kind yaml.Kind) *yaml.Node {
+	if value := mappingValue(mapping, key); value != nil {
+		return value
+	}
+	value := &yaml.Node{Kind: kind}
+	mapping.Content = append(mapping.Content, stringNode(key, 0), value)
+	return value
+}
+
+// setMappingScalar sets key to a scalar, replacing an existing value in place so
+// its comments survive
+func setMappingScalar(mapping *yaml.Node, key string, replacement *yaml.Node) {
+	value := ensureMappingValue(mapping, key, yaml.ScalarNode)
+	value.Kind, value.Tag, value.Value, value.Style, value.Content = replacement.Kind, replacement.Tag, replacement.Value, replacement.Style, nil
+}
+
+// deleteMappingKey removes key and its value from a mapping node
+func deleteMappingKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// stringNode builds a scalar string node
+func stringNode(value string, style yaml.Style) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style}
+}
+
+// floatNode builds a scalar float node
+func floatNode(value float64) *yaml.Node {
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+	if value == float64(int64(value)) {
+		formatted = strconv.FormatFloat(value, 'f', 1, 64)
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: formatted}
+}
+
+// deviceNode renders a Device as a YAML mapping, omitting optional empty fields
+func deviceNode(device Device) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	add := func(key string, value *yaml.Node) {
+		node.Content = append(node.Content, stringNode(key, 0), value)
+	}
+
+	add("mac", stringNode(device.MAC, yaml.DoubleQuotedStyle))
+	add("name", stringNode(device.Name, yaml.DoubleQuotedStyle))
+	if device.DisplayName != "" {
+		add("displayName", stringNode(device.DisplayName, yaml.DoubleQuotedStyle))
+	}
+	if device.Group != "" {
+		add("group", stringNode(device.Group, yaml.DoubleQuotedStyle))
+	}
+	if device.Model != "" {
+		add("model", stringNode(device.Model, yaml.DoubleQuotedStyle))
+	}
+
+	offsets := &yaml.Node{Kind: yaml.MappingNode}
+	offsets.Content = append(offsets.Content,
+		stringNode("temperature", 0), floatNode(device.Offsets.Temperature),
+		stringNode("humidity", 0), floatNode(device.Offsets.Humidity))
+	add("offsets", offsets)
+
+	return node
+}
+
+// appendDeviceToConfigFile adds a device to the end of the devices list in the
+// config file, keeping the rest of the file (including comments) intact
+func appendDeviceToConfigFile(path string, device Device) error {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	doc, mode, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+
+	devices := ensureMappingValue(doc.Content[0], "devices", yaml.SequenceNode)
+	if devices.Kind == yaml.ScalarNode && devices.Tag == "!!null" {
+		*devices = yaml.Node{Kind: yaml.SequenceNode}
+	}
+	if devices.Kind != yaml.SequenceNode {
+		return fmt.Errorf("devices in %s is not a list", path)
+	}
+	// An empty "devices: []" would otherwise keep its flow style
+	devices.Style = 0
+	devices.Content = append(devices.Content, deviceNode(device))
+
+	return writeConfigDocument(path, doc, mode)
+}
+
+// updateDeviceOffsetsInConfigFile sets the offsets of devices, keyed by name, in
+// the config file, keeping the rest of the file (including comments) intact
+func updateDeviceOffsetsInConfigFile(path string, offsets map[string][2]float64) error {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	doc, mode, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+
+	devices := mappingValue(doc.Content[0], "devices")
+	if devices == nil || devices.Kind != yaml.SequenceNode {
+		return fmt.Errorf("no devices list in %s", path)
+	}
+
+	updated := make(map[string]bool, len(offsets))
+	for _, device := range devices.Content {
+		if device.Kind != yaml.MappingNode {
+			continue
+		}
+		name := mappingValue(device, "name")
+		if name == nil {
+			continue
+		}
+		values, ok := offsets[name.Value]
+		if !ok {
+			continue
+		}
+
+		node := ensureMappingValue(device, "offsets", yaml.MappingNode)
+		if node.Kind != yaml.MappingNode {
+			*node = yaml.Node{Kind: yaml.MappingNode}
+		}
+		for i, key := range []string{"temperature", "humidity"} {
+			// Replace the scalar in place so line comments survive
+			value := ensureMappingValue(node, key, yaml.ScalarNode)
+			replacement := floatNode(values[i])
+			value.Kind, value.Tag, value.Value, value.Style = replacement.Kind, replacement.Tag, replacement.Value, 0
+		}
+		updated[name.Value] = true
+	}
+
+	for name := range offsets {
+		if !updated[name] {
+			return fmt.Errorf("device %q not found in %s", name, path)
+		}
+	}
+	return writeConfigDocument(path, doc, mode)
+}
+
+// deviceUpdate holds the device fields to change; nil fields are left as they are
+// and an empty optional string removes the field
+type deviceUpdate struct {
+	Name           *string
+	DisplayName    *string
+	Group          *string
+	Model          *string
+	TempOffset     *float64
+	HumidityOffset *float64
+}
+
+// configDevices returns the devices list of a config document
+func configDevices(doc *yaml.Node, path string) (*yaml.Node, error) {
+	devices := mappingValue(doc.Content[0], "devices")
+	if devices == nil || devices.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("no devices list in %s", path)
+	}
+	return devices, nil
+}
+
+// deviceIndex returns the position of the device with the given MAC in a devices list
+func deviceIndex(devices *yaml.Node, mac string) int {
+	for i, device := range devices.Content {
+		if device.Kind != yaml.MappingNode {
+			continue
+		}
+		if value := mappingValue(device, "mac"); value != nil && strings.EqualFold(value.Value, mac) {
+			return i
+		}
+	}
+	return -1
+}
+
+// updateDeviceInConfigFile changes the fields of the device with the given MAC in
+// the config file, keeping the rest of the file (including comments) intact
+func updateDeviceInConfigFile(path, mac string, update deviceUpdate) error {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	doc, mode, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	devices, err := configDevices(doc, path)
+	if err != nil {
+		return err
+	}
+	i := deviceIndex(devices, mac)
+	if i < 0 {
+		return fmt.Errorf("device %s not found in %s", mac, path)
+	}
+	device := devices.Content[i]
+
+	if update.Name != nil {
+		setMappingScalar(device, "name", stringNode(*update.Name, yaml.DoubleQuotedStyle))
+	}
+	for _, field := range []struct {
+		key   string
+		value *string
+	}{
+		{"displayName", update.DisplayName},
+		{"group", update.Group},
+		{"model", update.Model},
+	} {
+		switch {
+		case field.value == nil:
+		case *field.value == "":
+			deleteMappingKey(device, field.key)
+		default:
+			setMappingScalar(device, field.key, stringNode(*field.value, yaml.DoubleQuotedStyle))
+		}
+	}
+
+	if update.TempOffset != nil || update.HumidityOffset != nil {
+		offsets := ensureMappingValue(device, "offsets", yaml.MappingNode)
+		if offsets.Kind != yaml.MappingNode {
+			*offsets = yaml.Node{Kind: yaml.MappingNode}
+		}
+		if update.TempOffset != nil {
+			setMappingScalar(offsets, "temperature", floatNode(*update.TempOffset))
+		}
+		if update.HumidityOffset != nil {
+			setMappingScalar(offsets, "humidity", floatNode(*update.HumidityOffset))
+		}
+	}
+
+	return writeConfigDocument(path, doc, mode)
+}
+
+// removeDeviceFromConfigFile deletes the device with the given MAC from the
+// config file, keeping the rest of the file (including comments) intact
+func removeDeviceFromConfigFile(path, mac string) error {
+	configFileMu.Lock()
+	defer configFileMu.Unlock()
+
+	doc, mode, err := readConfigDocument(path)
+	if err != nil {
+		return err
+	}
+	devices, err := configDevices(doc, path)
+	if err != nil {
+		return err
+	}
+	i := deviceIndex(devices, mac)
+	if i < 0 {
+		return fmt.Errorf("device %s not found in %s", mac, path)
+	}
+	devices.Content = append(devices.Content[:i], devices.Content[i+1:]...)
+
+	return writeConfigDocument(path, doc, mode)
+}
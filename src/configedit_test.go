@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestAppendDeviceToConfigFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+	}{
+		{"No devices key", "server:\n  port: 8080 # HTTP port\n"},
+		{"Null devices", "devices:\n"},
+		{"Empty flow list", "devices: []\n"},
+		{"Existing devices", "devices:\n  - mac: \"AA:BB:CC:DD:EE:01\"\n    name: \"Office\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.original), 0o600); err != nil {
+				t.Fatalf("write config: %v", err)
+			}
+
+			device := Device{MAC: "A4:C1:38:00:00:01", Name: "Garage", Model: "H5074"}
+			device.Offsets.Temperature = -0.5
+			if err := appendDeviceToConfigFile(path, device); err != nil {
+				t.Fatalf("appendDeviceToConfigFile: %v", err)
+			}
+
+			// The result must decode through viper exactly like a hand-written file
+			v := viper.New()
+			v.SetConfigFile(path)
+			if err := v.ReadInConfig(); err != nil {
+				t.Fatalf("read back config: %v", err)
+			}
+			var config Config
+			if err := v.Unmarshal(&config); err != nil {
+				t.Fatalf("unmarshal config: %v", err)
+			}
+
+			last := config.Devices[len(config.Devices)-1]
+			if last.MAC != device.MAC || last.Name != device.Name || last.Model != "H5074" || last.Offsets.Temperature != -0.5 {
+				t.Errorf("appended device = %+v, want %+v", last, device)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat config: %v", err)
+			}
+			if info.Mode().Perm() != 0o600 {
+				t.Errorf("file mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			if strings.Contains(tt.original, "# HTTP port") {
+				data, _ := os.ReadFile(path)
+				if !strings.Contains(string(data), "# HTTP port") {
+					t.Errorf("comment lost:\n%s", data)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateDeviceOffsetsInConfigFile(t *testing.T) {
+	original := `devices:
+  - mac: "AA:BB:CC:DD:EE:01"
+    name: "Office"
+    offsets:
+      temperature: 0.0 # measured in 2024
+      humidity: 0.0
+  - mac: "AA:BB:CC:DD:EE:02"
+    name: "Attic"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	if err := updateDeviceOffsetsInConfigFile(path, map[string][2]float64{"Office": {-0.35, 2}, "Attic": {0.4, -1.25}}); err != nil {
+		t.Fatalf("updateDeviceOffsetsInConfigFile: %v", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("read back config: %v", err)
+	}
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	office, attic := config.Devices[0].Offsets, config.Devices[1].Offsets
+	if office.Temperature != -0.35 || office.Humidity != 2 {
+		t.Errorf("Office offsets = %+v, want -0.35/2", office)
+	}
+	if attic.Temperature != 0.4 || attic.Humidity != -1.25 {
+		t.Errorf("Attic offsets = %+v, want 0.4/-1.25", attic)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), "# measured in 2024") {
+		t.Errorf("comment was lost:\n%s", data)
+	}
+
+	if err := updateDeviceOffsetsInConfigFile(path, map[string][2]float64{"Cellar": {1, 1}}); err == nil {
+		t.Error("expected an error for an unknown device")
+	}
+}
+
+func TestUpdateAndRemoveDeviceInConfigFile(t *testing.T) {
+	original := `# Sensors
+devices:
+  - mac: "AA:BB:CC:DD:EE:01"
+    name: "Office" # by the window
+    group: "Upstairs"
+  - mac: "AA:BB:CC:DD:EE:02"
+    name: "Attic"
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(original), 0o640); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	name, group, model, offset := "Study", "", "H5075", 1.5
+	update := deviceUpdate{Name: &name, Group: &group, Model: &model, HumidityOffset: &offset}
+	if err := updateDeviceInConfigFile(path, "aa:bb:cc:dd:ee:01", update); err != nil {
+		t.Fatalf("updateDeviceInConfigFile: %v", err)
+	}
+	if err := removeDeviceFromConfigFile(path, "AA:BB:CC:DD:EE:02"); err != nil {
+		t.Fatalf("removeDeviceFromConfigFile: %v", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("read back config: %v", err)
+	}
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	if len(config.Devices) != 1 {
+		t.Fatalf("devices = %+v, want only Study", config.Devices)
+	}
+	device := config.Devices[0]
+	if device.Name != "Study" || device.Group != "" || device.Model != "H5075" || device.Offsets.Humidity != 1.5 {
+		t.Errorf("updated device = %+v", device)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, comment := range []string{"# Sensors", "# by the window"} {
+		if !strings.Contains(string(data), comment) {
+			t.Errorf("comment %q was lost:\n%s", comment, data)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o640 {
+		t.Errorf("file mode = %v (%v), want 0640", info.Mode().Perm(), err)
+	}
+	// The atomic write must not leave its temporary file behind
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only config.yaml", len(entries))
+	}
+
+	if err := removeDeviceFromConfigFile(path, "AA:BB:CC:DD:EE:02"); err == nil {
+		t.Error("expected an error for an unknown device")
+	}
+}
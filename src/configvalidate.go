@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	configLastReloadSuccessGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_last_reload_success",
+			Help: "Whether the last configuration reload was applied (1) or rejected (0)",
+		},
+	)
+
+	configLastReloadTimestampGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "config_last_reload_timestamp",
+			Help: "Unix time of the last configuration reload attempt",
+		},
+	)
+)
+
+// macPattern matches a colon-separated Bluetooth address
+var macPattern = regexp.MustCompile(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`)
+
+// configErrors lists every problem found in a configuration
+type configErrors []string
+
+func (e configErrors) Error() string {
+	if len(e) == 1 {
+		return e[0]
+	}
+	return fmt.Sprintf("%d problems:\n  - %s", len(e), strings.Join(e, "\n  - "))
+}
+
+// recordConfigReload exports the outcome of a configuration load
+func recordConfigReload(success bool, now time.Time) {
+	value := 0.0
+	if success {
+		value = 1
+	}
+	configLastReloadSuccessGauge.Set(value)
+	configLastReloadTimestampGauge.Set(float64(now.UnixNano()) / 1e9)
+}
+
+// validateConfig checks a decoded configuration for mistakes that applying it
+// would otherwise silently correct or skip. It returns a configErrors listing
+// all of them, or nil.
+func validateConfig(config *Config) error {
+	var problems configErrors
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(config.Server.Port); err != nil || port < 1 || port > 65535 {
+		add("server.port '%s' is not a port number", config.Server.Port)
+	}
+
+	for _, d := range []struct{ key, value string }{
+		{"bluetooth.scanInterval", config.Bluetooth.ScanInterval},
+		{"bluetooth.scanDuration", config.Bluetooth.ScanDuration},
+		{"metrics.refreshInterval", config.Metrics.RefreshInterval},
+		{"metrics.staleThreshold", config.Metrics.StaleThreshold},
+		{"openmeteo.interval", config.OpenMeteo.Interval},
+		{"history.resolution", config.History.Resolution},
+		{"history.retention", config.History.Retention},
+	} {
+		if v, err := time.ParseDuration(d.value); err != nil || v <= 0 {
+			add("%s '%s' is not a positive duration", d.key, d.value)
+		}
+	}
+	validateStaleness(add, "metrics", "", config.Metrics.StaleGracePeriod, config.Metrics.StalePolicy, config.Metrics.StaleMisses)
+
+	if lat := config.OpenMeteo.Latitude; lat < -90 || lat > 90 {
+		add("openmeteo.latitude %g is outside -90..90", lat)
+	}
+	if lon := config.OpenMeteo.Longitude; lon < -180 || lon > 180 {
+		add("openmeteo.longitude %g is outside -180..180", lon)
+	}
+
+	validateLabels(add, "global", config.Labels)
+
+	global := globalThresholds(config)
+	validateThresholds(add, "thresholds", global)
+	validateFilters(add, "filters", config.Filters)
+
+	groups := make(map[string]ThresholdOverrides, len(config.Groups))
+	for i, group := range config.Groups {
+		switch _, dup := groups[group.Name]; {
+		case group.Name == "":
+			add("groups[%d] has no name", i)
+			continue
+		case dup:
+			add("group '%s' is configured more than once", group.Name)
+		}
+		if problem := groupNameProblem(group.Name); problem != "" {
+			add("group '%s' %s", group.Name, problem)
+		}
+		groups[group.Name] = group.Thresholds
+	}
+	// Nested groups inherit from their parents, which may be listed after them
+	for _, group := range config.Groups {
+		if group.Name != "" {
+			validateThresholds(add, "group '"+group.Name+"' thresholds", resolveGroupThresholds(global, groups, group.Name))
+		}
+	}
+
+	names := make(map[string]bool)
+	macs := make(map[string]bool)
+	for i, device := range config.Devices {
+		context := fmt.Sprintf("devices[%d]", i)
+		if device.Name != "" {
+			context = "device '" + device.Name + "'"
+		}
+
+		switch {
+		case device.Name == "":
+			add("%s has no name", context)
+		case names[device.Name]:
+			add("device name '%s' is used more than once", device.Name)
+		}
+		names[device.Name] = true
+
+		mac := strings.ToUpper(device.MAC)
+		switch {
+		case mac == "":
+			add("%s has no mac", context)
+		case !macPattern.MatchString(mac):
+			add("%s has malformed mac '%s'", context, device.MAC)
+		case macs[mac]:
+			add("mac %s is used by more than one device", mac)
+		}
+		macs[mac] = true
+
+		if device.Group != "" {
+			if problem := groupNameProblem(device.Group); problem != "" {
+				add("%s group '%s' %s", context, device.Group, problem)
+			}
+		}
+		if device.Model != "" && !isSupportedModel(device.Model) {
+			add("%s has unsupported model '%s'", context, device.Model)
+		}
+		if _, err := compileCalibration(device.Calibration.Temperature); err != nil {
+			add("%s temperature calibration: %v", context, err)
+		}
+		if _, err := compileCalibration(device.Calibration.Humidity); err != nil {
+			add("%s humidity calibration: %v", context, err)
+		}
+		if device.Filters != nil {
+			validateFilters(add, context+" filters", *device.Filters)
+		}
+		misses := 0
+		if device.StaleMisses != nil {
+			misses = *device.StaleMisses
+		}
+		validateStaleness(add, context, device.StaleThreshold, device.StaleGracePeriod, device.StalePolicy, misses)
+		validateLabels(add, context, device.Labels)
+		if device.Group != "" || device.Thresholds != (ThresholdOverrides{}) {
+			validateThresholds(add, context+" thresholds", resolveThresholds(global, groups, device))
+		}
+	}
+
+	validateVirtualDevices(add, config, global, groups, names)
+
+	rules := make(map[string]bool)
+	for _, rule := range config.Alerts.Rules {
+		if _, err := compileAlertRule(rule); err != nil {
+			add("alert %v", err)
+		} else if rules[rule.Name] {
+			add("alert rule '%s' is configured more than once", rule.Name)
+		}
+		rules[rule.Name] = true
+	}
+	for _, webhook := range config.Alerts.Webhooks {
+		if _, err := compileAlertWebhook(webhook); err != nil {
+			add("alert %v", err)
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// validateVirtualDevices checks the virtual devices against the sensors in
+// names, which their expressions may refer to
+func validateVirtualDevices(add func(string, ...interface{}), config *Config, global Thresholds, groups map[string]ThresholdOverrides, names map[string]bool) {
+	virtual := make(map[string]bool, len(config.VirtualDevices))
+	for _, device := range config.VirtualDevices {
+		virtual[device.Name] = true
+	}
+	if names[openMeteoInput] || virtual[openMeteoInput] {
+		add("device name '%s' is reserved for Open-Meteo in virtual device expressions", openMeteoInput)
+	}
+
+	seen := make(map[string]bool, len(config.VirtualDevices))
+	for i, device := range config.VirtualDevices {
+		context := fmt.Sprintf("virtualDevices[%d]", i)
+		if device.Name != "" {
+			context = "virtual device '" + device.Name + "'"
+		}
+
+		switch {
+		case device.Name == "":
+			add("%s has no name", context)
+		case names[device.Name] || seen[device.Name]:
+			add("device name '%s' is used more than once", device.Name)
+		}
+		seen[device.Name] = true
+
+		sensor, err := compileVirtualDevice(device)
+		if err != nil {
+			add("%s %v", context, err)
+		} else {
+			for input := range sensor.inputs {
+				switch {
+				case virtual[input]:
+					add("%s refers to virtual device '%s'; expressions can only use sensors and %s", context, input, openMeteoInput)
+				case !names[input] && input != openMeteoInput:
+					add("%s refers to unknown device '%s'", context, input)
+				}
+			}
+		}
+
+		if device.Group != "" {
+			if problem := groupNameProblem(device.Group); problem != "" {
+				add("%s group '%s' %s", context, device.Group, problem)
+			}
+		}
+		validateLabels(add, context, device.Labels)
+		if device.Group != "" || device.Thresholds != (ThresholdOverrides{}) {
+			validateThresholds(add, context+" thresholds", resolveThresholds(global, groups, Device{Group: device.Group, Thresholds: device.Thresholds}))
+		}
+	}
+}
+
+// validateStaleness checks the optional staleness settings of the metrics block or a device
+func validateStaleness(add func(string, ...interface{}), context, threshold, gracePeriod, policy string, misses int) {
+	if threshold != "" {
+		if d, err := time.ParseDuration(threshold); err != nil || d <= 0 {
+			add("%s staleThreshold '%s' is not a positive duration", context, threshold)
+		}
+	}
+	if _, err := optionalDuration(gracePeriod); err != nil {
+		add("%s staleGracePeriod '%s' is not a duration", context, gracePeriod)
+	}
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", stalePolicyDelete, stalePolicyKeep, stalePolicyNaN:
+	default:
+		add("%s has unknown stalePolicy '%s'", context, policy)
+	}
+	if misses < 0 {
+		add("%s staleMisses %d is negative", context, misses)
+	}
+}
+
+// validateThresholds rejects inverted threshold pairs
+func validateThresholds(add func(string, ...interface{}), context string, t Thresholds) {
+	if t.TemperatureMin >= t.TemperatureMax {
+		add("%s: temperature min %g is not below max %g", context, t.TemperatureMin, t.TemperatureMax)
+	}
+	if t.TemperatureLow > t.TemperatureHigh {
+		add("%s: temperature low %g is above high %g", context, t.TemperatureLow, t.TemperatureHigh)
+	}
+	if t.HumidityLow > t.HumidityHigh {
+		add("%s: humidity low %g is above high %g", context, t.HumidityLow, t.HumidityHigh)
+	}
+}
+
+// validateFilters rejects the filter settings compileFilterConfig would disable
+func validateFilters(add func(string, ...interface{}), context string, f FilterConfig) {
+	if f.MaxRate.Temperature < 0 || f.MaxRate.Humidity < 0 {
+		add("%s: maxRate must not be negative", context)
+	}
+	if f.Median < 0 || f.Median > maxMedianWindow {
+		add("%s: median must be between 0 and %d", context, maxMedianWindow)
+	}
+	if f.EMA < 0 || f.EMA > 1 {
+		add("%s: ema must be between 0 and 1", context)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+)
+
+// validTestConfig loads the defaults plus one device
+func validTestConfig(t *testing.T) *Config {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	if err := os.WriteFile("config.yaml", []byte("devices:\n  - mac: \"A4:C1:38:00:00:01\"\n    name: Office\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := initConfig()
+	if err != nil {
+		t.Fatalf("initConfig: %v", err)
+	}
+	return config
+}
+
+func TestValidateConfig(t *testing.T) {
+	if err := validateConfig(validTestConfig(t)); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+
+	misses := -1
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		want   string
+	}{
+		{"bad port", func(c *Config) { c.Server.Port = "http" }, "server.port"},
+		{"bad duration", func(c *Config) { c.Bluetooth.ScanInterval = "15" }, "bluetooth.scanInterval"},
+		{"zero duration", func(c *Config) { c.Metrics.RefreshInterval = "0s" }, "metrics.refreshInterval"},
+		{"latitude", func(c *Config) { c.OpenMeteo.Latitude = 91 }, "openmeteo.latitude"},
+		{"longitude", func(c *Config) { c.OpenMeteo.Longitude = -181 }, "openmeteo.longitude"},
+		{"inverted thresholds", func(c *Config) { c.Thresholds.Humidity.Low = 80 }, "humidity low 80 is above high 70"},
+		{"inverted group thresholds", func(c *Config) {
+			low := 50.0
+			c.Groups = []Group{{Name: "Cellar"}}
+			c.Groups[0].Thresholds.Temperature.Low = &low
+		}, "group 'Cellar' thresholds"},
+		{"inverted nested group thresholds", func(c *Config) {
+			low, high := 50.0, 40.0
+			c.Groups = []Group{{Name: "House/Cellar"}, {Name: "House"}}
+			c.Groups[0].Thresholds.Temperature.Low = &low
+			c.Groups[1].Thresholds.Temperature.High = &high
+		}, "group 'House/Cellar' thresholds"},
+		{"empty group level", func(c *Config) { c.Devices[0].Group = "House//Upstairs" }, "group 'House//Upstairs' has an empty level"},
+		{"missing mac", func(c *Config) { c.Devices = append(c.Devices, Device{Name: "Attic"}) }, "device 'Attic' has no mac"},
+		{"missing name", func(c *Config) { c.Devices = append(c.Devices, Device{MAC: "A4:C1:38:00:00:02"}) }, "devices[1] has no name"},
+		{"malformed mac", func(c *Config) { c.Devices[0].MAC = "A4-C1-38-00-00-01" }, "malformed mac"},
+		{"duplicate mac", func(c *Config) {
+			c.Devices = append(c.Devices, Device{MAC: "a4:c1:38:00:00:01", Name: "Attic"})
+		}, "mac A4:C1:38:00:00:01 is used by more than one device"},
+		{"duplicate name", func(c *Config) {
+			c.Devices = append(c.Devices, Device{MAC: "A4:C1:38:00:00:02", Name: "Office"})
+		}, "device name 'Office' is used more than once"},
+		{"device stale threshold", func(c *Config) { c.Devices[0].StaleThreshold = "soon" }, "staleThreshold 'soon'"},
+		{"device stale misses", func(c *Config) { c.Devices[0].StaleMisses = &misses }, "staleMisses -1"},
+		{"stale policy", func(c *Config) { c.Metrics.StalePolicy = "forget" }, "stalePolicy 'forget'"},
+		{"filters", func(c *Config) { c.Filters.EMA = 2 }, "ema must be between 0 and 1"},
+		{"alert rule", func(c *Config) { c.Alerts.Rules = []AlertRule{{Name: "Hot", Metric: "pressure"}} }, "unknown metric"},
+		{"global label", func(c *Config) { c.Labels = map[string]string{"room-type": "office"} }, "global label 'room-type' is not a valid label name"},
+		{"reserved label", func(c *Config) { c.Devices[0].Labels = map[string]string{"group": "B2"} }, "label 'group' is reserved"},
+		{"virtual expression", func(c *Config) {
+			c.VirtualDevices = []VirtualDevice{{Name: "Indoor", Expression: "avg(Office"}}
+		}, "virtual device 'Indoor' temperature expression: unexpected end"},
+		{"virtual unknown device", func(c *Config) {
+			c.VirtualDevices = []VirtualDevice{{Name: "Indoor", Expression: "avg(Office, Attic)"}}
+		}, "virtual device 'Indoor' refers to unknown device 'Attic'"},
+		{"virtual of virtual", func(c *Config) {
+			c.VirtualDevices = []VirtualDevice{{Name: "Indoor", Expression: "Office"}, {Name: "Delta", Expression: "Indoor - openmeteo"}}
+		}, "refers to virtual device 'Indoor'"},
+		{"virtual duplicate name", func(c *Config) {
+			c.VirtualDevices = []VirtualDevice{{Name: "Office", Expression: "Office + 1"}}
+		}, "device name 'Office' is used more than once"},
+		{"reserved openmeteo name", func(c *Config) { c.Devices[0].Name = "openmeteo" }, "reserved for Open-Meteo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := validTestConfig(t)
+			tt.modify(config)
+			err := validateConfig(config)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validateConfig() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	// Every problem is reported, not just the first
+	config := validTestConfig(t)
+	config.Server.Port = "0"
+	config.Devices[0].MAC = ""
+	if err, ok := validateConfig(config).(configErrors); !ok || len(err) != 2 {
+		t.Errorf("validateConfig() = %v, want 2 problems", err)
+	}
+}
+
+func TestReloadConfigRejectsInvalidConfig(t *testing.T) {
+	validTestConfig(t)
+
+	if !reloadConfig(nil) {
+		t.Fatal("reloadConfig rejected a valid config")
+	}
+	if got := testutil.ToFloat64(configLastReloadSuccessGauge); got != 1 {
+		t.Errorf("config_last_reload_success = %v, want 1", got)
+	}
+	applied := testutil.ToFloat64(configLastReloadTimestampGauge)
+
+	// A duplicate MAC rejects the whole file
+	yaml := "devices:\n  - mac: \"A4:C1:38:00:00:01\"\n    name: Office\n  - mac: \"A4:C1:38:00:00:01\"\n    name: Attic\n"
+	if err := os.WriteFile("config.yaml", []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if reloadConfig(func(*Config) { t.Error("onReload called for an invalid config") }) {
+		t.Error("reloadConfig accepted a duplicate MAC")
+	}
+	if got := testutil.ToFloat64(configLastReloadSuccessGauge); got != 0 {
+		t.Errorf("config_last_reload_success = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(configLastReloadTimestampGauge); got < applied {
+		t.Errorf("config_last_reload_timestamp = %v, want at least %v", got, applied)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Manufacturer (company) IDs used by the supported Govee thermo-hygrometers
+const (
+	goveeH5101ManufacturerID = uint16(0x0001)
+	goveeH5179ManufacturerID = uint16(0x8801)
+)
+
+// defaultModel is the decoder used when a device's model is neither configured nor detected
+const defaultModel = "H5075"
+
+// Reading is a single decoded temperature/humidity/battery sample, before calibration
+type Reading struct {
+	Temperature float64 `json:"temperature"`
+	Humidity    float64 `json:"humidity"`
+	Battery     int     `json:"battery"`
+}
+
+// AdvertisementDecoder decodes the manufacturer data of a family of Govee sensors
+type AdvertisementDecoder interface {
+	// ManufacturerID is the BLE company ID the sensor advertises its readings under
+	ManufacturerID() uint16
+	// Length is the usual payload length, used to tell models apart when the
+	// same company ID is shared and the local name is unavailable
+	Length() int
+	// Decode extracts a reading from the manufacturer data payload
+	Decode(data []byte) (Reading, error)
+}
+
+// packedDecoder handles models that pack temperature and humidity into a single
+// 3-byte big-endian integer (H5072, H5075, H5101, H5102, H5177)
+type packedDecoder struct {
+	companyID uint16
+	offset    int // index of the first packed byte; battery follows the packed value
+	length    int
+}
+
+func (d packedDecoder) ManufacturerID() uint16 { return d.companyID }
+func (d packedDecoder) Length() int            { return d.length }
+
+func (d packedDecoder) Decode(data []byte) (Reading, error) {
+	if len(data) < d.offset+4 {
+		return Reading{}, fmt.Errorf("invalid data length %d", len(data))
+	}
+
+	packed := data[d.offset : d.offset+3]
+	if packed[0] == 0 && packed[1] == 0 && packed[2] == 0 {
+		return Reading{}, fmt.Errorf("zero readings")
+	}
+
+	// Extract the 3-byte temperature/humidity raw value (Big Endian)
+	raw := uint32(packed[0])<<16 | uint32(packed[1])<<8 | uint32(packed[2])
+
+	// Handle negative temperatures (if the highest bit is set)
+	isNegative := raw&0x800000 != 0
+	raw &^= 0x800000
+
+	temperature := float64(int(raw/1000)) / 10.0
+	if isNegative {
+		temperature = -temperature
+	}
+
+	return Reading{
+		Temperature: temperature,
+		Humidity:    float64(raw%1000) / 10.0,
+		Battery:     int(data[d.offset+3]),
+	}, nil
+}
+
+// littleEndianDecoder handles models that send a signed 16-bit temperature and an
+// unsigned 16-bit humidity, both in hundredths and little-endian, followed by
+// the battery level (H5074, H5179)
+type littleEndianDecoder struct {
+	companyID uint16
+	offset    int // index of the first temperature byte
+	length    int
+}
+
+func (d littleEndianDecoder) ManufacturerID() uint16 { return d.companyID }
+func (d littleEndianDecoder) Length() int            { return d.length }
+
+func (d littleEndianDecoder) Decode(data []byte) (Reading, error) {
+	if len(data) < d.offset+5 {
+		return Reading{}, fmt.Errorf("invalid data length %d", len(data))
+	}
+
+	fields := data[d.offset : d.offset+5]
+	rawTemp := int16(binary.LittleEndian.Uint16(fields[0:2]))
+	rawHumidity := binary.LittleEndian.Uint16(fields[2:4])
+	if rawTemp == 0 && rawHumidity == 0 {
+		return Reading{}, fmt.Errorf("zero readings")
+	}
+
+	return Reading{
+		Temperature: float64(rawTemp) / 100.0,
+		Humidity:    float64(rawHumidity) / 100.0,
+		Battery:     int(fields[4]),
+	}, nil
+}
+
+var (
+	// advertisementDecoders maps a model name (e.g. "H5075") to its decoder
+	advertisementDecoders = make(map[string]AdvertisementDecoder)
+	// decodersByManufacturer lists decoders per company ID in registration order
+	decodersByManufacturer = make(map[uint16][]AdvertisementDecoder)
+	// decoderModels records the primary (first registered) model of each decoder
+	decoderModels = make(map[AdvertisementDecoder]string)
+
+	modelPattern = regexp.MustCompile(`H5\d{3}`)
+)
+
+func init() {
+	// H5075 is registered first so it stays the fallback for 0xEC88 payloads
+	registerDecoder(packedDecoder{companyID: goveeManufacturerID, offset: 1, length: 6}, "H5075", "H5072")
+	registerDecoder(littleEndianDecoder{companyID: goveeManufacturerID, offset: 1, length: 9}, "H5074")
+	registerDecoder(packedDecoder{companyID: goveeH5101ManufacturerID, offset: 2, length: 6}, "H5101", "H5102", "H5177")
+	registerDecoder(littleEndianDecoder{companyID: goveeH5179ManufacturerID, offset: 4, length: 9}, "H5179")
+}
+
+// registerDecoder makes a decoder available under one or more model names
+func registerDecoder(decoder AdvertisementDecoder, models ...string) {
+	for _, model := range models {
+		advertisementDecoders[model] = decoder
+	}
+	if len(models) > 0 {
+		decoderModels[decoder] = models[0]
+	}
+	decodersByManufacturer[decoder.ManufacturerID()] = append(decodersByManufacturer[decoder.ManufacturerID()], decoder)
+}
+
+// normalizeModel turns user or advertised spellings such as "h5075", "GVH5075"
+// or "Govee_H5075_1A2B" into the canonical model name, or "" if none is found
+func normalizeModel(s string) string {
+	return modelPattern.FindString(strings.ToUpper(s))
+}
+
+// isSupportedModel reports whether a decoder is registered for the model
+func isSupportedModel(model string) bool {
+	_, ok := advertisementDecoders[normalizeModel(model)]
+	return ok
+}
+
+// resolveDecoder picks the decoder for an advertisement. A configured model wins,
+// then the model found in the advertised local name, then the decoder registered
+// for the company ID whose usual payload length matches. It returns the resolved
+// model name alongside the decoder, or a nil decoder if nothing applies.
+func resolveDecoder(configuredModel, localName string, companyID uint16, dataLength int) (string, AdvertisementDecoder) {
+	for _, candidate := range []string{configuredModel, localName} {
+		model := normalizeModel(candidate)
+		if decoder, ok := advertisementDecoders[model]; ok {
+			if decoder.ManufacturerID() != companyID {
+				return "", nil
+			}
+			return model, decoder
+		}
+	}
+
+	candidates := decodersByManufacturer[companyID]
+	if len(candidates) == 0 {
+		return "", nil
+	}
+	selected := candidates[0]
+	for _, decoder := range candidates {
+		if decoder.Length() == dataLength {
+			selected = decoder
+			break
+		}
+	}
+	return decoderModels[selected], selected
+}
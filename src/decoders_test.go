@@ -0,0 +1,159 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAdvertisementDecoders(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		data     []byte
+		wantTemp float64
+		wantHum  float64
+		wantBat  int
+		wantErr  bool
+	}{
+		{
+			name:     "H5075 packed positive",
+			model:    "H5075",
+			data:     []byte{0x00, 0x01, 0x56, 0x32, 0x64, 0x00}, // 8.7°C, 60.2%, 100%
+			wantTemp: 8.7,
+			wantHum:  60.2,
+			wantBat:  100,
+		},
+		{
+			name:     "H5072 packed negative",
+			model:    "H5072",
+			data:     []byte{0x00, 0x80, 0x04, 0x40, 0x32, 0x00}, // -0.1°C, 8.8%, 50%
+			wantTemp: -0.1,
+			wantHum:  8.8,
+			wantBat:  50,
+		},
+		{
+			name:     "H5074 little endian",
+			model:    "H5074",
+			data:     []byte{0x00, 0x29, 0x09, 0xBF, 0x15, 0x5A, 0x02, 0x00, 0x00}, // 23.45°C, 55.67%, 90%
+			wantTemp: 23.45,
+			wantHum:  55.67,
+			wantBat:  90,
+		},
+		{
+			name:     "H5074 negative temperature",
+			model:    "H5074",
+			data:     []byte{0x00, 0x00, 0xFE, 0x88, 0x13, 0x40, 0x02, 0x00, 0x00}, // -5.12°C, 50.00%, 64%
+			wantTemp: -5.12,
+			wantHum:  50.0,
+			wantBat:  64,
+		},
+		{
+			name:     "H5102 packed with offset 2",
+			model:    "H5102",
+			data:     []byte{0x01, 0x01, 0x01, 0x56, 0x32, 0x64}, // 8.7°C, 60.2%, 100%
+			wantTemp: 8.7,
+			wantHum:  60.2,
+			wantBat:  100,
+		},
+		{
+			name:     "H5179 little endian with offset 4",
+			model:    "H5179",
+			data:     []byte{0x01, 0x00, 0x01, 0x01, 0x29, 0x09, 0xBF, 0x15, 0x5A}, // 23.45°C, 55.67%, 90%
+			wantTemp: 23.45,
+			wantHum:  55.67,
+			wantBat:  90,
+		},
+		{
+			name:    "Short payload",
+			model:   "H5179",
+			data:    []byte{0x01, 0x00, 0x01},
+			wantErr: true,
+		},
+		{
+			name:    "Zero readings",
+			model:   "H5177",
+			data:    []byte{0x01, 0x01, 0x00, 0x00, 0x00, 0x64},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoder, ok := advertisementDecoders[tt.model]
+			if !ok {
+				t.Fatalf("no decoder registered for %s", tt.model)
+			}
+
+			reading, err := decoder.Decode(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got reading %+v", reading)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+
+			if math.Abs(reading.Temperature-tt.wantTemp) > 1e-9 {
+				t.Errorf("temperature = %v, want %v", reading.Temperature, tt.wantTemp)
+			}
+			if math.Abs(reading.Humidity-tt.wantHum) > 1e-9 {
+				t.Errorf("humidity = %v, want %v", reading.Humidity, tt.wantHum)
+			}
+			if reading.Battery != tt.wantBat {
+				t.Errorf("battery = %v, want %v", reading.Battery, tt.wantBat)
+			}
+		})
+	}
+}
+
+func TestResolveDecoder(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		localName  string
+		companyID  uint16
+		dataLength int
+		wantModel  string
+	}{
+		{"Configured model wins over local name", "h5074", "GVH5075_1A2B", goveeManufacturerID, 6, "H5074"},
+		{"Detected from local name", "", "GVH5072_1A2B", goveeManufacturerID, 6, "H5072"},
+		{"Detected from Govee_ prefixed name", "", "Govee_H5179_C0FF", goveeH5179ManufacturerID, 9, "H5179"},
+		{"Fallback by payload length", "", "", goveeManufacturerID, 9, "H5074"},
+		{"Fallback to first registered decoder", "", "", goveeManufacturerID, 7, "H5075"},
+		{"Fallback for H5101 family", "", "", goveeH5101ManufacturerID, 6, "H5101"},
+		{"Company ID mismatch", "H5075", "", goveeH5179ManufacturerID, 9, ""},
+		{"Unknown company ID", "", "", 0x004C, 23, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, decoder := resolveDecoder(tt.configured, tt.localName, tt.companyID, tt.dataLength)
+			if model != tt.wantModel {
+				t.Errorf("model = %q, want %q", model, tt.wantModel)
+			}
+			if (decoder == nil) != (tt.wantModel == "") {
+				t.Errorf("decoder = %v, want nil: %v", decoder, tt.wantModel == "")
+			}
+		})
+	}
+}
+
+func TestNormalizeModel(t *testing.T) {
+	tests := map[string]string{
+		"H5075":            "H5075",
+		"h5179":            "H5179",
+		"GVH5102_ABCD":     "H5102",
+		"Govee_H5074_1234": "H5074",
+		"ihoment_H5177":    "H5177",
+		"Unknown":          "",
+		"":                 "",
+	}
+
+	for input, want := range tests {
+		if got := normalizeModel(input); got != want {
+			t.Errorf("normalizeModel(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
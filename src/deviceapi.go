@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// deviceRequest is the body accepted by POST /api/devices and PATCH
+// /api/devices/{name}. On PATCH omitted fields are left as they are, and an
+// empty displayName, group or model removes the setting.
+type deviceRequest struct {
+	MAC         *string `json:"mac"`
+	Name        *string `json:"name"`
+	DisplayName *string `json:"displayName"`
+	Group       *string `json:"group"`
+	Model       *string `json:"model"`
+	Offsets     *struct {
+		Temperature *float64 `json:"temperature"`
+		Humidity    *float64 `json:"humidity"`
+	} `json:"offsets"`
+}
+
+// deviceEditMu serializes device edits from validation through the reload, so
+// each edit is validated against the configuration the previous one produced
+var deviceEditMu sync.Mutex
+
+// authorizeDeviceEdit checks the bearer token of a device management request.
+// Without server.apiToken the API is read-only.
+func authorizeDeviceEdit(w http.ResponseWriter, r *http.Request) bool {
+	token := liveConfig().Server.APIToken
+	if token == "" {
+		http.Error(w, "Device management is disabled; set server.apiToken to enable it", http.StatusForbidden)
+		return false
+	}
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="govee"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// decodeStrictJSON decodes a request body into v, rejecting unknown fields so a
+// typo such as "grop" is an error rather than silently ignored
+func decodeStrictJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		http.Error(w, "Invalid JSON body: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// decodeDeviceRequest reads a deviceRequest body, trimming its strings
+func decodeDeviceRequest(w http.ResponseWriter, r *http.Request) (deviceRequest, bool) {
+	var req deviceRequest
+	if !decodeStrictJSON(w, r, &req) {
+		return req, false
+	}
+	for _, field := range []*string{req.MAC, req.Name, req.DisplayName, req.Group, req.Model} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	if req.MAC != nil {
+		*req.MAC = strings.ToUpper(*req.MAC)
+	}
+	if req.Model != nil && isSupportedModel(*req.Model) {
+		*req.Model = normalizeModel(*req.Model)
+	}
+	return req, true
+}
+
+// configuredDevice returns the index of the device with the given name in the live config
+func configuredDevice(config *Config, name string) int {
+	for i, device := range config.Devices {
+		if device.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateDeviceEdit checks the live configuration with its devices replaced,
+// the same way a reload would
+func validateDeviceEdit(w http.ResponseWriter, config *Config, devices []Device) bool {
+	candidate := *config
+	candidate.Devices = devices
+	if err := validateConfig(&candidate); err != nil {
+		http.Error(w, "Invalid device: "+err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// applyDeviceEdit applies a written config file right away, so the response
+// reflects the change; the watcher then skips the file as already applied
+func applyDeviceEdit(w http.ResponseWriter) bool {
+	if !reloadConfig(configApplier) {
+		http.Error(w, "Config was written but could not be applied; see the log", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// writeDevice responds with the active device with the given MAC
+func writeDevice(w http.ResponseWriter, status int, mac string) {
+	for _, device := range snapshotDevices() {
+		if strings.EqualFold(device.MAC, mac) {
+			writeJSON(w, status, device)
+			return
+		}
+	}
+	http.Error(w, "Device "+mac+" was saved but is not active", http.StatusInternalServerError)
+}
+
+// createDevice serves POST /api/devices, adding a device to config.yaml
+func createDevice(w http.ResponseWriter, r *http.Request) {
+	if !authorizeDeviceEdit(w, r) {
+		return
+	}
+	req, ok := decodeDeviceRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.MAC == nil || *req.MAC == "" || req.Name == nil || *req.Name == "" {
+		http.Error(w, "Both mac and name are required", http.StatusBadRequest)
+		return
+	}
+
+	device := Device{MAC: *req.MAC, Name: *req.Name}
+	for _, field := range []struct{ value, target *string }{
+		{req.DisplayName, &device.DisplayName},
+		{req.Group, &device.Group},
+		{req.Model, &device.Model},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	if req.Offsets != nil && req.Offsets.Temperature != nil {
+		device.Offsets.Temperature = *req.Offsets.Temperature
+	}
+	if req.Offsets != nil && req.Offsets.Humidity != nil {
+		device.Offsets.Humidity = *req.Offsets.Humidity
+	}
+
+	deviceEditMu.Lock()
+	defer deviceEditMu.Unlock()
+
+	config := liveConfig()
+	if configuredDevice(config, device.Name) >= 0 {
+		http.Error(w, "A device named "+device.Name+" is already configured", http.StatusConflict)
+		return
+	}
+	if _, known := devicesByMAC(config.Devices)[device.MAC]; known {
+		http.Error(w, "Device "+device.MAC+" is already configured", http.StatusConflict)
+		return
+	}
+	devices := append(append([]Device{}, config.Devices...), device)
+	if !validateDeviceEdit(w, config, devices) {
+		return
+	}
+
+	if err := appendDeviceToConfigFile(configFilePath, device); err != nil {
+		log.Printf("Failed to add device %s: %v", device.MAC, err)
+		http.Error(w, "Failed to update config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Device API: Added device %s as '%s' to %s", device.MAC, device.Name, configFilePath)
+	if applyDeviceEdit(w) {
+		writeDevice(w, http.StatusCreated, device.MAC)
+	}
+}
+
+// updateDevice serves PATCH /api/devices/{name}, renaming, regrouping or
+// recalibrating a device in config.yaml
+func updateDevice(w http.ResponseWriter, r *http.Request) {
+	if !authorizeDeviceEdit(w, r) {
+		return
+	}
+	req, ok := decodeDeviceRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deviceEditMu.Lock()
+	defer deviceEditMu.Unlock()
+
+	name := r.PathValue("name")
+	config := liveConfig()
+	i := configuredDevice(config, name)
+	if i < 0 {
+		http.Error(w, "Unknown device "+name, http.StatusNotFound)
+		return
+	}
+	devices := append([]Device{}, config.Devices...)
+	device := &devices[i]
+	if req.MAC != nil && !strings.EqualFold(*req.MAC, device.MAC) {
+		http.Error(w, "The mac of a device cannot be changed; delete it and add the new one", http.StatusBadRequest)
+		return
+	}
+
+	update := deviceUpdate{Name: req.Name, DisplayName: req.DisplayName, Group: req.Group, Model: req.Model}
+	if req.Name != nil {
+		if *req.Name != name && configuredDevice(config, *req.Name) >= 0 {
+			http.Error(w, "A device named "+*req.Name+" is already configured", http.StatusConflict)
+			return
+		}
+		device.Name = *req.Name
+	}
+	for _, field := range []struct{ value, target *string }{
+		{req.DisplayName, &device.DisplayName},
+		{req.Group, &device.Group},
+		{req.Model, &device.Model},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	if req.Offsets != nil {
+		update.TempOffset, update.HumidityOffset = req.Offsets.Temperature, req.Offsets.Humidity
+		if update.TempOffset != nil {
+			device.Offsets.Temperature = *update.TempOffset
+		}
+		if update.HumidityOffset != nil {
+			device.Offsets.Humidity = *update.HumidityOffset
+		}
+	}
+	if !validateDeviceEdit(w, config, devices) {
+		return
+	}
+
+	if err := updateDeviceInConfigFile(configFilePath, device.MAC, update); err != nil {
+		log.Printf("Failed to update device '%s': %v", name, err)
+		http.Error(w, "Failed to update config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Device API: Updated device '%s' (%s) in %s", device.Name, device.MAC, configFilePath)
+	if applyDeviceEdit(w) {
+		writeDevice(w, http.StatusOK, device.MAC)
+	}
+}
+
+// deleteDevice serves DELETE /api/devices/{name}, removing a device from config.yaml
+func deleteDevice(w http.ResponseWriter, r *http.Request) {
+	if !authorizeDeviceEdit(w, r) {
+		return
+	}
+
+	deviceEditMu.Lock()
+	defer deviceEditMu.Unlock()
+
+	name := r.PathValue("name")
+	config := liveConfig()
+	i := configuredDevice(config, name)
+	if i < 0 {
+		http.Error(w, "Unknown device "+name, http.StatusNotFound)
+		return
+	}
+	mac := config.Devices[i].MAC
+	devices := append(append([]Device{}, config.Devices[:i]...), config.Devices[i+1:]...)
+	if !validateDeviceEdit(w, config, devices) {
+		return
+	}
+
+	if err := removeDeviceFromConfigFile(configFilePath, mac); err != nil {
+		log.Printf("Failed to delete device '%s': %v", name, err)
+		http.Error(w, "Failed to update config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Device API: Deleted device '%s' (%s) from %s", name, mac, configFilePath)
+	if applyDeviceEdit(w) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
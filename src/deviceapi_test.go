@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const deviceAPITestConfig = `server:
+  apiToken: "s3cret"
+# Sensors
+devices:
+  - mac: "AA:BB:CC:DD:EE:01"
+    name: "Office" # by the window
+    group: "Upstairs"
+`
+
+// setupDeviceAPI loads config.yaml from a temporary directory and applies edits
+// the way main does
+func setupDeviceAPI(t *testing.T, yaml string) *http.ServeMux {
+	t.Helper()
+	resetState()
+	t.Cleanup(resetState)
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	if err := os.WriteFile("config.yaml", []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, _, err := initConfig()
+	if err != nil {
+		t.Fatalf("initConfig: %v", err)
+	}
+	withCurrentConfig(t, config)
+	loadKnownGovees(config)
+
+	orig := configApplier
+	configApplier = func(c *Config) {
+		loadKnownGovees(c)
+		currentConfigMu.Lock()
+		currentConfig = c
+		currentConfigMu.Unlock()
+	}
+	t.Cleanup(func() { configApplier = orig })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/devices", handleDevices)
+	mux.HandleFunc("/api/devices/{name}", handleDevice)
+	return mux
+}
+
+func deviceAPIRequest(mux *http.ServeMux, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDeviceAPI(t *testing.T) {
+	mux := setupDeviceAPI(t, deviceAPITestConfig)
+	const token = "s3cret"
+
+	if rec := deviceAPIRequest(mux, http.MethodPost, "/api/devices", "", `{}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST without token: status = %d, want 401", rec.Code)
+	}
+	if rec := deviceAPIRequest(mux, http.MethodDelete, "/api/devices/Office", "wrong", ``); rec.Code != http.StatusUnauthorized {
+		t.Errorf("DELETE with wrong token: status = %d, want 401", rec.Code)
+	}
+
+	rejected := []struct {
+		name, method, path, body string
+		want                     int
+	}{
+		{"Missing name", http.MethodPost, "/api/devices", `{"mac":"AA:BB:CC:DD:EE:02"}`, http.StatusBadRequest},
+		{"Malformed MAC", http.MethodPost, "/api/devices", `{"mac":"AA:BB","name":"Attic"}`, http.StatusBadRequest},
+		{"Unsupported model", http.MethodPost, "/api/devices", `{"mac":"AA:BB:CC:DD:EE:02","name":"Attic","model":"H9999"}`, http.StatusBadRequest},
+		{"Unknown field", http.MethodPost, "/api/devices", `{"mac":"AA:BB:CC:DD:EE:02","name":"Attic","colour":"red"}`, http.StatusBadRequest},
+		{"Duplicate name", http.MethodPost, "/api/devices", `{"mac":"AA:BB:CC:DD:EE:02","name":"Office"}`, http.StatusConflict},
+		{"Duplicate MAC", http.MethodPost, "/api/devices", `{"mac":"aa:bb:cc:dd:ee:01","name":"Attic"}`, http.StatusConflict},
+		{"Unknown device", http.MethodPatch, "/api/devices/Cellar", `{"group":"Downstairs"}`, http.StatusNotFound},
+		{"Changed MAC", http.MethodPatch, "/api/devices/Office", `{"mac":"AA:BB:CC:DD:EE:09"}`, http.StatusBadRequest},
+	}
+	for _, tt := range rejected {
+		if rec := deviceAPIRequest(mux, tt.method, tt.path, token, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d (%s)", tt.name, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+
+	rec := deviceAPIRequest(mux, http.MethodPost, "/api/devices", token,
+		`{"mac":"aa:bb:cc:dd:ee:02","name":"Attic","group":"Upstairs","model":"h5075","offsets":{"temperature":-0.5}}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	var created apiDevice
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode device: %v", err)
+	}
+	if created.MAC != "AA:BB:CC:DD:EE:02" || created.Name != "Attic" || created.Model != "H5075" || created.Offsets.Temperature != -0.5 {
+		t.Errorf("created device = %+v", created)
+	}
+
+	rec = deviceAPIRequest(mux, http.MethodPatch, "/api/devices/Office", token, `{"name":"Study","group":"","offsets":{"humidity":2}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH: status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	mutex.Lock()
+	study := knownGovees["AA:BB:CC:DD:EE:01"]
+	mutex.Unlock()
+	if study.Name != "Study" || study.Group != "" || study.HumidityOffset != 2 {
+		t.Errorf("patched device = %+v", study)
+	}
+
+	if rec := deviceAPIRequest(mux, http.MethodDelete, "/api/devices/Attic", token, ``); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: status = %d (%s)", rec.Code, rec.Body.String())
+	}
+	mutex.Lock()
+	_, attic := knownGovees["AA:BB:CC:DD:EE:02"]
+	mutex.Unlock()
+	if attic {
+		t.Error("deleted device is still active")
+	}
+
+	// Edits were applied once, so the file the watcher sees matches the live config
+	if hash := configFileHash("config.yaml"); hash != liveConfig().fileHash {
+		t.Errorf("config file hash %s does not match the applied config %s", hash, liveConfig().fileHash)
+	}
+	data, _ := os.ReadFile("config.yaml")
+	for _, want := range []string{"# Sensors", "# by the window", `name: "Study"`, `apiToken: "s3cret"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("config.yaml lacks %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "Attic") {
+		t.Errorf("config.yaml still has the deleted device:\n%s", data)
+	}
+}
+
+func TestDeviceAPIDisabledWithoutToken(t *testing.T) {
+	mux := setupDeviceAPI(t, "devices: []\n")
+
+	rec := deviceAPIRequest(mux, http.MethodPost, "/api/devices", "anything", `{"mac":"AA:BB:CC:DD:EE:02","name":"Attic"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("POST: status = %d, want 403", rec.Code)
+	}
+	if rec := deviceAPIRequest(mux, http.MethodGet, "/api/devices", "", ``); rec.Code != http.StatusOK {
+		t.Errorf("GET: status = %d, want 200", rec.Code)
+	}
+}
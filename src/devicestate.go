@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// forgetDeviceLocked drops the state of a device that is no longer configured.
+// Caller must hold mutex.
+func forgetDeviceLocked(mac string) {
+	delete(lastUpdateTime, mac)
+	delete(deviceFirstSeen, mac)
+	delete(deviceLastLoggedVals, mac)
+	delete(deviceStatuses, mac)
+	delete(staleMissCounts, mac)
+	delete(deviceModels, mac)
+	resetFilterState(mac)
+	forgetRadioStats(mac)
+}
+
+// deleteDeviceSeriesLocked removes every series labelled with a device name.
+// Caller must hold mutex.
+func deleteDeviceSeriesLocked(name string) {
+	deleteReadingMetrics(name)
+	deleteRadioMetrics(name)
+	lastSeenGauge.DeleteLabelValues(name)
+	for _, status := range statusLabels {
+		deviceStatusGauge.DeleteLabelValues(name, status)
+	}
+	deviceStatusTransitionsCounter.DeletePartialMatch(prometheus.Labels{"name": name})
+	readingsRejectedCounter.DeletePartialMatch(prometheus.Labels{"name": name})
+	deleteThresholdMetrics(name)
+}
+
+// renameDeviceSeriesLocked exports the series of a renamed device under its new
+// name. Gauges are exported again from the device's state; counters restart from
+// zero under the new name. The caller deletes the series of every old name first,
+// so devices that swap names do not clear each other's. Caller must hold mutex.
+func renameDeviceSeriesLocked(previous, govee KnownGovee) {
+	if status, ok := deviceStatuses[govee.MAC]; ok {
+		setDeviceStatusGauges(govee.Name, status)
+	}
+	if lastSeen, ok := lastUpdateTime[govee.MAC]; ok {
+		setLastSeen(govee.Name, lastSeen)
+		if values, ok := deviceLastLoggedVals[govee.MAC]; ok {
+			temperatureGauge.WithLabelValues(govee.Name).Set(values.Temperature)
+			humidityGauge.WithLabelValues(govee.Name).Set(values.Humidity)
+			batteryGauge.WithLabelValues(govee.Name).Set(float64(values.Battery))
+			updateDerivedMetrics(govee.Name, values.Temperature, values.Humidity, currentDerivedMetricsConfig())
+		}
+		if deviceStatuses[govee.MAC] == "stale" {
+			applyStalePolicyLocked(govee)
+		}
+	}
+
+	renameRadioMetrics(govee)
+
+	deviceRenamedGauge.DeletePartialMatch(prometheus.Labels{"mac": govee.MAC})
+	deviceRenamedGauge.WithLabelValues(govee.MAC, previous.Name, govee.Name).Set(1)
+	log.Printf("Device %s renamed from '%s' to '%s', keeping its state", govee.MAC, previous.Name, govee.Name)
+}
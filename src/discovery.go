@@ -0,0 +1,228 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// maxDiscoveredDevices bounds the table of unknown devices; the least recently
+// seen entry is evicted when it is full
+const maxDiscoveredDevices = 64
+
+// discoveredDevice is an unknown Govee sensor heard during scanning
+type discoveredDevice struct {
+	MAC       string    `json:"mac"`
+	LocalName string    `json:"localName"`
+	Model     string    `json:"model"`
+	RSSI      int16     `json:"rssi"`
+	Reading   *Reading  `json:"reading,omitempty"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// enrollRequest is the body accepted by POST /api/discovered
+type enrollRequest struct {
+	MAC         string `json:"mac"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Group       string `json:"group"`
+	Model       string `json:"model"`
+}
+
+var (
+	discoveredDevices   = make(map[string]*discoveredDevice)
+	discoveredDevicesMu = &sync.Mutex{}
+)
+
+// recordDiscoveredDevice adds or refreshes an unknown device in the discovery table
+// if any of its manufacturer data elements decodes as a Govee reading
+func recordDiscoveredDevice(mac, localName string, rssi int16, elements []bluetooth.ManufacturerDataElement) {
+	for _, element := range elements {
+		// 0x0001 is not Govee-specific, so require a Govee model in the name for it
+		if element.CompanyID == goveeH5101ManufacturerID && normalizeModel(localName) == "" {
+			continue
+		}
+
+		model, decoder := resolveDecoder("", localName, element.CompanyID, len(element.Data))
+		if decoder == nil {
+			continue
+		}
+		reading, err := decoder.Decode(element.Data)
+		if err != nil {
+			continue
+		}
+
+		now := time.Now()
+		discoveredDevicesMu.Lock()
+		entry, exists := discoveredDevices[mac]
+		if !exists {
+			if len(discoveredDevices) >= maxDiscoveredDevices {
+				evictOldestDiscoveredLocked()
+			}
+			entry = &discoveredDevice{MAC: mac, FirstSeen: now}
+			discoveredDevices[mac] = entry
+			log.Printf("Discovered unknown Govee %s device %s (%s, RSSI %d dBm)", model, mac, localName, rssi)
+		}
+		if localName != "" {
+			entry.LocalName = localName
+		}
+		entry.Model = model
+		entry.RSSI = rssi
+		entry.Reading = &reading
+		entry.LastSeen = now
+		discoveredDevicesMu.Unlock()
+		return
+	}
+}
+
+// evictOldestDiscoveredLocked removes the least recently seen entry.
+// Caller must hold discoveredDevicesMu.
+func evictOldestDiscoveredLocked() {
+	oldestMAC := ""
+	var oldest time.Time
+	for mac, entry := range discoveredDevices {
+		if oldestMAC == "" || entry.LastSeen.Before(oldest) {
+			oldestMAC = mac
+			oldest = entry.LastSeen
+		}
+	}
+	delete(discoveredDevices, oldestMAC)
+}
+
+// forgetDiscoveredDevice drops a device from the discovery table, e.g. once enrolled
+func forgetDiscoveredDevice(mac string) {
+	discoveredDevicesMu.Lock()
+	delete(discoveredDevices, mac)
+	discoveredDevicesMu.Unlock()
+}
+
+// listDiscoveredDevices returns a snapshot of the discovery table, strongest signal first
+func listDiscoveredDevices() []discoveredDevice {
+	discoveredDevicesMu.Lock()
+	list := make([]discoveredDevice, 0, len(discoveredDevices))
+	for _, entry := range discoveredDevices {
+		list = append(list, *entry)
+	}
+	discoveredDevicesMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].RSSI != list[j].RSSI {
+			return list[i].RSSI > list[j].RSSI
+		}
+		return list[i].MAC < list[j].MAC
+	})
+	return list
+}
+
+// handleDiscovered serves the discovery table (GET) and enrolls a discovered
+// device into config.yaml (POST)
+func handleDiscovered(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, listDiscoveredDevices())
+	case http.MethodPost:
+		enrollDiscoveredDevice(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// enrollDiscoveredDevice appends a discovered device to the devices list in
+// config.yaml. Like the device API it needs server.apiToken, and the change is
+// validated and applied at once.
+func enrollDiscoveredDevice(w http.ResponseWriter, r *http.Request) {
+	if !authorizeDeviceEdit(w, r) {
+		return
+	}
+	var req enrollRequest
+	if !decodeStrictJSON(w, r, &req) {
+		return
+	}
+
+	mac := strings.ToUpper(strings.TrimSpace(req.MAC))
+	name := strings.TrimSpace(req.Name)
+	if mac == "" || name == "" {
+		http.Error(w, "Both mac and name are required", http.StatusBadRequest)
+		return
+	}
+
+	discoveredDevicesMu.Lock()
+	entry, found := discoveredDevices[mac]
+	var discovered discoveredDevice
+	if found {
+		discovered = *entry
+	}
+	discoveredDevicesMu.Unlock()
+	if !found {
+		http.Error(w, "Device "+mac+" has not been discovered", http.StatusNotFound)
+		return
+	}
+
+	mutex.Lock()
+	_, macKnown := knownGovees[mac]
+	nameTaken := false
+	for _, govee := range knownGovees {
+		if govee.Name == name {
+			nameTaken = true
+			break
+		}
+	}
+	mutex.Unlock()
+	if macKnown {
+		http.Error(w, "Device "+mac+" is already configured", http.StatusConflict)
+		return
+	}
+	if nameTaken {
+		http.Error(w, "A device named "+name+" is already configured", http.StatusConflict)
+		return
+	}
+
+	model := req.Model
+	if model == "" {
+		model = discovered.Model
+	}
+	if model != "" && !isSupportedModel(model) {
+		http.Error(w, "Unsupported model "+model, http.StatusBadRequest)
+		return
+	}
+
+	device := Device{
+		MAC:         mac,
+		Name:        name,
+		DisplayName: strings.TrimSpace(req.DisplayName),
+		Group:       strings.TrimSpace(req.Group),
+		Model:       normalizeModel(model),
+	}
+
+	deviceEditMu.Lock()
+	defer deviceEditMu.Unlock()
+
+	config := liveConfig()
+	if !validateDeviceEdit(w, config, append(append([]Device{}, config.Devices...), device)) {
+		return
+	}
+	if err := appendDeviceToConfigFile(configFilePath, device); err != nil {
+		log.Printf("Failed to enroll device %s: %v", mac, err)
+		http.Error(w, "Failed to update config: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	forgetDiscoveredDevice(mac)
+	log.Printf("Enrolled discovered device %s as '%s' in %s", mac, name, configFilePath)
+	if !applyDeviceEdit(w) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, enrollRequest{
+		MAC:         device.MAC,
+		Name:        device.Name,
+		DisplayName: device.DisplayName,
+		Group:       device.Group,
+		Model:       device.Model,
+	})
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"tinygo.org/x/bluetooth"
+)
+
+// resetDiscovered clears the discovery table between tests.
+func resetDiscovered() {
+	discoveredDevicesMu.Lock()
+	discoveredDevices = make(map[string]*discoveredDevice)
+	discoveredDevicesMu.Unlock()
+}
+
+func h5075Element() []bluetooth.ManufacturerDataElement {
+	return []bluetooth.ManufacturerDataElement{
+		{CompanyID: 0x004C, Data: []byte{0x02, 0x15, 0x49, 0x4E}}, // iBeacon frame, ignored
+		{CompanyID: goveeManufacturerID, Data: []byte{0x00, 0x01, 0x56, 0x32, 0x64, 0x00}},
+	}
+}
+
+func TestRecordDiscoveredDevice(t *testing.T) {
+	resetDiscovered()
+	t.Cleanup(resetDiscovered)
+
+	recordDiscoveredDevice("A4:C1:38:00:00:01", "GVH5075_0001", -70, h5075Element())
+	recordDiscoveredDevice("A4:C1:38:00:00:01", "", -60, h5075Element())
+
+	// Non-Govee advertisements are not tracked
+	recordDiscoveredDevice("11:22:33:44:55:66", "Phone", -40, []bluetooth.ManufacturerDataElement{
+		{CompanyID: 0x004C, Data: []byte{0x10, 0x05}},
+	})
+	// 0x0001 without a Govee model in the name is too generic to track
+	recordDiscoveredDevice("11:22:33:44:55:77", "", -40, []bluetooth.ManufacturerDataElement{
+		{CompanyID: goveeH5101ManufacturerID, Data: []byte{0x01, 0x01, 0x01, 0x56, 0x32, 0x64}},
+	})
+
+	list := listDiscoveredDevices()
+	if len(list) != 1 {
+		t.Fatalf("got %d discovered devices, want 1: %+v", len(list), list)
+	}
+
+	got := list[0]
+	if got.LocalName != "GVH5075_0001" {
+		t.Errorf("local name = %q, want it kept from the first advertisement", got.LocalName)
+	}
+	if got.Model != "H5075" || got.RSSI != -60 {
+		t.Errorf("model/RSSI = %s/%d, want H5075/-60", got.Model, got.RSSI)
+	}
+	if got.Reading == nil || got.Reading.Temperature != 8.7 || got.Reading.Humidity != 60.2 || got.Reading.Battery != 100 {
+		t.Errorf("reading = %+v, want 8.7°C 60.2%% 100%%", got.Reading)
+	}
+	if got.LastSeen.Before(got.FirstSeen) {
+		t.Errorf("last seen %v before first seen %v", got.LastSeen, got.FirstSeen)
+	}
+}
+
+func TestRecordDiscoveredDeviceIsBounded(t *testing.T) {
+	resetDiscovered()
+	t.Cleanup(resetDiscovered)
+
+	for i := 0; i < maxDiscoveredDevices+5; i++ {
+		recordDiscoveredDevice(fmt.Sprintf("A4:C1:38:00:01:%02X", i), "", -80, h5075Element())
+	}
+
+	discoveredDevicesMu.Lock()
+	defer discoveredDevicesMu.Unlock()
+	if len(discoveredDevices) != maxDiscoveredDevices {
+		t.Fatalf("table size = %d, want %d", len(discoveredDevices), maxDiscoveredDevices)
+	}
+	if _, ok := discoveredDevices[fmt.Sprintf("A4:C1:38:00:01:%02X", maxDiscoveredDevices+4)]; !ok {
+		t.Error("most recently seen device should not be evicted")
+	}
+}
+
+func TestHandleDiscoveredGet(t *testing.T) {
+	resetDiscovered()
+	t.Cleanup(resetDiscovered)
+
+	recordDiscoveredDevice("A4:C1:38:00:00:01", "GVH5075_0001", -70, h5075Element())
+
+	rec := httptest.NewRecorder()
+	handleDiscovered(rec, httptest.NewRequest(http.MethodGet, "/api/discovered", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var list []discoveredDevice
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(list) != 1 || list[0].MAC != "A4:C1:38:00:00:01" {
+		t.Fatalf("unexpected response: %s", rec.Body.String())
+	}
+}
+
+func TestHandleDiscoveredEnroll(t *testing.T) {
+	resetDiscovered()
+	t.Cleanup(resetDiscovered)
+	setupDeviceAPI(t, "server:\n  apiToken: \"s3cret\"\n# Sensors\ndevices:\n  - mac: \"AA:BB:CC:DD:EE:01\"\n    name: \"Office\" # main office\n")
+
+	recordDiscoveredDevice("A4:C1:38:00:00:01", "GVH5075_0001", -70, h5075Element())
+
+	postAs := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/discovered", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handleDiscovered(rec, req)
+		return rec
+	}
+	post := func(body string) *httptest.ResponseRecorder { return postAs("s3cret", body) }
+
+	enroll := `{"mac":"a4:c1:38:00:00:01","name":"Garage","group":"Outdoor"}`
+	if rec := postAs("", enroll); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without token: status = %d, want 401", rec.Code)
+	}
+	if rec := postAs("wrong", enroll); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status = %d, want 401", rec.Code)
+	}
+	if rec := post(`{"mac":"a4:c1:38:00:00:01","name":"Garage","grop":"Outdoor"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown field: status = %d, want 400", rec.Code)
+	}
+	if rec := post(`{"mac":"a4:c1:38:00:00:01","name":"Garage","group":"House//Garage"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid group: status = %d, want 400", rec.Code)
+	}
+	if rec := post(`{"mac":"A4:C1:38:00:00:01","name":"Office"}`); rec.Code != http.StatusConflict {
+		t.Errorf("duplicate name: status = %d, want 409", rec.Code)
+	}
+	if rec := post(`{"mac":"A4:C1:38:99:99:99","name":"Garage"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("undiscovered MAC: status = %d, want 404", rec.Code)
+	}
+	if rec := post(`{"mac":"a4:c1:38:00:00:01"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("missing name: status = %d, want 400", rec.Code)
+	}
+
+	rec := post(enroll)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("enroll: status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	data, err := os.ReadFile(configFilePath)
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	content := string(data)
+	for _, want := range []string{"# Sensors", "# main office", `mac: "A4:C1:38:00:00:01"`, `name: "Garage"`, `group: "Outdoor"`, `model: "H5075"`} {
+		if !strings.Contains(content, want) {
+			t.Errorf("config.yaml missing %q:\n%s", want, content)
+		}
+	}
+
+	if len(listDiscoveredDevices()) != 0 {
+		t.Error("enrolled device should be removed from the discovery table")
+	}
+	mutex.Lock()
+	garage, ok := knownGovees["A4:C1:38:00:00:01"]
+	mutex.Unlock()
+	if !ok || garage.Name != "Garage" {
+		t.Errorf("enrolled device not applied: %+v", garage)
+	}
+}
+
+func TestHandleDiscoveredEnrollWithoutToken(t *testing.T) {
+	resetDiscovered()
+	t.Cleanup(resetDiscovered)
+	setupDeviceAPI(t, "devices:\n  - mac: \"AA:BB:CC:DD:EE:01\"\n    name: \"Office\"\n")
+	recordDiscoveredDevice("A4:C1:38:00:00:01", "GVH5075_0001", -70, h5075Element())
+
+	rec := httptest.NewRecorder()
+	handleDiscovered(rec, httptest.NewRequest(http.MethodPost, "/api/discovered", strings.NewReader(`{"mac":"A4:C1:38:00:00:01","name":"Garage"}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403 when server.apiToken is unset", rec.Code)
+	}
+}
+
+func TestHandleDiscoveredMethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleDiscovered(rec, httptest.NewRequest(http.MethodDelete, "/api/discovered", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types pushed on /api/events
+const (
+	eventReading      = "reading"
+	eventStatus       = "status"
+	eventOpenMeteo    = "openmeteo"
+	eventConfigReload = "config_reload"
+	eventScanStart    = "scan_start"
+	eventScanFinish   = "scan_finish"
+)
+
+const (
+	// eventBufferSize is the number of events queued per subscriber; events for
+	// a subscriber that falls further behind are dropped
+	eventBufferSize = 64
+
+	// eventKeepAliveInterval keeps idle connections open through proxies
+	eventKeepAliveInterval = 15 * time.Second
+
+	// eventRetryMillis is the reconnect delay suggested to EventSource clients
+	eventRetryMillis = 5000
+)
+
+// serverEvent is one message of the event stream
+type serverEvent struct {
+	ID   uint64
+	Type string
+	Data []byte
+}
+
+// readingEvent is published for every accepted sensor reading
+type readingEvent struct {
+	Name        string    `json:"name"`
+	Temperature float64   `json:"temperature"`
+	Humidity    float64   `json:"humidity"`
+	Battery     *int      `json:"battery,omitempty"` // Unset for virtual devices
+	Time        time.Time `json:"time"`
+}
+
+// statusEvent is published when a device changes between active, stale and never_seen
+type statusEvent struct {
+	Name     string    `json:"name"`
+	Status   string    `json:"status"`
+	Previous string    `json:"previous,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// openMeteoEvent is published for every Open-Meteo update
+type openMeteoEvent struct {
+	Temperature float64   `json:"temperature"`
+	Humidity    float64   `json:"humidity"`
+	Time        time.Time `json:"time"`
+}
+
+// configReloadEvent is published after config.yaml has been reloaded
+type configReloadEvent struct {
+	Devices int       `json:"devices"`
+	Time    time.Time `json:"time"`
+}
+
+// scanEvent is published when a BLE scan starts and finishes
+type scanEvent struct {
+	Duration string    `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// eventBroker fans events out to the connected stream clients
+type eventBroker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	subscribers map[chan serverEvent]struct{}
+}
+
+var events = &eventBroker{subscribers: make(map[chan serverEvent]struct{})}
+
+// subscribe registers a new client and returns its event channel
+func (b *eventBroker) subscribe() chan serverEvent {
+	ch := make(chan serverEvent, eventBufferSize)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+	return ch
+}
+
+// unsubscribe removes a client registered with subscribe
+func (b *eventBroker) unsubscribe(ch chan serverEvent) {
+	b.mu.Lock()
+	delete(b.subscribers, ch)
+	b.mu.Unlock()
+}
+
+// publish sends an event to every subscriber without blocking the caller
+func (b *eventBroker) publish(eventType string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Events: failed to encode %s event: %v", eventType, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subscribers) == 0 {
+		return
+	}
+	b.nextID++
+	event := serverEvent{ID: b.nextID, Type: eventType, Data: data}
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Slow client; it will resync from the next event or a refetch
+		}
+	}
+}
+
+// publishEvent publishes an event on the shared broker
+func publishEvent(eventType string, payload interface{}) {
+	events.publish(eventType, payload)
+}
+
+// writeServerEvent writes one event in text/event-stream format
+func writeServerEvent(w http.ResponseWriter, event serverEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
+
+// handleEvents streams live events to the client as Server-Sent Events
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable nginx response buffering
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-ch:
+			if err := writeServerEvent(w, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// receiveEvent waits for the next event on a subscriber channel
+func receiveEvent(t *testing.T, ch chan serverEvent) serverEvent {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return serverEvent{}
+	}
+}
+
+func TestEventBrokerPublish(t *testing.T) {
+	broker := &eventBroker{subscribers: make(map[chan serverEvent]struct{})}
+	a := broker.subscribe()
+	b := broker.subscribe()
+
+	broker.publish(eventConfigReload, configReloadEvent{Devices: 3})
+
+	for _, ch := range []chan serverEvent{a, b} {
+		event := receiveEvent(t, ch)
+		if event.ID != 1 || event.Type != eventConfigReload {
+			t.Errorf("got event %d/%s, want 1/%s", event.ID, event.Type, eventConfigReload)
+		}
+		var payload configReloadEvent
+		if err := json.Unmarshal(event.Data, &payload); err != nil || payload.Devices != 3 {
+			t.Errorf("unexpected payload %s (%v)", event.Data, err)
+		}
+	}
+
+	broker.unsubscribe(b)
+	broker.publish(eventScanStart, scanEvent{})
+	if event := receiveEvent(t, a); event.ID != 2 {
+		t.Errorf("second event id = %d, want 2", event.ID)
+	}
+	select {
+	case event := <-b:
+		t.Errorf("unsubscribed client received %+v", event)
+	default:
+	}
+}
+
+func TestEventBrokerDropsForSlowSubscriber(t *testing.T) {
+	broker := &eventBroker{subscribers: make(map[chan serverEvent]struct{})}
+	ch := broker.subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < eventBufferSize+10; i++ {
+			broker.publish(eventScanStart, scanEvent{})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a full subscriber")
+	}
+	if len(ch) != eventBufferSize {
+		t.Errorf("queued %d events, want %d", len(ch), eventBufferSize)
+	}
+}
+
+func TestStatusEventsOnlyOnTransition(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	ch := events.subscribe()
+	defer events.unsubscribe(ch)
+
+	office := KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Office"}
+	mutex.Lock()
+	setDeviceStatusLocked(office, "active")
+	setDeviceStatusLocked(office, "active")
+	setDeviceStatusLocked(office, "stale")
+	mutex.Unlock()
+
+	var got []statusEvent
+	for len(ch) > 0 {
+		var payload statusEvent
+		if err := json.Unmarshal((<-ch).Data, &payload); err != nil {
+			t.Fatalf("decode status event: %v", err)
+		}
+		got = append(got, payload)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d status events, want 2: %+v", len(got), got)
+	}
+	if got[0].Status != "active" || got[0].Previous != "" {
+		t.Errorf("first event = %+v, want active from nothing", got[0])
+	}
+	if got[1].Status != "stale" || got[1].Previous != "active" {
+		t.Errorf("second event = %+v, want active -> stale", got[1])
+	}
+}
+
+func TestHandleEventsStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(handleEvents))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	// The retry hint is flushed once the client is subscribed
+	if line, _ := reader.ReadString('\n'); !strings.HasPrefix(line, "retry: ") {
+		t.Fatalf("first line = %q, want retry hint", line)
+	}
+	reader.ReadString('\n')
+
+	publishEvent(eventReading, readingEvent{Name: "Office", Temperature: 21.5})
+
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		if line == "\n" {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id: ") ||
+		lines[1] != "event: reading" || !strings.Contains(lines[2], `"name":"Office"`) {
+		t.Errorf("unexpected event %q", lines)
+	}
+}
+
+func TestHandleEventsMethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleEvents(rec, httptest.NewRequest(http.MethodPost, "/api/events", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want 405", rec.Code)
+	}
+}
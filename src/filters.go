@@ -0,0 +1,159 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a reading is rejected, used as the reason label of readingsRejectedCounter
+const (
+	rejectInvalid      = "invalid"
+	rejectOutOfRange   = "out_of_range"
+	rejectRateOfChange = "rate_of_change"
+	rejectNoDecoder    = "no_decoder"
+)
+
+// maxMedianWindow bounds the rolling median so a typo cannot hold back readings for hours
+const maxMedianWindow = 25
+
+var readingsRejectedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "govee_readings_rejected_total",
+		Help: "Readings rejected per device and reason (invalid, no_decoder, out_of_range, rate_of_change)",
+	},
+	[]string{"name", "reason"},
+)
+
+// filterState is the history one device's filter chain needs
+type filterState struct {
+	settings    FilterConfig
+	lastTime    time.Time
+	lastTemp    float64
+	lastHumid   float64
+	tempWindow  []float64
+	humidWindow []float64
+	emaStarted  bool
+	tempEMA     float64
+	humidEMA    float64
+}
+
+var (
+	filterStatesMu = &sync.Mutex{}
+	filterStates   = make(map[string]*filterState) // keyed by MAC
+)
+
+// compileFilterConfig picks the device's filters, falling back to the global
+// ones, and disables settings that are out of range
+func compileFilterConfig(global FilterConfig, device Device) FilterConfig {
+	settings := global
+	if device.Filters != nil {
+		settings = *device.Filters
+	}
+
+	if settings.MaxRate.Temperature < 0 || settings.MaxRate.Humidity < 0 {
+		log.Printf("Warning: Negative filters.maxRate for device '%s', disabling the rate limit", device.Name)
+		settings.MaxRate.Temperature, settings.MaxRate.Humidity = 0, 0
+	}
+	if settings.Median < 0 || settings.Median > maxMedianWindow {
+		log.Printf("Warning: filters.median for device '%s' must be between 0 and %d, disabling the median", device.Name, maxMedianWindow)
+		settings.Median = 0
+	}
+	if settings.EMA < 0 || settings.EMA > 1 {
+		log.Printf("Warning: filters.ema for device '%s' must be between 0 and 1, disabling the moving average", device.Name)
+		settings.EMA = 0
+	}
+	return settings
+}
+
+// exceedsRate reports whether a change is faster than maxRate per minute. Changes
+// within one minute's allowance always pass, so jitter between advertisements a
+// few seconds apart is not rejected.
+func exceedsRate(previous, current, maxRate float64, elapsed time.Duration) bool {
+	if maxRate <= 0 {
+		return false
+	}
+	minutes := math.Max(elapsed.Minutes(), 1)
+	return math.Abs(current-previous) > maxRate*minutes
+}
+
+// rollingMedian appends value to the window, trims it to size and returns its median
+func rollingMedian(window []float64, value float64, size int) ([]float64, float64) {
+	window = append(window, value)
+	if len(window) > size {
+		window = window[len(window)-size:]
+	}
+	sorted := append([]float64(nil), window...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return window, (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return window, sorted[mid]
+}
+
+// filterReading runs a calibrated reading through the device's filter chain: the
+// rate-of-change limit, then the rolling median, then the moving average. It
+// returns the smoothed values, or the reason the reading was rejected.
+func filterReading(govee KnownGovee, temperature, humidity float64, now time.Time) (float64, float64, string) {
+	settings := govee.Filters
+	if settings == (FilterConfig{}) {
+		return temperature, humidity, ""
+	}
+
+	filterStatesMu.Lock()
+	defer filterStatesMu.Unlock()
+
+	state, ok := filterStates[govee.MAC]
+	if !ok || state.settings != settings {
+		// First reading, or the filters were reconfigured
+		state = &filterState{settings: settings}
+		filterStates[govee.MAC] = state
+	}
+
+	if !state.lastTime.IsZero() {
+		elapsed := now.Sub(state.lastTime)
+		if exceedsRate(state.lastTemp, temperature, settings.MaxRate.Temperature, elapsed) ||
+			exceedsRate(state.lastHumid, humidity, settings.MaxRate.Humidity, elapsed) {
+			return 0, 0, rejectRateOfChange
+		}
+	}
+	state.lastTime = now
+	state.lastTemp = temperature
+	state.lastHumid = humidity
+
+	if settings.Median > 1 {
+		state.tempWindow, temperature = rollingMedian(state.tempWindow, temperature, settings.Median)
+		state.humidWindow, humidity = rollingMedian(state.humidWindow, humidity, settings.Median)
+	}
+
+	if settings.EMA > 0 {
+		if !state.emaStarted {
+			state.tempEMA, state.humidEMA = temperature, humidity
+			state.emaStarted = true
+		} else {
+			state.tempEMA += settings.EMA * (temperature - state.tempEMA)
+			state.humidEMA += settings.EMA * (humidity - state.humidEMA)
+		}
+		temperature, humidity = state.tempEMA, state.humidEMA
+	}
+
+	return temperature, humidity, ""
+}
+
+// recordRejectedReading counts a rejected reading
+func recordRejectedReading(name, reason string) {
+	readingsRejectedCounter.WithLabelValues(name, reason).Inc()
+}
+
+// resetFilterState forgets the filter history of a device, so a sensor that
+// comes back after going stale is not compared with readings from before
+func resetFilterState(mac string) {
+	filterStatesMu.Lock()
+	delete(filterStates, mac)
+	filterStatesMu.Unlock()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCompileFilterConfig(t *testing.T) {
+	var global FilterConfig
+	global.MaxRate.Temperature = 2
+	global.Median = 3
+
+	if got := compileFilterConfig(global, Device{Name: "Office"}); got != global {
+		t.Errorf("without device filters = %+v, want the global %+v", got, global)
+	}
+
+	own := FilterConfig{EMA: 0.3}
+	if got := compileFilterConfig(global, Device{Name: "Sauna", Filters: &own}); got != own {
+		t.Errorf("with device filters = %+v, want %+v", got, own)
+	}
+
+	invalid := FilterConfig{Median: 100, EMA: 1.5}
+	invalid.MaxRate.Humidity = -1
+	if got := compileFilterConfig(FilterConfig{}, Device{Name: "Attic", Filters: &invalid}); got != (FilterConfig{}) {
+		t.Errorf("invalid settings = %+v, want all disabled", got)
+	}
+}
+
+func TestFilterReading(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	start := time.Now()
+	at := func(minutes float64) time.Time { return start.Add(time.Duration(minutes * float64(time.Minute))) }
+
+	t.Run("rate of change", func(t *testing.T) {
+		govee := KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Rate"}
+		govee.Filters.MaxRate.Temperature = 1
+
+		steps := []struct {
+			minutes  float64
+			temp     float64
+			rejected bool
+		}{
+			{0, 20, false},
+			{0.1, 20.8, false}, // within one minute's allowance
+			{0.2, 35, true},    // spike
+			{1, 21.2, false},
+			{2, 25, true},  // 3.8°C in one minute
+			{5, 25, false}, // a real step passes once enough time has elapsed
+		}
+		for _, step := range steps {
+			_, _, reason := filterReading(govee, step.temp, 50, at(step.minutes))
+			if (reason == rejectRateOfChange) != step.rejected {
+				t.Errorf("%.1f°C at %vm: reason %q, want rejected=%v", step.temp, step.minutes, reason, step.rejected)
+			}
+		}
+	})
+
+	t.Run("median", func(t *testing.T) {
+		govee := KnownGovee{MAC: "AA:BB:CC:DD:EE:02", Name: "Median", Filters: FilterConfig{Median: 3}}
+		var got []float64
+		for i, temp := range []float64{20, 30, 21, 22, 23} {
+			filtered, _, _ := filterReading(govee, temp, 50, at(float64(i)))
+			got = append(got, filtered)
+		}
+		want := []float64{20, 25, 21, 22, 22}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("median outputs = %v, want %v", got, want)
+				break
+			}
+		}
+	})
+
+	t.Run("moving average", func(t *testing.T) {
+		govee := KnownGovee{MAC: "AA:BB:CC:DD:EE:03", Name: "EMA", Filters: FilterConfig{EMA: 0.5}}
+		filterReading(govee, 20, 40, at(0))
+		temp, humidity, _ := filterReading(govee, 22, 50, at(1))
+		if math.Abs(temp-21) > 1e-9 || math.Abs(humidity-45) > 1e-9 {
+			t.Errorf("EMA = %v/%v, want 21/45", temp, humidity)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		govee := KnownGovee{MAC: "AA:BB:CC:DD:EE:04", Name: "Plain"}
+		if temp, humidity, reason := filterReading(govee, 99, 1, at(0)); temp != 99 || humidity != 1 || reason != "" {
+			t.Errorf("unfiltered reading changed: %v/%v %q", temp, humidity, reason)
+		}
+		filterStatesMu.Lock()
+		_, tracked := filterStates[govee.MAC]
+		filterStatesMu.Unlock()
+		if tracked {
+			t.Error("a device without filters should keep no state")
+		}
+	})
+}
+
+func TestParseGoveeDataCountsRejections(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	govee := KnownGovee{Name: "Porch"}
+	govee.Filters.MaxRate.Temperature = 1
+
+	parseGoveeData(govee, []byte{0x01, 0x01, 0x56, 0x32, 0x64}) // 8.7°C, 60.2%
+	parseGoveeData(govee, []byte{0x01, 0x04, 0x5F, 0x82, 0x64}) // 28.6°C spike, 59.4%
+	parseGoveeData(govee, []byte{0x01, 0x00, 0x00, 0x00, 0x64}) // zero reading
+	parseGoveeData(govee, []byte{0x01, 0x0F, 0x42, 0x40, 0x64}) // 100.0°C, out of range
+
+	for reason, want := range map[string]float64{rejectRateOfChange: 1, rejectInvalid: 1, rejectOutOfRange: 1} {
+		if got := testutil.ToFloat64(readingsRejectedCounter.WithLabelValues("Porch", reason)); got != want {
+			t.Errorf("%s rejections = %v, want %v", reason, got, want)
+		}
+	}
+}
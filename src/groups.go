@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// groupSeparator separates the levels of a nested group such as "House/Upstairs/Bedrooms"
+const groupSeparator = "/"
+
+// groupAncestors returns a group and the groups it is nested in, outermost first
+func groupAncestors(group string) []string {
+	if group == "" {
+		return nil
+	}
+	levels := strings.Split(group, groupSeparator)
+	names := make([]string, len(levels))
+	for i := range levels {
+		names[i] = strings.Join(levels[:i+1], groupSeparator)
+	}
+	return names
+}
+
+// groupNameProblem describes why a group name cannot be used, or returns ""
+func groupNameProblem(group string) string {
+	for _, level := range strings.Split(group, groupSeparator) {
+		if level == "" || level != strings.TrimSpace(level) {
+			return "has an empty level or spaces around '" + groupSeparator + "'"
+		}
+	}
+	return ""
+}
+
+// groupStats summarizes one metric over the active devices of a group
+type groupStats struct {
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+	Mean float64 `json:"mean"`
+
+	sum   float64
+	count int
+}
+
+// addGroupValue adds a value to the stats, creating them on the first value
+func addGroupValue(stats **groupStats, value float64) {
+	s := *stats
+	if s == nil {
+		s = &groupStats{Min: value, Max: value}
+		*stats = s
+	}
+	s.Min = min(s.Min, value)
+	s.Max = max(s.Max, value)
+	s.sum += value
+	s.count++
+	s.Mean = s.sum / float64(s.count)
+}
+
+// add counts a device towards the group. Only active sensors with a reading
+// contribute to the aggregates, so a stale device's last value is left out, and
+// so is a virtual device, whose inputs are already counted.
+func (g *apiGroup) add(device apiDevice) {
+	g.Devices = append(g.Devices, device.Name)
+	g.Statuses[device.Status]++
+	if device.Status != "active" || device.Reading == nil || device.Virtual != "" {
+		return
+	}
+	g.ActiveDevices++
+	addGroupValue(&g.Temperature, device.Reading.Temperature)
+	addGroupValue(&g.Humidity, device.Reading.Humidity)
+	if device.Reading.Battery != nil {
+		addGroupValue(&g.Battery, float64(*device.Reading.Battery))
+	}
+}
+
+// groupMetric is one device metric aggregated per group
+type groupMetric struct {
+	min, max, mean *prometheus.Desc
+	stats          func(apiGroup) *groupStats
+}
+
+func newGroupMetric(name, unit string, stats func(apiGroup) *groupStats) groupMetric {
+	desc := func(stat, help string) *prometheus.Desc {
+		return prometheus.NewDesc("govee_group_"+name+"_"+stat,
+			help+" "+name+" ("+unit+") of the active devices in the group and its nested groups",
+			[]string{"group"}, nil)
+	}
+	return groupMetric{
+		min:   desc("min", "Lowest"),
+		max:   desc("max", "Highest"),
+		mean:  desc("mean", "Mean"),
+		stats: stats,
+	}
+}
+
+var (
+	groupDevicesDesc = prometheus.NewDesc("govee_group_devices",
+		"Configured devices in the group and its nested groups", []string{"group"}, nil)
+	groupActiveDevicesDesc = prometheus.NewDesc("govee_group_active_devices",
+		"Active devices in the group and its nested groups", []string{"group"}, nil)
+
+	groupMetrics = []groupMetric{
+		newGroupMetric("temperature", "°C", func(g apiGroup) *groupStats { return g.Temperature }),
+		newGroupMetric("humidity", "%", func(g apiGroup) *groupStats { return g.Humidity }),
+		newGroupMetric("battery", "%", func(g apiGroup) *groupStats { return g.Battery }),
+	}
+)
+
+// groupCollector exports the group aggregates. They are computed when
+// Prometheus scrapes, so they always match the current device readings and
+// statuses.
+type groupCollector struct{}
+
+func (groupCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- groupDevicesDesc
+	ch <- groupActiveDevicesDesc
+	for _, m := range groupMetrics {
+		ch <- m.min
+		ch <- m.max
+		ch <- m.mean
+	}
+}
+
+func (groupCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, group := range snapshotGroups() {
+		ch <- prometheus.MustNewConstMetric(groupDevicesDesc, prometheus.GaugeValue, float64(len(group.Devices)), group.Name)
+		ch <- prometheus.MustNewConstMetric(groupActiveDevicesDesc, prometheus.GaugeValue, float64(group.ActiveDevices), group.Name)
+		for _, m := range groupMetrics {
+			stats := m.stats(group)
+			if stats == nil {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(m.min, prometheus.GaugeValue, stats.Min, group.Name)
+			ch <- prometheus.MustNewConstMetric(m.max, prometheus.GaugeValue, stats.Max, group.Name)
+			ch <- prometheus.MustNewConstMetric(m.mean, prometheus.GaugeValue, stats.Mean, group.Name)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGroupAncestors(t *testing.T) {
+	got := groupAncestors("House/Upstairs/Bedrooms")
+	want := []string{"House", "House/Upstairs", "House/Upstairs/Bedrooms"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groupAncestors = %v, want %v", got, want)
+	}
+	if got := groupAncestors(""); got != nil {
+		t.Errorf("groupAncestors(\"\") = %v, want nil", got)
+	}
+
+	for name, ok := range map[string]bool{"House/Upstairs": true, "Cellar": true, "House/": false, "/House": false, "House / Upstairs": false} {
+		if problem := groupNameProblem(name); (problem == "") != ok {
+			t.Errorf("groupNameProblem(%q) = %q, want ok=%v", name, problem, ok)
+		}
+	}
+}
+
+// setupGroupDevices configures two bedrooms nested under House/Upstairs, an
+// office directly in House/Upstairs and a stale bathroom in House
+func setupGroupDevices(t *testing.T) {
+	t.Helper()
+	resetState()
+	t.Cleanup(resetState)
+	withCurrentConfig(t, apiTestConfig())
+
+	now := time.Now()
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, d := range []struct {
+		mac, name, group, status string
+		values                   lastLoggedValues
+	}{
+		{"AA:BB:CC:DD:EE:01", "Master", "House/Upstairs/Bedrooms", "active", lastLoggedValues{Temperature: 18, Humidity: 50, Battery: 90}},
+		{"AA:BB:CC:DD:EE:02", "Guest", "House/Upstairs/Bedrooms", "active", lastLoggedValues{Temperature: 20, Humidity: 40, Battery: 70}},
+		{"AA:BB:CC:DD:EE:03", "Office", "House/Upstairs", "active", lastLoggedValues{Temperature: 22, Humidity: 45, Battery: 80}},
+		{"AA:BB:CC:DD:EE:04", "Bathroom", "House", "stale", lastLoggedValues{Temperature: 30, Humidity: 95, Battery: 10}},
+	} {
+		knownGovees[d.mac] = KnownGovee{MAC: d.mac, Name: d.name, Group: d.group}
+		deviceLastLoggedVals[d.mac] = d.values
+		lastUpdateTime[d.mac] = now
+		deviceStatuses[d.mac] = d.status
+	}
+}
+
+func TestSnapshotGroupsRollsUpNestedGroups(t *testing.T) {
+	setupGroupDevices(t)
+
+	byName := make(map[string]apiGroup)
+	for _, group := range snapshotGroups() {
+		byName[group.Name] = group
+	}
+	if len(byName) != 3 {
+		t.Fatalf("groups = %v, want House, House/Upstairs and House/Upstairs/Bedrooms", byName)
+	}
+
+	bedrooms := byName["House/Upstairs/Bedrooms"]
+	if bedrooms.ActiveDevices != 2 || *bedrooms.Temperature != (groupStats{Min: 18, Max: 20, Mean: 19, sum: 38, count: 2}) {
+		t.Errorf("Bedrooms = %+v, temperature %+v", bedrooms, bedrooms.Temperature)
+	}
+
+	upstairs := byName["House/Upstairs"]
+	if len(upstairs.Devices) != 3 || upstairs.ActiveDevices != 3 || upstairs.Temperature.Mean != 20 || upstairs.Battery.Min != 70 {
+		t.Errorf("Upstairs = %+v, temperature %+v, battery %+v", upstairs, upstairs.Temperature, upstairs.Battery)
+	}
+
+	// The stale bathroom is counted but left out of the aggregates
+	house := byName["House"]
+	if len(house.Devices) != 4 || house.Statuses["stale"] != 1 || house.ActiveDevices != 3 {
+		t.Errorf("House = %+v", house)
+	}
+	if house.Temperature.Max != 22 || house.Humidity.Max != 50 || house.Battery.Min != 70 {
+		t.Errorf("House aggregates include the stale device: temperature %+v, humidity %+v, battery %+v",
+			house.Temperature, house.Humidity, house.Battery)
+	}
+}
+
+func TestGroupCollector(t *testing.T) {
+	setupGroupDevices(t)
+
+	mutex.Lock()
+	for mac := range knownGovees {
+		if knownGovees[mac].Group != "House" {
+			deviceStatuses[mac] = "stale"
+		}
+	}
+	mutex.Unlock()
+
+	// No device is active, so only the counts are exported
+	expected := `
+# HELP govee_group_active_devices Active devices in the group and its nested groups
+# TYPE govee_group_active_devices gauge
+govee_group_active_devices{group="House"} 0
+govee_group_active_devices{group="House/Upstairs"} 0
+govee_group_active_devices{group="House/Upstairs/Bedrooms"} 0
+# HELP govee_group_devices Configured devices in the group and its nested groups
+# TYPE govee_group_devices gauge
+govee_group_devices{group="House"} 4
+govee_group_devices{group="House/Upstairs"} 3
+govee_group_devices{group="House/Upstairs/Bedrooms"} 2
+`
+	if err := testutil.CollectAndCompare(groupCollector{}, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	mutex.Lock()
+	deviceStatuses["AA:BB:CC:DD:EE:03"] = "active"
+	mutex.Unlock()
+
+	expected = `
+# HELP govee_group_temperature_mean Mean temperature (°C) of the active devices in the group and its nested groups
+# TYPE govee_group_temperature_mean gauge
+govee_group_temperature_mean{group="House"} 22
+govee_group_temperature_mean{group="House/Upstairs"} 22
+`
+	if err := testutil.CollectAndCompare(groupCollector{}, strings.NewReader(expected), "govee_group_temperature_mean"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAlertRuleCoversNestedGroups(t *testing.T) {
+	rule, err := compileAlertRule(AlertRule{Name: "Upstairs warm", Metric: "temperature", Above: floatPtr(25), Groups: []string{"House/Upstairs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for group, want := range map[string]bool{"House/Upstairs": true, "House/Upstairs/Bedrooms": true, "House": false, "House/Upstairsish": false} {
+		if got := rule.appliesTo(KnownGovee{Name: "Room", Group: group}); got != want {
+			t.Errorf("appliesTo(group %q) = %v, want %v", group, got, want)
+		}
+	}
+}
@@ -0,0 +1,634 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// openMeteoHistoryName is the /api/history device name of the OpenMeteo readings
+	openMeteoHistoryName = "openmeteo"
+
+	// openMeteoHistorySeries stores the OpenMeteo readings. Device series never
+	// start with ".", so no sensor can share it.
+	openMeteoHistorySeries = ".openmeteo"
+
+	// historyDayLayout names the per-day history files
+	historyDayLayout = "2006-01-02"
+
+	// maxHistoryPoints caps the number of points a single query may return
+	maxHistoryPoints = 11000
+
+	// defaultHistoryWindow is the query range when "from" is not given
+	defaultHistoryWindow = 24 * time.Hour
+)
+
+// historyPoint is one downsampled sample in the history store
+type historyPoint struct {
+	Timestamp   int64    `json:"t"`
+	Temperature float64  `json:"temperature"`
+	Humidity    float64  `json:"humidity"`
+	Battery     *float64 `json:"battery,omitempty"`
+}
+
+// historyBucket accumulates the samples of one device for one resolution interval
+type historyBucket struct {
+	start       time.Time
+	count       int
+	temperature float64
+	humidity    float64
+	battery     float64
+	batteryN    int
+}
+
+func (b *historyBucket) add(temperature, humidity float64, battery *int) {
+	b.count++
+	b.temperature += temperature
+	b.humidity += humidity
+	if battery != nil {
+		b.battery += float64(*battery)
+		b.batteryN++
+	}
+}
+
+func (b *historyBucket) point() historyPoint {
+	p := historyPoint{
+		Timestamp:   b.start.Unix(),
+		Temperature: b.temperature / float64(b.count),
+		Humidity:    b.humidity / float64(b.count),
+	}
+	if b.batteryN > 0 {
+		battery := b.battery / float64(b.batteryN)
+		p.Battery = &battery
+	}
+	return p
+}
+
+// HistoryStore is an embedded time-series store. Samples are averaged into
+// resolution-sized buckets and appended as JSON lines to one file per series
+// per day under dir; files older than the retention period are deleted. A
+// series is a directory name: deviceHistorySeries for a sensor, or
+// openMeteoHistorySeries.
+type HistoryStore struct {
+	mu         sync.Mutex
+	dir        string
+	resolution time.Duration
+	retention  time.Duration
+	pending    map[string]*historyBucket
+}
+
+// NewHistoryStore opens (creating if needed) a history store in dir
+func NewHistoryStore(dir string, resolution, retention time.Duration) (*HistoryStore, error) {
+	if resolution < time.Second {
+		return nil, fmt.Errorf("history resolution must be at least 1s, got %v", resolution)
+	}
+	if retention < resolution {
+		return nil, fmt.Errorf("history retention %v is shorter than the resolution %v", retention, resolution)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+	return &HistoryStore{
+		dir:        dir,
+		resolution: resolution,
+		retention:  retention,
+		pending:    make(map[string]*historyBucket),
+	}, nil
+}
+
+// deviceHistorySeries returns the series of a device. The name is path-escaped,
+// including a leading ".", so "." and ".." stay inside the store and a device
+// cannot take openMeteoHistorySeries.
+func deviceHistorySeries(device string) string {
+	series := url.PathEscape(device)
+	if strings.HasPrefix(series, ".") {
+		series = "%2E" + series[1:]
+	}
+	return series
+}
+
+// seriesDir returns the directory holding a series' day files
+func (s *HistoryStore) seriesDir(series string) string {
+	return filepath.Join(s.dir, series)
+}
+
+// Record adds a sample. It is averaged with the other samples of its resolution
+// interval and written out once a sample for a later interval arrives (or on Flush).
+func (s *HistoryStore) Record(series string, ts time.Time, temperature, humidity float64, battery *int) error {
+	start := ts.Truncate(s.resolution)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.pending[series]
+	if ok && !bucket.start.Equal(start) {
+		if err := s.writeLocked(series, bucket.point()); err != nil {
+			return err
+		}
+		ok = false
+	}
+	if !ok {
+		bucket = &historyBucket{start: start}
+		s.pending[series] = bucket
+	}
+	bucket.add(temperature, humidity, battery)
+	return nil
+}
+
+// writeLocked appends a point to the series' day file. Caller must hold s.mu.
+func (s *HistoryStore) writeLocked(series string, p historyPoint) error {
+	dir := s.seriesDir(series)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	name := time.Unix(p.Timestamp, 0).UTC().Format(historyDayLayout) + ".jsonl"
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Rename moves a series to a new name. Day files that already exist under the
+// new name are merged, since queries do not depend on line order.
+func (s *HistoryStore) Rename(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if bucket, ok := s.pending[from]; ok {
+		delete(s.pending, from)
+		if _, exists := s.pending[to]; exists {
+			if err := s.writeLocked(to, bucket.point()); err != nil {
+				return err
+			}
+		} else {
+			s.pending[to] = bucket
+		}
+	}
+
+	fromDir, toDir := s.seriesDir(from), s.seriesDir(to)
+	days, err := os.ReadDir(fromDir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(toDir); os.IsNotExist(err) {
+		return os.Rename(fromDir, toDir)
+	}
+	for _, day := range days {
+		data, err := os.ReadFile(filepath.Join(fromDir, day.Name()))
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(filepath.Join(toDir, day.Name()), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(fromDir)
+}
+
+// FlushCompleted writes out pending buckets whose interval ended before now, so a
+// device that stops reporting does not keep its last bucket in memory forever
+func (s *HistoryStore) FlushCompleted(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for series, bucket := range s.pending {
+		if now.Before(bucket.start.Add(s.resolution)) {
+			continue
+		}
+		if err := s.writeLocked(series, bucket.point()); err != nil {
+			return err
+		}
+		delete(s.pending, series)
+	}
+	return nil
+}
+
+// Flush writes out all pending buckets, e.g. on shutdown
+func (s *HistoryStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for series, bucket := range s.pending {
+		if err := s.writeLocked(series, bucket.point()); err != nil {
+			return err
+		}
+		delete(s.pending, series)
+	}
+	return nil
+}
+
+// Prune deletes day files that lie entirely outside the retention period
+func (s *HistoryStore) Prune(now time.Time) error {
+	cutoff := now.Add(-s.retention).UTC().Truncate(24 * time.Hour)
+
+	devices, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, device := range devices {
+		if !device.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, device.Name())
+		days, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, day := range days {
+			date, err := time.Parse(historyDayLayout, strings.TrimSuffix(day.Name(), ".jsonl"))
+			if err != nil {
+				continue
+			}
+			if date.Before(cutoff) {
+				if err := os.Remove(filepath.Join(dir, day.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Query returns the series' samples in [from, to], averaged into step-sized buckets.
+// Steps finer than the store resolution are rounded up to it.
+func (s *HistoryStore) Query(series string, from, to time.Time, step time.Duration) ([]historyPoint, error) {
+	if step < s.resolution {
+		step = s.resolution
+	}
+	if from.Before(to.Add(-s.retention)) {
+		from = to.Add(-s.retention)
+	}
+
+	var raw []historyPoint
+	dir := s.seriesDir(series)
+	for day := from.UTC().Truncate(24 * time.Hour); !day.After(to); day = day.Add(24 * time.Hour) {
+		points, err := readHistoryFile(filepath.Join(dir, day.Format(historyDayLayout)+".jsonl"))
+		if err != nil {
+			return nil, err
+		}
+		raw = append(raw, points...)
+	}
+
+	s.mu.Lock()
+	if bucket, ok := s.pending[series]; ok {
+		raw = append(raw, bucket.point())
+	}
+	s.mu.Unlock()
+
+	return downsampleHistory(raw, from.Unix(), to.Unix(), int64(step.Seconds())), nil
+}
+
+// readHistoryFile parses a day file, tolerating a missing file and a torn last line
+func readHistoryFile(path string) ([]historyPoint, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var points []historyPoint
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var p historyPoint
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, scanner.Err()
+}
+
+// downsampleHistory averages the points in [from, to] into step-second buckets
+func downsampleHistory(raw []historyPoint, from, to, step int64) []historyPoint {
+	buckets := make(map[int64]*historyBucket)
+	for _, p := range raw {
+		if p.Timestamp < from || p.Timestamp > to {
+			continue
+		}
+		start := p.Timestamp - p.Timestamp%step
+		bucket, ok := buckets[start]
+		if !ok {
+			bucket = &historyBucket{start: time.Unix(start, 0)}
+			buckets[start] = bucket
+		}
+		bucket.count++
+		bucket.temperature += p.Temperature
+		bucket.humidity += p.Humidity
+		if p.Battery != nil {
+			bucket.battery += *p.Battery
+			bucket.batteryN++
+		}
+	}
+
+	points := make([]historyPoint, 0, len(buckets))
+	for _, bucket := range buckets {
+		points = append(points, bucket.point())
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+	return points
+}
+
+var (
+	historyStore   *HistoryStore
+	historyStoreMu = &sync.RWMutex{}
+)
+
+// applyHistoryConfig opens, reopens or closes the history store to match the config
+func applyHistoryConfig(config *Config) {
+	historyStoreMu.Lock()
+	defer historyStoreMu.Unlock()
+
+	if !config.History.Enabled {
+		if historyStore != nil {
+			if err := historyStore.Flush(); err != nil {
+				log.Printf("History: failed to flush pending samples: %v", err)
+			}
+			historyStore = nil
+			log.Println("History: Disabled")
+		}
+		return
+	}
+
+	dir := filepath.Join(config.DataDir, "history")
+	resolution := parseDuration(config.History.Resolution)
+	retention := parseDuration(config.History.Retention)
+	if historyStore != nil && historyStore.dir == dir &&
+		historyStore.resolution == resolution && historyStore.retention == retention {
+		return
+	}
+
+	store, err := NewHistoryStore(dir, resolution, retention)
+	if err != nil {
+		log.Printf("History: failed to open store: %v", err)
+		return
+	}
+	if historyStore != nil {
+		if err := historyStore.Flush(); err != nil {
+			log.Printf("History: failed to flush pending samples: %v", err)
+		}
+	}
+	historyStore = store
+	log.Printf("History: Enabled (dir: %s, resolution: %v, retention: %v)", dir, resolution, retention)
+}
+
+// recordHistory stores a sample of a device if the history store is enabled
+func recordHistory(device string, temperature, humidity float64, battery *int) {
+	recordHistorySeries(deviceHistorySeries(device), device, temperature, humidity, battery)
+}
+
+// recordOpenMeteoHistory stores an OpenMeteo reading if the history store is enabled
+func recordOpenMeteoHistory(temperature, humidity float64) {
+	recordHistorySeries(openMeteoHistorySeries, openMeteoHistoryName, temperature, humidity, nil)
+}
+
+func recordHistorySeries(series, name string, temperature, humidity float64, battery *int) {
+	historyStoreMu.RLock()
+	store := historyStore
+	historyStoreMu.RUnlock()
+
+	if store == nil {
+		return
+	}
+	if err := store.Record(series, time.Now(), temperature, humidity, battery); err != nil {
+		log.Printf("History: failed to record sample for '%s': %v", name, err)
+	}
+}
+
+// renameHistory moves the history of renamed devices, keyed by old name, if the
+// history store is enabled. Every series is first moved to a temporary name, so
+// devices that swap names or pass one along do not merge into each other's
+// history.
+func renameHistory(renames map[string]string) {
+	historyStoreMu.RLock()
+	store := historyStore
+	historyStoreMu.RUnlock()
+
+	if store == nil {
+		return
+	}
+	staged := make(map[string]string, len(renames))
+	for from := range renames {
+		// A leading "." is escaped in device series, so this cannot collide
+		temp := fmt.Sprintf(".rename-%d", len(staged))
+		if err := store.Rename(deviceHistorySeries(from), temp); err != nil {
+			log.Printf("History: failed to move the history of '%s' to '%s': %v", from, renames[from], err)
+			continue
+		}
+		staged[from] = temp
+	}
+	for from, temp := range staged {
+		to := renames[from]
+		if err := store.Rename(temp, deviceHistorySeries(to)); err != nil {
+			log.Printf("History: failed to move the history of '%s' to '%s': %v", from, to, err)
+		}
+	}
+}
+
+// maintainHistory flushes completed buckets and prunes expired files
+func maintainHistory(now time.Time, prune bool) {
+	historyStoreMu.RLock()
+	store := historyStore
+	historyStoreMu.RUnlock()
+
+	if store == nil {
+		return
+	}
+	if err := store.FlushCompleted(now); err != nil {
+		log.Printf("History: failed to flush samples: %v", err)
+	}
+	if prune {
+		if err := store.Prune(now); err != nil {
+			log.Printf("History: failed to prune old samples: %v", err)
+		}
+	}
+}
+
+// flushHistory writes out all pending samples, e.g. on shutdown
+func flushHistory() {
+	historyStoreMu.RLock()
+	store := historyStore
+	historyStoreMu.RUnlock()
+
+	if store == nil {
+		return
+	}
+	if err := store.Flush(); err != nil {
+		log.Printf("History: failed to flush pending samples: %v", err)
+	}
+}
+
+// parseHistoryTime accepts RFC 3339 timestamps or Unix seconds
+func parseHistoryTime(s string, fallback time.Time) (time.Time, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(seconds)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseHistoryStep accepts Go durations ("5m") or seconds ("300")
+func parseHistoryStep(s string, fallback time.Duration) (time.Duration, error) {
+	if s == "" {
+		return fallback, nil
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// historySeries is one metric of a device as [unix seconds, value] pairs
+type historySeries struct {
+	Metric string       `json:"metric"`
+	Points [][2]float64 `json:"points"`
+}
+
+// historyResponse is the JSON body returned by /api/history
+type historyResponse struct {
+	Device string          `json:"device"`
+	From   int64           `json:"from"`
+	To     int64           `json:"to"`
+	Step   float64         `json:"step"`
+	Series []historySeries `json:"series"`
+}
+
+// handleHistory serves /api/history?device=...&from=...&to=...&step=...
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	historyStoreMu.RLock()
+	store := historyStore
+	historyStoreMu.RUnlock()
+	if store == nil {
+		http.Error(w, "History store is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	device := query.Get("device")
+	if device == "" {
+		http.Error(w, "Missing device parameter", http.StatusBadRequest)
+		return
+	}
+	key := openMeteoHistorySeries
+	if device != openMeteoHistoryName {
+		if !isKnownDeviceName(device) {
+			http.Error(w, "Unknown device "+device, http.StatusNotFound)
+			return
+		}
+		key = deviceHistorySeries(device)
+	}
+
+	to, err := parseHistoryTime(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, "Invalid to parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, err := parseHistoryTime(query.Get("from"), to.Add(-defaultHistoryWindow))
+	if err != nil {
+		http.Error(w, "Invalid from parameter: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+	step, err := parseHistoryStep(query.Get("step"), store.resolution)
+	if err != nil || step <= 0 {
+		http.Error(w, "Invalid step parameter", http.StatusBadRequest)
+		return
+	}
+	if step < store.resolution {
+		step = store.resolution
+	}
+	if to.Sub(from)/step > maxHistoryPoints {
+		http.Error(w, fmt.Sprintf("Query would return more than %d points, increase step", maxHistoryPoints), http.StatusBadRequest)
+		return
+	}
+
+	points, err := store.Query(key, from, to, step)
+	if err != nil {
+		log.Printf("History: query for '%s' failed: %v", device, err)
+		http.Error(w, "Failed to read history", http.StatusInternalServerError)
+		return
+	}
+
+	temperature := historySeries{Metric: "temperature", Points: [][2]float64{}}
+	humidity := historySeries{Metric: "humidity", Points: [][2]float64{}}
+	battery := historySeries{Metric: "battery", Points: [][2]float64{}}
+	for _, p := range points {
+		t := float64(p.Timestamp)
+		temperature.Points = append(temperature.Points, [2]float64{t, p.Temperature})
+		humidity.Points = append(humidity.Points, [2]float64{t, p.Humidity})
+		if p.Battery != nil {
+			battery.Points = append(battery.Points, [2]float64{t, *p.Battery})
+		}
+	}
+
+	series := []historySeries{temperature, humidity}
+	if device != openMeteoHistoryName {
+		series = append(series, battery)
+	}
+
+	writeJSON(w, http.StatusOK, historyResponse{
+		Device: device,
+		From:   from.Unix(),
+		To:     to.Unix(),
+		Step:   step.Seconds(),
+		Series: series,
+	})
+}
+
+// isKnownDeviceName reports whether a device with this name is configured
+func isKnownDeviceName(name string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, govee := range knownGovees {
+		if govee.Name == name {
+			return true
+		}
+	}
+	return false
+}
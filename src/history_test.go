@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreRecordAndQuery(t *testing.T) {
+	store, err := NewHistoryStore(t.TempDir(), time.Minute, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("NewHistoryStore: %v", err)
+	}
+
+	base := time.Date(2025, 3, 1, 23, 58, 0, 0, time.UTC)
+	battery := 90
+	samples := []struct {
+		offset   time.Duration
+		temp     float64
+		humidity float64
+	}{
+		{0, 20, 40},
+		{30 * time.Second, 22, 42}, // same minute -> averaged to 21/41
+		{1 * time.Minute, 24, 44},
+		{2 * time.Minute, 26, 46}, // crosses midnight into the next day file
+		{3 * time.Minute, 28, 48}, // still pending in memory
+	}
+	for _, s := range samples {
+		if err := store.Record("Office", base.Add(s.offset), s.temp, s.humidity, &battery); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	points, err := store.Query("Office", base.Add(-time.Hour), base.Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	wantTemps := []float64{21, 24, 26, 28}
+	if len(points) != len(wantTemps) {
+		t.Fatalf("got %d points, want %d: %+v", len(points), len(wantTemps), points)
+	}
+	for i, want := range wantTemps {
+		if points[i].Temperature != want {
+			t.Errorf("point %d temperature = %v, want %v", i, points[i].Temperature, want)
+		}
+		if points[i].Battery == nil || *points[i].Battery != 90 {
+			t.Errorf("point %d battery = %v, want 90", i, points[i].Battery)
+		}
+	}
+
+	// Downsample to 2 minute buckets: (21+24)/2 and (26+28)/2
+	points, err = store.Query("Office", base.Add(-time.Hour), base.Add(time.Hour), 2*time.Minute)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(points) != 2 || points[0].Temperature != 22.5 || points[1].Temperature != 27 {
+		t.Errorf("downsampled points = %+v, want temperatures 22.5 and 27", points)
+	}
+
+	if _, err := os.Stat(filepath.Join(store.dir, "Office", "2025-03-02.jsonl")); err != nil {
+		t.Errorf("expected a day file for the second day: %v", err)
+	}
+}
+
+func TestHistoryStoreRename(t *testing.T) {
+	store, err := NewHistoryStore(t.TempDir(), time.Minute, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("NewHistoryStore: %v", err)
+	}
+
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, s := range []struct {
+		device string
+		offset time.Duration
+		temp   float64
+	}{
+		{"Study", 0, 18}, // History already stored under the new name
+		{"Office", time.Minute, 20},
+		{"Office", 2 * time.Minute, 22},
+	} {
+		if err := store.Record(s.device, base.Add(s.offset), s.temp, 50, nil); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	// A sample still pending in memory moves too
+	if err := store.Record("Office", base.Add(3*time.Minute), 24, 50, nil); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	if err := store.Rename("Office", "Study"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+
+	points, err := store.Query("Study", base.Add(-time.Hour), base.Add(time.Hour), time.Minute)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(points) != 4 || points[0].Temperature != 18 || points[3].Temperature != 24 {
+		t.Errorf("points after rename = %+v, want 18, 20, 22 and 24", points)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, "Office")); !os.IsNotExist(err) {
+		t.Errorf("old history directory still exists: %v", err)
+	}
+	if err := store.Rename("Cellar", "Basement"); err != nil {
+		t.Errorf("Rename of a device without history: %v", err)
+	}
+}
+
+func TestHistoryStorePrune(t *testing.T) {
+	store, err := NewHistoryStore(t.TempDir(), time.Minute, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("NewHistoryStore: %v", err)
+	}
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	for _, day := range []time.Time{now.AddDate(0, 0, -5), now.AddDate(0, 0, -2), now} {
+		if err := store.Record("Office", day, 20, 50, nil); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if err := store.Prune(now); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+
+	for day, want := range map[string]bool{"2025-03-05": false, "2025-03-08": true, "2025-03-10": true} {
+		_, err := os.Stat(filepath.Join(store.dir, "Office", day+".jsonl"))
+		if exists := err == nil; exists != want {
+			t.Errorf("day file %s exists = %v, want %v", day, exists, want)
+		}
+	}
+}
+
+func TestNewHistoryStoreValidation(t *testing.T) {
+	if _, err := NewHistoryStore(t.TempDir(), 100*time.Millisecond, time.Hour); err == nil {
+		t.Error("expected error for sub-second resolution")
+	}
+	if _, err := NewHistoryStore(t.TempDir(), time.Hour, time.Minute); err == nil {
+		t.Error("expected error for retention shorter than resolution")
+	}
+}
+
+func TestDeviceHistorySeries(t *testing.T) {
+	for device, want := range map[string]string{
+		"Office":     "Office",
+		"Attic/Loft": "Attic%2FLoft",
+		".":          "%2E",
+		"..":         "%2E.",
+		".openmeteo": "%2Eopenmeteo",
+		"openmeteo":  "openmeteo",
+	} {
+		if got := deviceHistorySeries(device); got != want {
+			t.Errorf("deviceHistorySeries(%q) = %q, want %q", device, got, want)
+		}
+	}
+
+}
+
+func TestHandleHistory(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	mutex.Lock()
+	knownGovees["AA:BB:CC:DD:EE:01"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Office"}
+	mutex.Unlock()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleHistory(rec, httptest.NewRequest(http.MethodGet, "/api/history?"+query, nil))
+		return rec
+	}
+
+	if rec := get("device=Office"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("disabled store: status = %d, want 503", rec.Code)
+	}
+
+	config := &Config{DataDir: t.TempDir()}
+	config.History.Enabled = true
+	config.History.Resolution = "1m"
+	config.History.Retention = "24h"
+	applyHistoryConfig(config)
+	t.Cleanup(func() { applyHistoryConfig(&Config{}) })
+
+	recordHistory("Office", 21.5, 45, nil)
+	recordOpenMeteoHistory(9.5, 80)
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"device=Garage", http.StatusNotFound},
+		{"device=Office&from=yesterday", http.StatusBadRequest},
+		{"device=Office&from=2000&to=1000", http.StatusBadRequest},
+		{"device=Office&step=1s&from=0&to=2592000", http.StatusBadRequest}, // 43200 points
+		{"device=Office", http.StatusOK},
+		{"device=openmeteo&step=300", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := get(tt.query); rec.Code != tt.code {
+			t.Errorf("%q: status = %d, want %d (%s)", tt.query, rec.Code, tt.code, rec.Body.String())
+		}
+	}
+
+	rec := get("device=Office")
+	var resp historyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Series) != 3 || resp.Series[0].Metric != "temperature" || len(resp.Series[0].Points) != 1 || resp.Series[0].Points[0][1] != 21.5 {
+		t.Errorf("unexpected response: %s", rec.Body.String())
+	}
+	if resp.Step != 60 {
+		t.Errorf("step = %v, want 60", resp.Step)
+	}
+}
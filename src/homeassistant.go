@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// haDiscoveryStateFile lists the retained discovery topics published, under
+// dataDir, so entries of devices removed while the exporter was down are still
+// cleared after a restart
+const haDiscoveryStateFile = "homeassistant-discovery.json"
+
+// haSensor describes one Home Assistant entity published for every device
+type haSensor struct {
+	key            string // field of mqttStatePayload and suffix of the unique ID
+	name           string
+	deviceClass    string
+	unit           string
+	entityCategory string
+}
+
+var haSensors = []haSensor{
+	{key: "temperature", name: "Temperature", deviceClass: "temperature", unit: "°C"},
+	{key: "humidity", name: "Humidity", deviceClass: "humidity", unit: "%"},
+	{key: "battery", name: "Battery", deviceClass: "battery", unit: "%", entityCategory: "diagnostic"},
+}
+
+// haAvailability is one entry of a discovery message's availability list
+type haAvailability struct {
+	Topic         string `json:"topic"`
+	ValueTemplate string `json:"value_template,omitempty"`
+}
+
+// haDevice groups the entities of one sensor into a Home Assistant device
+type haDevice struct {
+	Identifiers   []string    `json:"identifiers"`
+	Connections   [][2]string `json:"connections"`
+	Name          string      `json:"name"`
+	Manufacturer  string      `json:"manufacturer"`
+	Model         string      `json:"model,omitempty"`
+	SuggestedArea string      `json:"suggested_area,omitempty"`
+}
+
+// haDiscoveryConfig is the payload of a homeassistant/sensor/.../config message
+type haDiscoveryConfig struct {
+	Name              string           `json:"name"`
+	UniqueID          string           `json:"unique_id"`
+	StateTopic        string           `json:"state_topic"`
+	ValueTemplate     string           `json:"value_template"`
+	DeviceClass       string           `json:"device_class"`
+	UnitOfMeasurement string           `json:"unit_of_measurement"`
+	StateClass        string           `json:"state_class"`
+	EntityCategory    string           `json:"entity_category,omitempty"`
+	Availability      []haAvailability `json:"availability,omitempty"`
+	AvailabilityMode  string           `json:"availability_mode,omitempty"`
+	Device            haDevice         `json:"device"`
+}
+
+// haNodeID identifies a sensor in discovery topics and unique IDs
+func haNodeID(mac string) string {
+	return "govee_" + strings.ToLower(strings.ReplaceAll(mac, ":", ""))
+}
+
+// haConfigTopic is the discovery topic of one entity of a sensor
+func haConfigTopic(prefix, mac, key string) string {
+	return prefix + "/sensor/" + haNodeID(mac) + "/" + key + "/config"
+}
+
+// haDiscoveryMessages builds the retained discovery messages for one sensor
+func haDiscoveryMessages(settings MQTTConfig, govee KnownGovee) ([]mqttMessage, error) {
+	displayName := govee.DisplayName
+	if displayName == "" {
+		displayName = govee.Name
+	}
+	device := haDevice{
+		Identifiers:   []string{haNodeID(govee.MAC)},
+		Connections:   [][2]string{{"mac", strings.ToLower(govee.MAC)}},
+		Name:          displayName,
+		Manufacturer:  "Govee",
+		Model:         govee.Model,
+		SuggestedArea: govee.Group,
+	}
+
+	var availability []haAvailability
+	if settings.AvailabilityTopic != "" {
+		availability = append(availability, haAvailability{Topic: settings.AvailabilityTopic})
+	}
+	// Status messages only mark entities unavailable if HA can read them after a restart
+	if settings.StatusTopic != "" && settings.Retain {
+		availability = append(availability, haAvailability{
+			Topic:         renderTopic(settings.StatusTopic, govee),
+			ValueTemplate: "{{ 'online' if value_json.status == 'active' else 'offline' }}",
+		})
+	}
+	availabilityMode := ""
+	if len(availability) > 1 {
+		availabilityMode = "all"
+	}
+
+	stateTopic := renderTopic(settings.Topic, govee)
+	messages := make([]mqttMessage, 0, len(haSensors))
+	for _, sensor := range haSensors {
+		payload, err := json.Marshal(haDiscoveryConfig{
+			Name:              sensor.name,
+			UniqueID:          haNodeID(govee.MAC) + "_" + sensor.key,
+			StateTopic:        stateTopic,
+			ValueTemplate:     "{{ value_json." + sensor.key + " }}",
+			DeviceClass:       sensor.deviceClass,
+			UnitOfMeasurement: sensor.unit,
+			StateClass:        "measurement",
+			EntityCategory:    sensor.entityCategory,
+			Availability:      availability,
+			AvailabilityMode:  availabilityMode,
+			Device:            device,
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, mqttMessage{
+			topic:   haConfigTopic(settings.HomeAssistant.Prefix, govee.MAC, sensor.key),
+			payload: payload,
+			retain:  true,
+		})
+	}
+	return messages, nil
+}
+
+// loadHomeAssistantTopics reads the discovery topics recorded in path; a
+// missing file means none were published
+func loadHomeAssistantTopics(path string) map[string]struct{} {
+	topics := make(map[string]struct{})
+	if path == "" {
+		return topics
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return topics
+	}
+	var list []string
+	if err == nil {
+		err = json.Unmarshal(data, &list)
+	}
+	if err != nil {
+		log.Printf("MQTT: Failed to read %s: %v", path, err)
+		return topics
+	}
+	for _, topic := range list {
+		topics[topic] = struct{}{}
+	}
+	return topics
+}
+
+// saveHomeAssistantTopics records the published discovery topics in path
+func saveHomeAssistantTopics(path string, topics map[string]struct{}) error {
+	list := make([]string, 0, len(topics))
+	for topic := range topics {
+		list = append(list, topic)
+	}
+	sort.Strings(list)
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, append(data, '\n'), 0o644)
+}
+
+// syncHomeAssistantDiscovery publishes discovery messages for every configured
+// sensor and clears every other retained discovery message it knows of: those
+// of removed sensors, of an earlier prefix, or all of them once discovery is
+// disabled
+func (p *mqttPublisher) syncHomeAssistantDiscovery(devices map[string]KnownGovee) {
+	p.haMu.Lock()
+	defer p.haMu.Unlock()
+
+	published := make(map[string]struct{})
+	if p.settings.HomeAssistant.Enabled {
+		for _, govee := range devices {
+			messages, err := haDiscoveryMessages(p.settings, govee)
+			if err != nil {
+				log.Printf("MQTT: Failed to encode Home Assistant discovery for '%s': %v", govee.Name, err)
+				continue
+			}
+			for _, msg := range messages {
+				p.enqueue(msg)
+				published[msg.topic] = struct{}{}
+			}
+		}
+	}
+
+	removed := 0
+	for topic := range p.haTopics {
+		if _, ok := published[topic]; !ok {
+			// An empty retained message removes the entity from Home Assistant
+			p.enqueue(mqttMessage{topic: topic, retain: true})
+			removed++
+		}
+	}
+	if removed > 0 {
+		log.Printf("MQTT: Removed %d Home Assistant discovery entities", removed)
+	}
+
+	changed := removed > 0 || len(published) != len(p.haTopics)
+	p.haTopics = published
+	if changed && p.haStatePath != "" {
+		if err := saveHomeAssistantTopics(p.haStatePath, published); err != nil {
+			log.Printf("MQTT: Failed to record Home Assistant discovery topics: %v", err)
+		}
+	}
+}
+
+// homeAssistantTopics returns the discovery topics the publisher has published
+func (p *mqttPublisher) homeAssistantTopics() map[string]struct{} {
+	p.haMu.Lock()
+	defer p.haMu.Unlock()
+	return p.haTopics
+}
+
+// publishHomeAssistantDiscovery syncs Home Assistant discovery with the configured
+// sensors; virtual devices are not published over MQTT
+func publishHomeAssistantDiscovery() {
+	mutex.Lock()
+	devices := make(map[string]KnownGovee, len(knownGovees))
+	for mac, govee := range knownGovees {
+		if govee.Virtual == nil {
+			devices[mac] = mqttDeviceLocked(govee)
+		}
+	}
+	mutex.Unlock()
+
+	mqttPublisherMu.RLock()
+	defer mqttPublisherMu.RUnlock()
+	if activeMQTT != nil {
+		activeMQTT.syncHomeAssistantDiscovery(devices)
+	}
+}
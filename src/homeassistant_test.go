@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func haTestSettings() MQTTConfig {
+	settings := MQTTConfig{
+		Broker:            "tcp://broker:1883",
+		Retain:            true,
+		Topic:             "govee/{{group}}/{{name}}/state",
+		StatusTopic:       "govee/{{name}}/status",
+		AvailabilityTopic: "govee/availability",
+	}
+	settings.HomeAssistant.Enabled = true
+	settings.HomeAssistant.Prefix = "homeassistant"
+	return settings
+}
+
+func TestHADiscoveryMessages(t *testing.T) {
+	govee := KnownGovee{MAC: "A4:C1:38:E0:0F:54", Name: "Office", DisplayName: "Office Desk", Group: "Upstairs", Model: "H5075"}
+	messages, err := haDiscoveryMessages(haTestSettings(), govee)
+	if err != nil {
+		t.Fatalf("haDiscoveryMessages: %v", err)
+	}
+	if len(messages) != len(haSensors) {
+		t.Fatalf("got %d messages, want %d", len(messages), len(haSensors))
+	}
+
+	msg := messages[0]
+	if msg.topic != "homeassistant/sensor/govee_a4c138e00f54/temperature/config" || !msg.retain {
+		t.Errorf("topic = %q retain = %v", msg.topic, msg.retain)
+	}
+	var config haDiscoveryConfig
+	if err := json.Unmarshal(msg.payload, &config); err != nil {
+		t.Fatalf("decode discovery payload: %v", err)
+	}
+	if config.UniqueID != "govee_a4c138e00f54_temperature" || config.StateTopic != "govee/Upstairs/Office/state" ||
+		config.ValueTemplate != "{{ value_json.temperature }}" || config.DeviceClass != "temperature" || config.UnitOfMeasurement != "°C" {
+		t.Errorf("unexpected entity config %s", msg.payload)
+	}
+	if config.Device.Name != "Office Desk" || config.Device.SuggestedArea != "Upstairs" || config.Device.Model != "H5075" ||
+		len(config.Device.Connections) != 1 || config.Device.Connections[0] != [2]string{"mac", "a4:c1:38:e0:0f:54"} {
+		t.Errorf("unexpected device %+v", config.Device)
+	}
+	if len(config.Availability) != 2 || config.Availability[1].Topic != "govee/Office/status" || config.AvailabilityMode != "all" {
+		t.Errorf("unexpected availability %+v (%s)", config.Availability, config.AvailabilityMode)
+	}
+
+	// Non-retained status messages are not used for availability
+	settings := haTestSettings()
+	settings.Retain = false
+	messages, _ = haDiscoveryMessages(settings, govee)
+	var unretained haDiscoveryConfig
+	if err := json.Unmarshal(messages[0].payload, &unretained); err != nil {
+		t.Fatalf("decode discovery payload: %v", err)
+	}
+	if len(unretained.Availability) != 1 || unretained.AvailabilityMode != "" {
+		t.Errorf("availability without retain = %+v (%s)", unretained.Availability, unretained.AvailabilityMode)
+	}
+}
+
+func TestHADiscoveryFollowsConfigReload(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	config := &Config{}
+	config.Metrics.StaleThreshold = "5m"
+	config.Devices = []Device{
+		{MAC: "A4:C1:38:00:00:01", Name: "Office"},
+		{MAC: "A4:C1:38:00:00:02", Name: "Attic"},
+	}
+	loadKnownGovees(config)
+
+	client, _ := withFakeMQTT(t, haTestSettings())
+
+	// Reload without the attic sensor
+	config.Devices = config.Devices[:1]
+	loadKnownGovees(config)
+	stopMQTT(context.Background())
+
+	discovered := map[string]int{}
+	removed := map[string]int{}
+	for _, msg := range client.messages() {
+		if !strings.HasPrefix(msg.topic, "homeassistant/") {
+			continue
+		}
+		if !msg.retain {
+			t.Errorf("discovery message %s not retained", msg.topic)
+		}
+		node := strings.Split(msg.topic, "/")[2]
+		if msg.payload == "" {
+			removed[node]++
+		} else {
+			discovered[node]++
+		}
+	}
+
+	if discovered["govee_a4c138000001"] != 2*len(haSensors) || discovered["govee_a4c138000002"] != len(haSensors) {
+		t.Errorf("discovery messages per sensor = %v", discovered)
+	}
+	if len(removed) != 1 || removed["govee_a4c138000002"] != len(haSensors) {
+		t.Errorf("removal messages per sensor = %v, want only the attic", removed)
+	}
+}
+
+func TestHADiscoveryFollowsDetectedModel(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Cleanup(func() { deleteDeviceSeriesLocked("Freezer") })
+
+	config := &Config{}
+	config.Metrics.StaleThreshold = "5m"
+	config.Devices = []Device{{MAC: "A4:C1:38:00:00:01", Name: "Freezer"}}
+	loadKnownGovees(config)
+
+	settings := haTestSettings()
+	settings.Topic = "govee/{{model}}/{{name}}/state"
+	settings.StatusTopic = "govee/{{model}}/{{name}}/status"
+	client, _ := withFakeMQTT(t, settings)
+
+	// The model is not configured; scanCallback detects it from the advertisement
+	mutex.Lock()
+	govee := knownGovees["A4:C1:38:00:00:01"]
+	mutex.Unlock()
+	govee.Model = "H5179"
+	if !parseGoveeData(govee, []byte{0x01, 0x00, 0x01, 0x01, 0x29, 0x09, 0xBF, 0x15, 0x5A}) {
+		t.Fatal("reading rejected")
+	}
+	stopMQTT(context.Background())
+
+	var discovery haDiscoveryConfig
+	var stateTopics []string
+	for _, msg := range client.messages() {
+		if msg.topic == "homeassistant/sensor/govee_a4c138000001/temperature/config" && msg.payload != "" {
+			if err := json.Unmarshal([]byte(msg.payload), &discovery); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if strings.HasSuffix(msg.topic, "/state") {
+			stateTopics = append(stateTopics, msg.topic)
+		}
+	}
+	if discovery.StateTopic != "govee/H5179/Freezer/state" || discovery.Device.Model != "H5179" {
+		t.Errorf("last discovery = state topic %q, model %q, want the detected H5179", discovery.StateTopic, discovery.Device.Model)
+	}
+	if len(discovery.Availability) != 2 || discovery.Availability[1].Topic != "govee/H5179/Freezer/status" {
+		t.Errorf("availability = %+v, want the status topic of the detected model", discovery.Availability)
+	}
+	if len(stateTopics) != 1 || stateTopics[0] != discovery.StateTopic {
+		t.Errorf("readings published on %v, want %s", stateTopics, discovery.StateTopic)
+	}
+}
+
+func TestHADiscoveryDisabled(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	mutex.Lock()
+	knownGovees["A4:C1:38:00:00:01"] = KnownGovee{MAC: "A4:C1:38:00:00:01", Name: "Office"}
+	mutex.Unlock()
+
+	settings := haTestSettings()
+	settings.HomeAssistant.Enabled = false
+	client, _ := withFakeMQTT(t, settings)
+	publishHomeAssistantDiscovery()
+	stopMQTT(context.Background())
+
+	for _, msg := range client.messages() {
+		if strings.HasPrefix(msg.topic, "homeassistant/") {
+			t.Errorf("published %s with discovery disabled", msg.topic)
+		}
+	}
+}
+
+func TestHADiscoveryClearsPrefixChangeAndRemovalsAcrossRestarts(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	client := &fakeMQTTClient{}
+	orig := newMQTTClient
+	newMQTTClient = func(*mqtt.ClientOptions) mqttPublishClient { return client }
+	t.Cleanup(func() {
+		stopMQTT(context.Background())
+		newMQTTClient = orig
+	})
+
+	config := &Config{DataDir: t.TempDir()}
+	config.MQTT = haTestSettings()
+	config.MQTT.Enabled = true
+	config.Devices = []Device{
+		{MAC: "A4:C1:38:00:00:01", Name: "Office"},
+		{MAC: "A4:C1:38:00:00:02", Name: "Attic"},
+	}
+	loadKnownGovees(config)
+	applyMQTTConfig(config)
+
+	// A new prefix moves every entity
+	config.MQTT.HomeAssistant.Prefix = "ha"
+	applyMQTTConfig(config)
+	stopMQTT(context.Background())
+
+	cleared := func() map[string]bool {
+		topics := map[string]bool{}
+		for _, msg := range client.messages() {
+			if msg.retain && msg.payload == "" && strings.HasSuffix(msg.topic, "/config") {
+				topics[msg.topic] = true
+			}
+		}
+		return topics
+	}
+	if got := cleared(); len(got) != 2*len(haSensors) || !got["homeassistant/sensor/govee_a4c138000001/temperature/config"] {
+		t.Errorf("cleared after prefix change = %v, want every entity under the old prefix", got)
+	}
+
+	// After a restart, the attic removed from the config is still cleared
+	client.mu.Lock()
+	client.published = nil
+	client.mu.Unlock()
+	config.Devices = config.Devices[:1]
+	loadKnownGovees(config)
+	applyMQTTConfig(config)
+	stopMQTT(context.Background())
+
+	got := cleared()
+	if len(got) != len(haSensors) || !got["ha/sensor/govee_a4c138000002/humidity/config"] {
+		t.Errorf("cleared after restart = %v, want the attic's entities", got)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// listenerDrainTimeout bounds how long a retired listener may finish its
+// in-flight requests after the port changed
+const listenerDrainTimeout = 5 * time.Second
+
+// reloadableServer serves the HTTP handler on the configured port and moves to
+// a new port on config reload without dropping the old one until the new one is bound
+type reloadableServer struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	handler http.Handler
+	onError func(error)
+
+	port   string
+	server *http.Server
+	cancel context.CancelFunc // Ends the request contexts of the current server
+}
+
+func newReloadableServer(ctx context.Context, handler http.Handler, onError func(error)) *reloadableServer {
+	return &reloadableServer{ctx: ctx, handler: handler, onError: onError}
+}
+
+// listen binds port and starts serving on it, then gracefully retires the
+// previous listener. On error the previous listener keeps serving.
+func (s *reloadableServer) listen(port string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil && port == s.port {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+
+	// Request contexts derive from serverCtx so long-lived /api/events streams
+	// end when this listener is retired instead of holding up its shutdown
+	serverCtx, cancel := context.WithCancel(s.ctx)
+	server := &http.Server{
+		Handler:     s.handler,
+		BaseContext: func(net.Listener) context.Context { return serverCtx },
+	}
+	go func() {
+		if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) && s.onError != nil {
+			s.onError(err)
+		}
+	}()
+
+	previous, previousCancel, previousPort := s.server, s.cancel, s.port
+	s.server, s.cancel, s.port = server, cancel, port
+
+	if previous != nil {
+		log.Printf("HTTP server: Moved from port %s to %s", previousPort, port)
+		go func() {
+			previousCancel()
+			ctx, done := context.WithTimeout(context.Background(), listenerDrainTimeout)
+			defer done()
+			if err := previous.Shutdown(ctx); err != nil {
+				log.Printf("HTTP server: Error closing port %s: %v", previousPort, err)
+			}
+		}()
+	}
+	return nil
+}
+
+// applyConfig moves the listener when server.port changed
+func (s *reloadableServer) applyConfig(config *Config) {
+	if err := s.listen(config.Server.Port); err != nil {
+		log.Printf("HTTP server: Cannot listen on port %s, keeping port %s: %v", config.Server.Port, s.currentPort(), err)
+	}
+}
+
+// currentPort returns the port being served
+func (s *reloadableServer) currentPort() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.port
+}
+
+// shutdown gracefully stops the current listener
+func (s *reloadableServer) shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	s.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a TCP port that was free a moment ago
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestReloadableServerMovesPort(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, "OK") })
+	server := newReloadableServer(ctx, handler, func(err error) { t.Errorf("server error: %v", err) })
+	t.Cleanup(func() { server.shutdown(context.Background()) })
+
+	get := func(port string) error {
+		client := &http.Client{Timeout: time.Second}
+		resp, err := client.Get("http://127.0.0.1:" + port + "/")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	first := freePort(t)
+	if err := server.listen(first); err != nil {
+		t.Fatalf("listen %s: %v", first, err)
+	}
+	if err := get(first); err != nil {
+		t.Fatalf("GET on %s: %v", first, err)
+	}
+
+	// A port that is already taken leaves the current listener in place
+	busy, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	config := &Config{}
+	config.Server.Port = strconv.Itoa(busy.Addr().(*net.TCPAddr).Port)
+	server.applyConfig(config)
+	if server.currentPort() != first {
+		t.Fatalf("port = %s after a failed move, want %s", server.currentPort(), first)
+	}
+
+	second := freePort(t)
+	config.Server.Port = second
+	server.applyConfig(config)
+	if err := get(second); err != nil {
+		t.Fatalf("GET on %s: %v", second, err)
+	}
+
+	// The old port is released once its requests have drained
+	deadline := time.Now().Add(2 * time.Second)
+	for get(first) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("port %s still serving after the move", first)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// labelNamePattern matches a valid Prometheus label name
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabelNames are used by the exporter's own device metrics, so custom
+// labels cannot take them
+var reservedLabelNames = map[string]bool{
+	"name": true, "status": true, "from": true, "to": true, "reason": true, "rule": true,
+	"mac": true, "display_name": true, "group": true, "model": true,
+	"temperature_calibration": true, "humidity_calibration": true,
+	"temperature_offset": true, "humidity_offset": true,
+}
+
+var deviceInfoGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "govee_device_info",
+		Help: "Configuration of each Govee device, for joins on name (always 1)",
+	},
+	[]string{"name", "mac", "display_name", "group", "model", "temperature_calibration", "humidity_calibration", "temperature_offset", "humidity_offset"},
+)
+
+// labelNameProblem describes why a custom label name cannot be used, or returns ""
+func labelNameProblem(key string) string {
+	switch {
+	case !labelNamePattern.MatchString(key) || strings.HasPrefix(key, "__"):
+		return "is not a valid label name"
+	case reservedLabelNames[key]:
+		return "is reserved by the exporter"
+	}
+	return ""
+}
+
+// resolveLabels merges the global labels with a device's own, skipping invalid names
+func resolveLabels(global, device map[string]string, context string) map[string]string {
+	if len(global) == 0 && len(device) == 0 {
+		return nil
+	}
+	labels := make(map[string]string, len(global)+len(device))
+	for _, set := range []map[string]string{global, device} {
+		for key, value := range set {
+			if problem := labelNameProblem(key); problem != "" {
+				log.Printf("Warning: Ignoring label '%s' for %s: it %s", key, context, problem)
+				continue
+			}
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// validateLabels rejects custom label names that resolveLabels would skip
+func validateLabels(add func(string, ...interface{}), context string, labels map[string]string) {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if problem := labelNameProblem(key); problem != "" {
+			add("%s label '%s' %s", context, key, problem)
+		}
+	}
+}
+
+// setDeviceInfoMetrics exports govee_device_info for the configured devices,
+// dropping the series of devices that changed or were removed
+func setDeviceInfoMetrics(devices map[string]KnownGovee) {
+	deviceInfoGauge.Reset()
+	for mac, govee := range devices {
+		model := govee.Model
+		switch {
+		case govee.Virtual != nil:
+			mac, model = "", "virtual"
+		case model == "":
+			model = "auto"
+		}
+		deviceInfoGauge.WithLabelValues(
+			govee.Name, mac, govee.DisplayName, govee.Group, model,
+			govee.TempCalibration.describe(), govee.HumidityCalibration.describe(),
+			strconv.FormatFloat(govee.TempOffset, 'g', -1, 64), strconv.FormatFloat(govee.HumidityOffset, 'g', -1, 64),
+		).Set(1)
+	}
+}
+
+// deviceLabelGatherer adds the custom labels of each device to every govee_*
+// series whose name label is that device. Doing it at gather time keeps the
+// label set out of the metric vectors, so it can change on reload.
+type deviceLabelGatherer struct {
+	prometheus.Gatherer
+}
+
+func (g deviceLabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+
+	byName := deviceLabelPairs()
+	if len(byName) == 0 {
+		return families, err
+	}
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), "govee_") {
+			continue
+		}
+		for _, metric := range family.Metric {
+			extra := byName[metricDeviceName(metric)]
+			if len(extra) == 0 {
+				continue
+			}
+			metric.Label = append(metric.Label, extra...)
+			sort.Slice(metric.Label, func(i, j int) bool { return metric.Label[i].GetName() < metric.Label[j].GetName() })
+		}
+	}
+	return families, err
+}
+
+// deviceLabelPairs returns the custom labels of the configured devices by name
+func deviceLabelPairs() map[string][]*dto.LabelPair {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	byName := make(map[string][]*dto.LabelPair)
+	for _, govee := range knownGovees {
+		for key, value := range govee.Labels {
+			byName[govee.Name] = append(byName[govee.Name], &dto.LabelPair{Name: &key, Value: &value})
+		}
+	}
+	return byName
+}
+
+// metricDeviceName returns the value of a series' name label
+func metricDeviceName(metric *dto.Metric) string {
+	for _, label := range metric.Label {
+		if label.GetName() == "name" {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+// describeLabels formats custom labels for the device log
+func describeLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%q", key, labels[key])
+	}
+	return strings.Join(pairs, ",")
+}
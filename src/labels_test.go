@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestResolveLabels(t *testing.T) {
+	global := map[string]string{"building": "HQ", "floor": "1"}
+	device := map[string]string{"floor": "2", "room_type": "office", "name": "Desk", "__meta": "x"}
+
+	labels := resolveLabels(global, device, "device 'Office'")
+	want := map[string]string{"building": "HQ", "floor": "2", "room_type": "office"}
+	if len(labels) != len(want) {
+		t.Fatalf("labels = %v, want %v", labels, want)
+	}
+	for key, value := range want {
+		if labels[key] != value {
+			t.Errorf("label %s = %q, want %q", key, labels[key], value)
+		}
+	}
+	if resolveLabels(nil, nil, "device 'Office'") != nil {
+		t.Error("a device without labels should have none")
+	}
+}
+
+// gatheredLabels returns the labels of the first series of family whose name label is name
+func gatheredLabels(t *testing.T, families []*dto.MetricFamily, family, name string) map[string]string {
+	t.Helper()
+	for _, f := range families {
+		if f.GetName() != family {
+			continue
+		}
+		for _, metric := range f.Metric {
+			if metricDeviceName(metric) != name {
+				continue
+			}
+			labels := make(map[string]string)
+			for _, label := range metric.Label {
+				labels[label.GetName()] = label.GetValue()
+			}
+			return labels
+		}
+	}
+	t.Fatalf("no %s series for %s", family, name)
+	return nil
+}
+
+func TestDeviceLabelGatherer(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Cleanup(func() {
+		deleteReadingMetrics("Office")
+		deleteReadingMetrics("Attic")
+		deviceInfoGauge.Reset()
+	})
+
+	config := &Config{Labels: map[string]string{"building": "HQ"}}
+	config.Devices = []Device{
+		{MAC: "AA:BB:CC:DD:EE:01", Name: "Office", Group: "Upstairs", Model: "H5075", Labels: map[string]string{"floor": "2"}},
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "Attic"},
+	}
+	config.Devices[0].Offsets.Temperature = -0.5
+	loadKnownGovees(config)
+	temperatureGauge.WithLabelValues("Office").Set(21.5)
+	temperatureGauge.WithLabelValues("Attic").Set(18)
+
+	families, err := deviceLabelGatherer{prometheus.DefaultGatherer}.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+
+	office := gatheredLabels(t, families, "govee_h5075_temperature", "Office")
+	if office["building"] != "HQ" || office["floor"] != "2" || len(office) != 3 {
+		t.Errorf("Office temperature labels = %v, want building, floor and name", office)
+	}
+	attic := gatheredLabels(t, families, "govee_h5075_temperature", "Attic")
+	if attic["building"] != "HQ" || attic["floor"] != "" {
+		t.Errorf("Attic temperature labels = %v, want only the global label", attic)
+	}
+	status := gatheredLabels(t, families, "govee_device_status", "Office")
+	if status["floor"] != "2" || status["status"] == "" {
+		t.Errorf("Office status labels = %v", status)
+	}
+
+	info := gatheredLabels(t, families, "govee_device_info", "Office")
+	want := map[string]string{
+		"mac": "AA:BB:CC:DD:EE:01", "display_name": "Office", "group": "Upstairs", "model": "H5075",
+		"temperature_calibration": "none", "temperature_offset": "-0.5", "humidity_offset": "0", "floor": "2",
+	}
+	for key, value := range want {
+		if info[key] != value {
+			t.Errorf("govee_device_info %s = %q, want %q", key, info[key], value)
+		}
+	}
+
+	// Removing a device from the config drops its info series
+	config.Devices = config.Devices[:1]
+	loadKnownGovees(config)
+	if deviceInfoGauge.DeleteLabelValues("Attic", "AA:BB:CC:DD:EE:02", "Attic", "", "auto", "none", "none", "0", "0") {
+		t.Error("govee_device_info of a removed device was kept")
+	}
+}
@@ -61,11 +61,23 @@ var (
 )
 
 type KnownGovee struct {
-	Name           string
-	DisplayName    string
-	Group          string
-	TempOffset     float64
-	HumidityOffset float64
+	MAC                 string
+	Name                string
+	DisplayName         string
+	Group               string
+	Model               string // Empty means auto-detect from the advertisement
+	TempOffset          float64
+	HumidityOffset      float64
+	TempCalibration     *calibration // nil means no calibration
+	HumidityCalibration *calibration
+	Filters             FilterConfig
+	StalePolicy         string
+	StaleThreshold      time.Duration // Zero means metrics.staleThreshold
+	StaleMisses         int           // Consecutive checks past the threshold before the device is stale
+	StaleGracePeriod    time.Duration
+	Thresholds          Thresholds        // Resolved from the device, group and global thresholds
+	Labels              map[string]string // Custom metric labels, resolved from the device and global labels
+	Virtual             *virtualSensor    // Set for virtual devices, which are keyed by virtualDeviceKey
 }
 
 type lastLoggedValues struct {
@@ -74,12 +86,15 @@ type lastLoggedValues struct {
 	Battery     int
 }
 
+// Device state is keyed by MAC so it survives a rename; the name is only a metric label
 var (
 	adapter              = bluetooth.DefaultAdapter
 	knownGovees          = make(map[string]KnownGovee)
 	lastUpdateTime       = make(map[string]time.Time)
 	deviceFirstSeen      = make(map[string]time.Time)
 	deviceLastLoggedVals = make(map[string]lastLoggedValues)
+	deviceStatuses       = make(map[string]string)
+	deviceModels         = make(map[string]string) // Model the last accepted reading was decoded as
 	mutex                = &sync.Mutex{}
 	currentConfig        *Config
 	currentConfigMu      = &sync.RWMutex{}
@@ -94,6 +109,20 @@ var (
 		},
 		[]string{"name", "status"},
 	)
+	deviceStatusTransitionsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "govee_device_status_transitions_total",
+			Help: "Status changes of configured Govee devices",
+		},
+		[]string{"name", "from", "to"},
+	)
+	deviceRenamedGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "govee_device_renamed",
+			Help: "Last rename of a configured Govee device, applied by a config reload (always 1)",
+		},
+		[]string{"mac", "from", "to"},
+	)
 )
 
 // Application constants
@@ -112,6 +141,24 @@ func init() {
 	prometheus.MustRegister(openMeteoTemperatureGauge)
 	prometheus.MustRegister(openMeteoHumidityGauge)
 	prometheus.MustRegister(deviceStatusGauge)
+	prometheus.MustRegister(deviceStatusTransitionsCounter)
+	prometheus.MustRegister(deviceRenamedGauge)
+	prometheus.MustRegister(deviceInfoGauge)
+	prometheus.MustRegister(groupCollector{})
+	prometheus.MustRegister(rssiGauge)
+	prometheus.MustRegister(smoothedRSSIGauge)
+	prometheus.MustRegister(advertisementIntervalGauge)
+	prometheus.MustRegister(advertisementsReceivedCounter)
+	prometheus.MustRegister(advertisementsAcceptedCounter)
+	prometheus.MustRegister(advertisementsRejectedCounter)
+	prometheus.MustRegister(readingsRejectedCounter)
+	prometheus.MustRegister(lastSeenGauge)
+	prometheus.MustRegister(derivedMetricsCollectors()...)
+	prometheus.MustRegister(thresholdCollectors()...)
+	prometheus.MustRegister(alertFiringGauge)
+	prometheus.MustRegister(alertNotificationsCounter)
+	prometheus.MustRegister(configLastReloadSuccessGauge)
+	prometheus.MustRegister(configLastReloadTimestampGauge)
 }
 
 // loadKnownGovees loads device configuration from config into the knownGovees map
@@ -122,6 +169,11 @@ func loadKnownGovees(config *Config) {
 	}
 
 	newMap := make(map[string]KnownGovee)
+	global := globalThresholds(config)
+	groups := groupThresholdOverrides(config)
+	stalePolicy := normalizeStalePolicy(config.Metrics.StalePolicy, stalePolicyDelete, "metrics")
+	staleMisses := normalizeStaleMisses(config.Metrics.StaleMisses, defaultStaleMisses, "metrics")
+	staleGracePeriod := parseStaleDuration(config.Metrics.StaleGracePeriod, 0, "metrics", "staleGracePeriod")
 
 	for _, device := range config.Devices {
 		if device.MAC == "" || device.Name == "" {
@@ -134,40 +186,134 @@ func loadKnownGovees(config *Config) {
 			displayName = device.DisplayName
 		}
 
+		model := ""
+		if device.Model != "" {
+			if isSupportedModel(device.Model) {
+				model = normalizeModel(device.Model)
+			} else {
+				log.Printf("Warning: Unsupported model '%s' for device '%s', falling back to auto-detection", device.Model, device.Name)
+			}
+		}
+
+		tempCalibration, err := compileCalibration(device.Calibration.Temperature)
+		if err != nil {
+			log.Printf("Warning: Ignoring temperature calibration for device '%s': %v", device.Name, err)
+		}
+		humidityCalibration, err := compileCalibration(device.Calibration.Humidity)
+		if err != nil {
+			log.Printf("Warning: Ignoring humidity calibration for device '%s': %v", device.Name, err)
+		}
+
+		context := "device '" + device.Name + "'"
+		misses := staleMisses
+		if device.StaleMisses != nil {
+			misses = normalizeStaleMisses(*device.StaleMisses, staleMisses, context)
+		}
+
 		mac := strings.ToUpper(device.MAC)
 		newMap[mac] = KnownGovee{
-			Name:           device.Name,
-			DisplayName:    displayName,
-			Group:          device.Group,
-			TempOffset:     device.Offsets.Temperature,
-			HumidityOffset: device.Offsets.Humidity,
+			MAC:                 mac,
+			Name:                device.Name,
+			DisplayName:         displayName,
+			Group:               device.Group,
+			Model:               model,
+			TempOffset:          device.Offsets.Temperature,
+			HumidityOffset:      device.Offsets.Humidity,
+			TempCalibration:     tempCalibration,
+			HumidityCalibration: humidityCalibration,
+			Filters:             compileFilterConfig(config.Filters, device),
+			StalePolicy:         normalizeStalePolicy(device.StalePolicy, stalePolicy, context),
+			StaleThreshold:      parseStaleDuration(device.StaleThreshold, 0, context, "staleThreshold"),
+			StaleMisses:         misses,
+			StaleGracePeriod:    parseStaleDuration(device.StaleGracePeriod, staleGracePeriod, context, "staleGracePeriod"),
+			Thresholds:          resolveThresholds(global, groups, device),
+			Labels:              resolveLabels(config.Labels, device.Labels, context),
 		}
 	}
 
-	mutex.Lock()
-	// Clean up state for devices that were removed from config
-	existingNames := make(map[string]struct{})
+	// Virtual devices follow the global staleness settings; their inputs decide when they update
+	configuredNames := make(map[string]bool, len(newMap))
 	for _, device := range newMap {
-		existingNames[device.Name] = struct{}{}
-	}
-	for name := range lastUpdateTime {
-		if _, ok := existingNames[name]; !ok {
-			delete(lastUpdateTime, name)
-			delete(deviceFirstSeen, name)
-			for _, status := range statusLabels {
-				deviceStatusGauge.DeleteLabelValues(name, status)
-			}
+		configuredNames[device.Name] = true
+	}
+	for _, device := range config.VirtualDevices {
+		context := "virtual device '" + device.Name + "'"
+		if device.Name == "" || configuredNames[device.Name] {
+			log.Printf("Skipping virtual device with a missing or duplicate name: %+v", device)
+			continue
+		}
+		sensor, err := compileVirtualDevice(device)
+		if err != nil {
+			log.Printf("Skipping %s: %v", context, err)
+			continue
+		}
+		configuredNames[device.Name] = true
+
+		displayName := device.Name
+		if device.DisplayName != "" {
+			displayName = device.DisplayName
+		}
+		key := virtualDeviceKey(device.Name)
+		newMap[key] = KnownGovee{
+			MAC:              key,
+			Name:             device.Name,
+			DisplayName:      displayName,
+			Group:            device.Group,
+			StalePolicy:      stalePolicy,
+			StaleMisses:      staleMisses,
+			StaleGracePeriod: staleGracePeriod,
+			Thresholds:       resolveThresholds(global, groups, Device{Group: device.Group, Thresholds: device.Thresholds}),
+			Labels:           resolveLabels(config.Labels, device.Labels, context),
+			Virtual:          sensor,
 		}
 	}
 
+	mutex.Lock()
+	// Clean up state for devices that were removed from config. A device whose
+	// MAC is still configured under another name was renamed: it keeps its state
+	// and only its series move to the new name.
+	var renames []KnownGovee // Old names of renamed devices
+	for mac, device := range knownGovees {
+		next, ok := newMap[mac]
+		switch {
+		case !ok:
+			forgetDeviceLocked(mac)
+			deleteDeviceSeriesLocked(device.Name)
+			deviceRenamedGauge.DeletePartialMatch(prometheus.Labels{"mac": mac})
+		case next.Name != device.Name:
+			deleteDeviceSeriesLocked(device.Name)
+			renames = append(renames, device)
+		}
+	}
+	// Renamed devices are exported under their new names only once every old name is
+	// cleared, so devices can swap names or take over the name of a removed one
+	moved := make(map[string]string, len(renames))
+	renamed := make(map[string]KnownGovee, len(renames))
+	for _, device := range renames {
+		renameDeviceSeriesLocked(device, newMap[device.MAC])
+		moved[device.Name] = newMap[device.MAC].Name
+		renamed[device.MAC] = newMap[device.MAC]
+	}
+	if len(renamed) > 0 {
+		alerts.renameDevices(renamed)
+	}
+	for _, device := range newMap {
+		setThresholdMetrics(device.Name, device.Thresholds)
+	}
+	setDeviceInfoMetrics(newMap)
+
 	knownGovees = newMap
 	mutex.Unlock()
 
+	if len(moved) > 0 {
+		renameHistory(moved)
+	}
+
 	// Format and log the known devices
 	if len(knownGovees) == 0 {
 		log.Println("Warning: No devices configured. Add devices to config.yaml to start monitoring.")
 	} else {
-		log.Println("Loaded known Govee H5075 devices:")
+		log.Println("Loaded known Govee devices:")
 		for mac, device := range knownGovees {
 			groupInfo := strings.Repeat(" ", 13) // keep the column width stable even when group is empty
 			if device.Group != "" {
@@ -179,18 +325,49 @@ func loadKnownGovees(config *Config) {
 				displayInfo = fmt.Sprintf(" Display: %-15s", device.DisplayName)
 			}
 
-			log.Printf("  %-17s -> Name: %-15s%s%s  TempOffset: %6.1f°C  HumidityOffset: %6.1f%%",
+			if device.Virtual != nil {
+				log.Printf("  %-17s -> Name: %-15s%s%s  Expression: %s",
+					"(virtual)",
+					device.Name,
+					groupInfo,
+					displayInfo,
+					device.Virtual.describe())
+				continue
+			}
+
+			model := device.Model
+			if model == "" {
+				model = "auto"
+			}
+
+			calibrationInfo := ""
+			if device.TempCalibration != nil || device.HumidityCalibration != nil {
+				calibrationInfo = fmt.Sprintf("  Calibration: temp %s, humidity %s",
+					device.TempCalibration.describe(), device.HumidityCalibration.describe())
+			}
+			labelsInfo := ""
+			if len(device.Labels) > 0 {
+				labelsInfo = "  Labels: " + describeLabels(device.Labels)
+			}
+
+			log.Printf("  %-17s -> Name: %-15s%s%s  Model: %-5s  TempOffset: %6.1f°C  HumidityOffset: %6.1f%%%s%s",
 				mac,
 				device.Name,
 				groupInfo,
 				displayInfo,
+				model,
 				device.TempOffset,
-				device.HumidityOffset)
+				device.HumidityOffset,
+				calibrationInfo,
+				labelsInfo)
 		}
 	}
 
 	// Initialize status metrics for configured devices
 	updateAllDeviceStatuses(parseDuration(config.Metrics.StaleThreshold))
+
+	// Announce the devices to Home Assistant and remove the ones no longer configured
+	publishHomeAssistantDiscovery()
 }
 
 // dbusBus is the subset of *dbus.Conn that BLE recovery needs. It exists as an
@@ -311,7 +488,9 @@ func powerCycleAdapter() {
 // cycle (and again every multiple thereafter).
 const scanFailuresBeforePowerCycle = 3
 
-func startBLEScanner(ctx context.Context, config *Config) {
+// startBLEScanner scans in a loop, reading the scan timing from the live config
+// before every scan so a reload applies from the next one
+func startBLEScanner(ctx context.Context) {
 	// Add retry logic for enabling the adapter
 	maxRetries := 3
 	for i := 0; i < maxRetries; i++ {
@@ -341,7 +520,10 @@ func startBLEScanner(ctx context.Context, config *Config) {
 			adapter.StopScan()
 			return
 		default:
-			scanCtx, cancel := context.WithTimeout(ctx, parseDuration(config.Bluetooth.ScanDuration))
+			scanDuration := parseDuration(liveConfig().Bluetooth.ScanDuration)
+			scanCtx, cancel := context.WithTimeout(ctx, scanDuration)
+			beginScanWindow()
+			publishEvent(eventScanStart, scanEvent{Duration: scanDuration.String(), Time: time.Now()})
 
 			// Stop the scan when duration expires even if no BLE packets arrive.
 			// adapter.Scan() blocks on a channel loop; without this goroutine it
@@ -358,6 +540,12 @@ func startBLEScanner(ctx context.Context, config *Config) {
 
 			cancel()
 
+			finished := scanEvent{Time: time.Now()}
+			if err != nil {
+				finished.Error = err.Error()
+			}
+			publishEvent(eventScanFinish, finished)
+
 			if err != nil {
 				consecutiveFailures++
 				log.Printf("Scanning failed (%d consecutive), retrying in 5 seconds: %v", consecutiveFailures, err)
@@ -376,7 +564,7 @@ func startBLEScanner(ctx context.Context, config *Config) {
 			consecutiveFailures = 0
 
 			// Log completion of scan and upcoming sleep period
-			scanInterval := parseDuration(config.Bluetooth.ScanInterval)
+			scanInterval := parseDuration(liveConfig().Bluetooth.ScanInterval)
 			log.Printf("Scan completed. Sleeping for %v until next scan...", scanInterval)
 
 			// Rest period between scans (interruptible by manual trigger)
@@ -398,34 +586,58 @@ func scanCallback(device bluetooth.ScanResult) {
 	govee, exists := knownGovees[macAddr]
 	mutex.Unlock()
 
-	if !exists {
-		return
-	}
-
 	// Get Manufacturer Data
 	manufacturerDataElements := device.ManufacturerData()
 	if len(manufacturerDataElements) == 0 {
 		return // No manufacturer data, ignore
 	}
 
-	// Extract manufacturer data payload
+	// Unknown devices are only tracked in the discovery table
+	if !exists {
+		recordDiscoveredDevice(macAddr, device.LocalName(), device.RSSI, manufacturerDataElements)
+		return
+	}
+
+	recordAdvertisement(macAddr, device.RSSI, time.Now())
+
+	// Extract manufacturer data payload using the decoder for the configured or detected model
+	localName := device.LocalName()
 	for _, element := range manufacturerDataElements {
-		if element.CompanyID == goveeManufacturerID {
-			parseGoveeData(govee, element.Data)
+		// Frames under other company IDs, such as the iBeacon frames H5075s also
+		// send, carry no reading and are ignored
+		if len(decodersByManufacturer[element.CompanyID]) == 0 {
+			continue
 		}
+		model, decoder := resolveDecoder(govee.Model, localName, element.CompanyID, len(element.Data))
+		if decoder == nil {
+			recordRejectedReading(govee.Name, rejectNoDecoder)
+			recordAdvertisementResult(macAddr, false)
+			continue
+		}
+		govee.Model = model
+		recordAdvertisementResult(macAddr, parseGoveeData(govee, element.Data))
 	}
 }
 
-func parseGoveeData(govee KnownGovee, data []byte) {
-	if len(data) < 5 {
-		log.Printf("[%s] Ignoring invalid data (length: %d): %v", govee.Name, len(data), data)
-		return
+// parseGoveeData decodes, validates and calibrates a reading and updates the
+// device's metrics. It reports whether the reading was accepted.
+func parseGoveeData(govee KnownGovee, data []byte) bool {
+	model := govee.Model
+	if model == "" {
+		model = defaultModel
+	}
+	decoder, ok := advertisementDecoders[model]
+	if !ok {
+		log.Printf("[%s] Ignoring data for unsupported model %s", govee.Name, model)
+		recordRejectedReading(govee.Name, rejectInvalid)
+		return false
 	}
 
-	// Validate data[1:4] contains valid temperature/humidity encoding
-	if data[1] == 0 && data[2] == 0 && data[3] == 0 {
-		log.Printf("[%s] Ignoring invalid zero readings", govee.Name)
-		return
+	reading, err := decoder.Decode(data)
+	if err != nil {
+		log.Printf("[%s] Ignoring invalid %s data (%v): %v", govee.Name, model, err, data)
+		recordRejectedReading(govee.Name, rejectInvalid)
+		return false
 	}
 
 	// Add reasonable bounds checking
@@ -436,46 +648,43 @@ func parseGoveeData(govee KnownGovee, data []byte) {
 		maxHumidity = 100.0
 	)
 
-	// Extract the 3-byte temperature/humidity raw value (Big Endian)
-	raw := uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3])
+	temperature := reading.Temperature
+	humidity := reading.Humidity
 
-	// Handle negative temperatures (if the highest bit is set)
-	var isNegative bool
-	if raw&0x800000 != 0 {
-		isNegative = true
-		raw ^= 0x800000
-	}
-
-	// Extract temperature & humidity
-	temperature := float64(int(raw/1000)) / 10.0
-	if isNegative {
-		temperature = -temperature
-	}
-	humidity := float64(raw%1000) / 10.0
-
-	// Validate temperature and humidity before applying offsets
+	// Validate temperature and humidity before applying calibration
 	if temperature < minTemp || temperature > maxTemp {
 		log.Printf("[%s] WARNING: Invalid Temperature Value %.2f°C (Ignoring)", govee.Name, temperature)
-		return
+		recordRejectedReading(govee.Name, rejectOutOfRange)
+		return false
 	}
 
 	if humidity < minHumidity || humidity > maxHumidity {
 		log.Printf("[%s] WARNING: Invalid Humidity Value %.2f%% (Ignoring)", govee.Name, humidity)
-		return
+		recordRejectedReading(govee.Name, rejectOutOfRange)
+		return false
 	}
 
-	// Extract battery level (last byte)
-	batteryLevel := int(data[4])
+	batteryLevel := reading.Battery
 
-	// Apply calibration offsets from configuration
-	temperature += govee.TempOffset
-	humidity += govee.HumidityOffset
+	// Apply calibration and offsets from configuration
+	temperature, humidity = calibrateReading(govee, temperature, humidity)
+
+	// Reject spikes and smooth the reading with the device's filter chain
+	now := time.Now()
+	filteredTemp, filteredHumidity, reason := filterReading(govee, temperature, humidity, now)
+	if reason != "" {
+		log.Printf("[%s] Ignoring reading %.2f°C / %.2f%% (%s)", govee.Name, temperature, humidity, reason)
+		recordRejectedReading(govee.Name, reason)
+		return false
+	}
+	recordCalibrationSample(govee, temperature, humidity)
+	temperature, humidity = filteredTemp, filteredHumidity
 
 	// Check if values have changed from last logged values
 	// Use epsilon comparison for floating point values to handle precision issues
 	const epsilon = 0.01 // 0.01°C for temperature, 0.01% for humidity
 	mutex.Lock()
-	lastValues, exists := deviceLastLoggedVals[govee.Name]
+	lastValues, exists := deviceLastLoggedVals[govee.MAC]
 	valuesChanged := !exists ||
 		lastValues.Battery != batteryLevel ||
 		math.Abs(lastValues.Temperature-temperature) >= epsilon ||
@@ -483,7 +692,7 @@ func parseGoveeData(govee KnownGovee, data []byte) {
 
 	if valuesChanged {
 		// Update last logged values
-		deviceLastLoggedVals[govee.Name] = lastLoggedValues{
+		deviceLastLoggedVals[govee.MAC] = lastLoggedValues{
 			Temperature: temperature,
 			Humidity:    humidity,
 			Battery:     batteryLevel,
@@ -518,15 +727,74 @@ func parseGoveeData(govee KnownGovee, data []byte) {
 	temperatureGauge.WithLabelValues(govee.Name).Set(temperature)
 	humidityGauge.WithLabelValues(govee.Name).Set(humidity)
 	batteryGauge.WithLabelValues(govee.Name).Set(float64(batteryLevel))
+	setLastSeen(govee.Name, now)
+	updateDerivedMetrics(govee.Name, temperature, humidity, currentDerivedMetricsConfig())
+	recordHistory(govee.Name, temperature, humidity, &batteryLevel)
 
 	// Update last seen time
 	mutex.Lock()
-	if _, exists := deviceFirstSeen[govee.Name]; !exists {
-		deviceFirstSeen[govee.Name] = time.Now()
+	if _, exists := deviceFirstSeen[govee.MAC]; !exists {
+		deviceFirstSeen[govee.MAC] = now
 	}
-	lastUpdateTime[govee.Name] = time.Now()
-	setDeviceStatusLocked(govee.Name, "active")
+	lastUpdateTime[govee.MAC] = now
+	modelChanged := deviceModels[govee.MAC] != model
+	deviceModels[govee.MAC] = model
+	delete(staleMissCounts, govee.MAC)
+	setDeviceStatusLocked(govee, "active")
 	mutex.Unlock()
+
+	// Home Assistant follows the state topic, which can depend on the detected model
+	if modelChanged {
+		publishHomeAssistantDiscovery()
+	}
+
+	evaluateReadingAlerts(govee, lastLoggedValues{Temperature: temperature, Humidity: humidity, Battery: batteryLevel}, now)
+	publishMQTTReading(govee, temperature, humidity, batteryLevel, now)
+	publishEvent(eventReading, readingEvent{
+		Name:        govee.Name,
+		Temperature: temperature,
+		Humidity:    humidity,
+		Battery:     &batteryLevel,
+		Time:        now,
+	})
+	updateVirtualDevices(govee.Name, now)
+
+	return true
+}
+
+// staleCheckerReloadCh tells the stale checker that the config was reloaded, so
+// a new metrics.refreshInterval applies at once rather than after the old one
+var staleCheckerReloadCh = make(chan struct{}, 1)
+
+// notifyStaleChecker signals the stale checker without blocking
+func notifyStaleChecker() {
+	select {
+	case staleCheckerReloadCh <- struct{}{}:
+	default:
+	}
+}
+
+// startStaleMetricsChecker runs checkForStaleMetrics every metrics.refreshInterval
+// with the live config, re-arming the ticker as soon as a reload changes the interval
+func startStaleMetricsChecker(ctx context.Context) {
+	interval := parseDuration(liveConfig().Metrics.RefreshInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkForStaleMetrics(liveConfig())
+		case <-staleCheckerReloadCh:
+			if newInterval := parseDuration(liveConfig().Metrics.RefreshInterval); newInterval != interval {
+				interval = newInterval
+				ticker.Reset(interval)
+				log.Printf("Stale metrics check interval updated to %s", interval)
+			}
+		}
+	}
 }
 
 func checkForStaleMetrics(config *Config) {
@@ -535,29 +803,33 @@ func checkForStaleMetrics(config *Config) {
 
 	now := time.Now()
 	staleThreshold := parseDuration(config.Metrics.StaleThreshold)
-	for device, lastSeen := range lastUpdateTime {
-		if now.Sub(lastSeen) > staleThreshold {
-			temperatureGauge.DeleteLabelValues(device)
-			humidityGauge.DeleteLabelValues(device)
-			batteryGauge.DeleteLabelValues(device)
-
-			var macAddr string
-			for mac, govee := range knownGovees {
-				if govee.Name == device {
-					macAddr = mac
-					break
-				}
-			}
 
-			if macAddr != "" {
-				log.Printf("Metrics for device '%s' (MAC: %s) reset due to inactivity (last seen at %s)", device, macAddr, lastSeen)
-			} else {
-				log.Printf("Metrics for device '%s' reset due to inactivity (last seen at %s)", device, lastSeen)
-			}
+	// Statuses are updated first so the policy follows the status hysteresis
+	wasStale := make(map[string]bool)
+	for mac, status := range deviceStatuses {
+		wasStale[mac] = status == "stale"
+	}
+	updateAllDeviceStatusesLocked(staleThreshold, now)
+
+	for mac, govee := range knownGovees {
+		lastSeen, seen := lastUpdateTime[mac]
+		if !seen || deviceStatuses[mac] != "stale" {
+			continue
 		}
+
+		// Applied on every check so a reloaded policy also reaches devices that are already stale
+		applyStalePolicyLocked(govee)
+		deleteRadioGauges(govee.Name)
+		resetFilterState(mac)
+
+		// Log once, when the device goes stale
+		if wasStale[mac] {
+			continue
+		}
+		log.Printf("Metrics for device '%s' (MAC: %s) reset due to inactivity (last seen at %s, policy: %s)", govee.Name, mac, lastSeen, govee.StalePolicy)
 	}
 
-	updateAllDeviceStatusesLocked(staleThreshold, now)
+	evaluateAllAlertsLocked(now)
 }
 
 // fetchOpenMeteoData fetches weather data from OpenMeteo API and updates Prometheus metrics
@@ -585,6 +857,9 @@ func fetchOpenMeteoData(ctx context.Context) {
 	// Update Prometheus metrics
 	openMeteoTemperatureGauge.Set(temp)
 	openMeteoHumidityGauge.Set(float64(humidity))
+	updateOutdoorDerivedMetrics(temp, float64(humidity), config.Metrics.Derived)
+	recordOpenMeteoHistory(temp, float64(humidity))
+	publishEvent(eventOpenMeteo, openMeteoEvent{Temperature: temp, Humidity: float64(humidity), Time: time.Now()})
 
 	// Check if values have changed from last logged values
 	// Use epsilon comparison for floating point values to handle precision issues
@@ -625,6 +900,8 @@ func fetchOpenMeteoData(ctx context.Context) {
 
 		log.Println(logMsg)
 	}
+
+	updateVirtualDevices(openMeteoInput, time.Now())
 }
 
 // updateOpenMeteoConfig safely updates the OpenMeteo configuration
@@ -742,9 +1019,25 @@ func main() {
 	}
 	log.Println("===========================")
 
+	// There is no earlier config to fall back to, so problems only warn at startup;
+	// a reload with problems is rejected
+	if err := validateConfig(config); err != nil {
+		log.Printf("Warning: Configuration problems: %v", err)
+	}
+	recordConfigReload(true, time.Now())
+
 	// Load devices from configuration
 	loadKnownGovees(config)
 
+	// Open the local history store if enabled
+	applyHistoryConfig(config)
+
+	// Connect to the MQTT broker if enabled
+	applyMQTTConfig(config)
+
+	// Load alert rules and webhooks
+	applyAlertsConfig(config)
+
 	// Create a context that will be canceled on shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -757,40 +1050,46 @@ func main() {
 	currentConfig = config
 	currentConfigMu.Unlock()
 
-	// Start configuration file watcher for hot-reload
+	// Start delivering alert notifications
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		watchConfigFile(ctx, func(newConfig *Config) {
-			loadKnownGovees(newConfig)
-			updateOpenMeteoConfig(newConfig)
-			// Update shared config for /config.js handler
-			currentConfigMu.Lock()
-			currentConfig = newConfig
-			currentConfigMu.Unlock()
-		})
+		runAlertNotifier(ctx)
 	}()
 
 	// Start the BLE scanner
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		startBLEScanner(ctx, config)
+		startBLEScanner(ctx)
 	}()
 
-	// Start the stale metrics checker with proper ticker
+	// Start the stale metrics checker
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		ticker := time.NewTicker(parseDuration(config.Metrics.RefreshInterval))
+		startStaleMetricsChecker(ctx)
+	}()
+
+	// Start history maintenance: flush finished buckets every minute, prune hourly
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(time.Minute)
 		defer ticker.Stop()
 
+		lastPrune := time.Time{}
 		for {
 			select {
 			case <-ctx.Done():
+				flushHistory()
 				return
-			case <-ticker.C:
-				checkForStaleMetrics(config)
+			case now := <-ticker.C:
+				prune := now.Sub(lastPrune) >= time.Hour
+				if prune {
+					lastPrune = now
+				}
+				maintainHistory(now, prune)
 			}
 		}
 	}()
@@ -804,7 +1103,8 @@ func main() {
 
 	// Serve static files with correct MIME types
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(deviceLabelGatherer{prometheus.DefaultGatherer}, promhttp.HandlerOpts{})))
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -822,6 +1122,17 @@ func main() {
 		}
 		w.WriteHeader(http.StatusAccepted)
 	})
+	mux.HandleFunc("/api/discovered", handleDiscovered)
+	mux.HandleFunc("/api/history", handleHistory)
+	mux.HandleFunc("/api/devices", handleDevices)
+	mux.HandleFunc("/api/devices/{name}", handleDevice)
+	mux.HandleFunc("/api/groups", handleGroups)
+	mux.HandleFunc("/api/events", handleEvents)
+	mux.HandleFunc("/api/alerts", handleAlerts)
+	mux.HandleFunc("/api/calibration", handleCalibration)
+	mux.HandleFunc("/api/calibration/apply", handleCalibrationApply)
+	mux.HandleFunc("/api/config", handleConfig)
+	mux.HandleFunc("/api/config/history", handleConfigHistory)
 
 	// Serve threshold configuration as JavaScript
 	mux.HandleFunc("/config.js", func(w http.ResponseWriter, r *http.Request) {
@@ -829,16 +1140,20 @@ func main() {
 		w.Header().Set("Cache-Control", "no-cache")
 
 		// Get current config (supports hot-reload)
-		currentConfigMu.RLock()
-		cfg := currentConfig
-		currentConfigMu.RUnlock()
+		cfg := liveConfig()
 
 		// Build device groups map
 		mutex.Lock()
 		deviceGroups := make(map[string]string)
 		deviceDisplayNames := make(map[string]string)
+		deviceThresholds := make(map[string]Thresholds)
+		virtualDevices := make(map[string]string)
 		for _, device := range knownGovees {
 			deviceGroups[device.Name] = device.Group
+			deviceThresholds[device.Name] = device.Thresholds
+			if device.Virtual != nil {
+				virtualDevices[device.Name] = device.Virtual.describe()
+			}
 			if device.DisplayName != "" && device.DisplayName != device.Name {
 				deviceDisplayNames[device.Name] = device.DisplayName
 			}
@@ -858,6 +1173,18 @@ func main() {
 			deviceDisplayNamesJSON = []byte("{}")
 		}
 
+		deviceThresholdsJSON, err := json.Marshal(deviceThresholds)
+		if err != nil {
+			log.Printf("Error marshaling device thresholds: %v", err)
+			deviceThresholdsJSON = []byte("{}")
+		}
+
+		virtualDevicesJSON, err := json.Marshal(virtualDevices)
+		if err != nil {
+			log.Printf("Error marshaling virtual devices: %v", err)
+			virtualDevicesJSON = []byte("{}")
+		}
+
 		configJS := fmt.Sprintf(`// Dashboard configuration from environment variables
 window.DASHBOARD_CONFIG = {
     TEMPERATURE_MIN: %v,
@@ -869,7 +1196,9 @@ window.DASHBOARD_CONFIG = {
     BATTERY_LOW_THRESHOLD: %v,
     SCAN_DURATION_MS: %v,
     DEVICE_GROUPS: %s,
-    DEVICE_DISPLAY_NAMES: %s
+    DEVICE_DISPLAY_NAMES: %s,
+    DEVICE_THRESHOLDS: %s,
+    VIRTUAL_DEVICES: %s
 };`,
 			cfg.Thresholds.Temperature.Min,
 			cfg.Thresholds.Temperature.Max,
@@ -881,6 +1210,8 @@ window.DASHBOARD_CONFIG = {
 			parseDuration(cfg.Bluetooth.ScanDuration).Milliseconds(),
 			string(deviceGroupsJSON),
 			string(deviceDisplayNamesJSON),
+			string(deviceThresholdsJSON),
+			string(virtualDevicesJSON),
 		)
 		w.Write([]byte(configJS))
 	})
@@ -901,31 +1232,77 @@ window.DASHBOARD_CONFIG = {
 	mux.Handle("/static/", noCacheHandler(http.StripPrefix("/static/", fs)))
 	mux.Handle("/", noCacheHandler(fs))
 
-	server := &http.Server{
-		Addr:    ":" + config.Server.Port,
-		Handler: mux,
+	server := newReloadableServer(ctx, mux, func(err error) {
+		log.Printf("HTTP server error: %v", err)
+		cancel() // Cancel context on server error
+	})
+
+	// Applies a reloaded configuration to every subsystem
+	applyConfig := func(newConfig *Config) {
+		loadKnownGovees(newConfig)
+		updateOpenMeteoConfig(newConfig)
+		applyDerivedMetricsConfig(newConfig.Metrics.Derived)
+		applyHistoryConfig(newConfig)
+		applyMQTTConfig(newConfig)
+		applyAlertsConfig(newConfig)
+		// Update the shared config read by the scanner, stale checker and handlers
+		currentConfigMu.Lock()
+		previous := currentConfig
+		currentConfig = newConfig
+		currentConfigMu.Unlock()
+		recordConfigChange(previous, newConfig, time.Now())
+		server.applyConfig(newConfig)
+		notifyStaleChecker()
+
+		mutex.Lock()
+		deviceCount := len(knownGovees)
+		mutex.Unlock()
+		publishEvent(eventConfigReload, configReloadEvent{Devices: deviceCount, Time: time.Now()})
 	}
+	configApplier = applyConfig
 
 	// Set up signal handling for graceful shutdown
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
-	// Start server in a goroutine
-	go func() {
-		log.Printf(`Starting metrics server with configuration:
+	log.Printf(`Starting metrics server with configuration:
     Port:             %s
     Scan Duration:    %v
     Scan Interval:    %v
     Refresh Interval: %v
     Stale Threshold:  %v`,
-			config.Server.Port,
-			config.Bluetooth.ScanDuration,
-			config.Bluetooth.ScanInterval,
-			config.Metrics.RefreshInterval,
-			config.Metrics.StaleThreshold)
-		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Printf("HTTP server error: %v", err)
-			cancel() // Cancel context on server error
+		config.Server.Port,
+		config.Bluetooth.ScanDuration,
+		config.Bluetooth.ScanInterval,
+		config.Metrics.RefreshInterval,
+		config.Metrics.StaleThreshold)
+	if err := server.listen(config.Server.Port); err != nil {
+		log.Printf("HTTP server error: %v", err)
+		cancel() // Cancel context on server error
+	}
+
+	// Start configuration file watcher for hot-reload
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watchConfigFile(ctx, applyConfig)
+	}()
+
+	// Reload the configuration on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				log.Println("Received SIGHUP, reloading configuration...")
+				reloadConfig(applyConfig)
+			}
 		}
 	}()
 
@@ -941,10 +1318,13 @@ window.DASHBOARD_CONFIG = {
 	defer shutdownCancel()
 
 	// Shutdown HTTP server
-	if err := server.Shutdown(shutdownCtx); err != nil {
+	if err := server.shutdown(shutdownCtx); err != nil {
 		log.Printf("Error during server shutdown: %v", err)
 	}
 
+	// Publish the offline availability message and disconnect from the MQTT broker
+	stopMQTT(shutdownCtx)
+
 	// Wait for goroutines, but don't block past the shutdown deadline.
 	// The BLE goroutine can hang in StopDiscovery if the HCI adapter is stuck;
 	// exiting on time lets the D-Bus connection close cleanly so BlueZ can
@@ -962,9 +1342,24 @@ window.DASHBOARD_CONFIG = {
 	}
 }
 
-// setDeviceStatusLocked sets status metrics for a device, ensuring only one status is 1.
-// Caller must hold mutex.
-func setDeviceStatusLocked(name, status string) {
+// setDeviceStatusLocked sets status metrics for a device, ensuring only one status is 1,
+// and publishes a status event when it changes. Caller must hold mutex.
+func setDeviceStatusLocked(govee KnownGovee, status string) {
+	name := govee.Name
+	if previous := deviceStatuses[govee.MAC]; previous != status {
+		deviceStatuses[govee.MAC] = status
+		if previous != "" {
+			deviceStatusTransitionsCounter.WithLabelValues(name, previous, status).Inc()
+		}
+		now := time.Now()
+		publishEvent(eventStatus, statusEvent{Name: name, Status: status, Previous: previous, Time: now})
+		publishMQTTStatusLocked(name, status, now)
+	}
+	setDeviceStatusGauges(name, status)
+}
+
+// setDeviceStatusGauges exports status as the one status of a device that is 1
+func setDeviceStatusGauges(name, status string) {
 	for _, s := range statusLabels {
 		val := 0.0
 		if s == status {
@@ -974,22 +1369,24 @@ func setDeviceStatusLocked(name, status string) {
 	}
 }
 
-// updateAllDeviceStatusesLocked recalculates statuses for all known devices.
+// deviceStatusLocked computes the status of a device from its last update time.
 // Caller must hold mutex.
+func deviceStatusLocked(mac string, staleThreshold time.Duration, now time.Time) string {
+	lastSeen, ok := lastUpdateTime[mac]
+	if !ok {
+		return "never_seen"
+	}
+	if now.Sub(lastSeen) > staleThreshold {
+		return "stale"
+	}
+	return "active"
+}
+
+// updateAllDeviceStatusesLocked recalculates statuses for all known devices.
+// staleThreshold applies to devices without their own. Caller must hold mutex.
 func updateAllDeviceStatusesLocked(staleThreshold time.Duration, now time.Time) {
 	for _, g := range knownGovees {
-		name := g.Name
-		lastSeen, ok := lastUpdateTime[name]
-		if !ok {
-			setDeviceStatusLocked(name, "never_seen")
-			continue
-		}
-
-		if now.Sub(lastSeen) > staleThreshold {
-			setDeviceStatusLocked(name, "stale")
-		} else {
-			setDeviceStatusLocked(name, "active")
-		}
+		setDeviceStatusLocked(g, nextDeviceStatusLocked(g, staleThreshold, now))
 	}
 }
 
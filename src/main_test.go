@@ -22,7 +22,20 @@ func resetState() {
 	lastUpdateTime = make(map[string]time.Time)
 	deviceFirstSeen = make(map[string]time.Time)
 	deviceLastLoggedVals = make(map[string]lastLoggedValues)
+	deviceStatuses = make(map[string]string)
 	deviceStatusGauge.Reset()
+	deviceStatusTransitionsCounter.Reset()
+	deviceRenamedGauge.Reset()
+	staleMissCounts = make(map[string]int)
+	deviceModels = make(map[string]string)
+	for _, g := range thresholdGauges {
+		g.gauge.Reset()
+	}
+	filterStates = make(map[string]*filterState)
+	readingsRejectedCounter.Reset()
+	radioStatsMu.Lock()
+	radioStatsByDevice = make(map[string]*radioStats)
+	radioStatsMu.Unlock()
 }
 
 func getStatusValue(t *testing.T, name, status string) float64 {
@@ -42,12 +55,12 @@ func TestUpdateAllDeviceStatuses_MixedStates(t *testing.T) {
 	staleThreshold := 5 * time.Minute
 
 	mutex.Lock()
-	knownGovees["AA:BB:CC"] = KnownGovee{Name: "ActiveRoom"}
-	knownGovees["DD:EE:FF"] = KnownGovee{Name: "StaleRoom"}
-	knownGovees["11:22:33"] = KnownGovee{Name: "NeverSeenRoom"}
+	knownGovees["AA:BB:CC"] = KnownGovee{MAC: "AA:BB:CC", Name: "ActiveRoom"}
+	knownGovees["DD:EE:FF"] = KnownGovee{MAC: "DD:EE:FF", Name: "StaleRoom"}
+	knownGovees["11:22:33"] = KnownGovee{MAC: "11:22:33", Name: "NeverSeenRoom"}
 
-	lastUpdateTime["ActiveRoom"] = now.Add(-1 * time.Minute) // within threshold
-	lastUpdateTime["StaleRoom"] = now.Add(-10 * time.Minute) // beyond threshold
+	lastUpdateTime["AA:BB:CC"] = now.Add(-1 * time.Minute)  // within threshold
+	lastUpdateTime["DD:EE:FF"] = now.Add(-10 * time.Minute) // beyond threshold
 	mutex.Unlock()
 
 	updateAllDeviceStatuses(staleThreshold)
@@ -92,8 +105,8 @@ func TestUpdateAllDeviceStatuses_ConfigRemovalCleansStatus(t *testing.T) {
 
 	// Start with one device
 	mutex.Lock()
-	knownGovees["AA:BB:CC"] = KnownGovee{Name: "Office"}
-	lastUpdateTime["Office"] = now
+	knownGovees["AA:BB:CC"] = KnownGovee{MAC: "AA:BB:CC", Name: "Office"}
+	lastUpdateTime["AA:BB:CC"] = now
 	mutex.Unlock()
 	updateAllDeviceStatuses(staleThreshold)
 
@@ -195,6 +208,156 @@ func TestLoadKnownGovees(t *testing.T) {
 	}
 }
 
+func TestLoadKnownGoveesRenameKeepsState(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Cleanup(func() {
+		for _, name := range []string{"Office", "Study"} {
+			deleteReadingMetrics(name)
+			lastSeenGauge.DeleteLabelValues(name)
+		}
+	})
+
+	store, err := NewHistoryStore(t.TempDir(), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("NewHistoryStore: %v", err)
+	}
+	historyStoreMu.Lock()
+	origStore := historyStore
+	historyStore = store
+	historyStoreMu.Unlock()
+	t.Cleanup(func() {
+		historyStoreMu.Lock()
+		historyStore = origStore
+		historyStoreMu.Unlock()
+	})
+
+	const mac = "AA:BB:CC:DD:EE:01"
+	config := &Config{Devices: []Device{{MAC: mac, Name: "Office"}}}
+	loadKnownGovees(config)
+
+	firstSeen := time.Now().Add(-time.Hour)
+	mutex.Lock()
+	deviceFirstSeen[mac] = firstSeen
+	lastUpdateTime[mac] = time.Now()
+	deviceLastLoggedVals[mac] = lastLoggedValues{Temperature: 21.5, Humidity: 40, Battery: 80}
+	setDeviceStatusLocked(knownGovees[mac], "active")
+	mutex.Unlock()
+	temperatureGauge.WithLabelValues("Office").Set(21.5)
+	recordHistory("Office", 21.5, 40, nil)
+
+	config = &Config{Devices: []Device{{MAC: mac, Name: "Study"}}}
+	loadKnownGovees(config)
+
+	mutex.Lock()
+	gotFirstSeen, gotValues := deviceFirstSeen[mac], deviceLastLoggedVals[mac]
+	mutex.Unlock()
+	if !gotFirstSeen.Equal(firstSeen) || gotValues.Temperature != 21.5 {
+		t.Errorf("state after rename: first seen %v, values %+v", gotFirstSeen, gotValues)
+	}
+	if got := getStatusValue(t, "Study", "active"); got != 1 {
+		t.Errorf("Study active status = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(temperatureGauge.WithLabelValues("Study")); got != 21.5 {
+		t.Errorf("Study temperature = %v, want 21.5", got)
+	}
+	if temperatureGauge.DeleteLabelValues("Office") || deviceStatusGauge.DeleteLabelValues("Office", "active") {
+		t.Error("series of the old name were not removed")
+	}
+	if got := testutil.ToFloat64(deviceRenamedGauge.WithLabelValues(mac, "Office", "Study")); got != 1 {
+		t.Errorf("govee_device_renamed = %v, want 1", got)
+	}
+
+	points, err := store.Query("Study", time.Now().Add(-time.Hour), time.Now().Add(time.Minute), time.Minute)
+	if err != nil || len(points) != 1 {
+		t.Errorf("history of Study = %+v (%v), want the point recorded as Office", points, err)
+	}
+}
+
+func TestLoadKnownGoveesRenameSwap(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Cleanup(func() {
+		for _, name := range []string{"Office", "Study", "Attic"} {
+			deleteReadingMetrics(name)
+			lastSeenGauge.DeleteLabelValues(name)
+			deleteRadioMetrics(name)
+		}
+	})
+
+	store, err := NewHistoryStore(t.TempDir(), time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("NewHistoryStore: %v", err)
+	}
+	historyStoreMu.Lock()
+	origStore := historyStore
+	historyStore = store
+	historyStoreMu.Unlock()
+	t.Cleanup(func() {
+		historyStoreMu.Lock()
+		historyStore = origStore
+		historyStoreMu.Unlock()
+	})
+
+	const office, study = "AA:BB:CC:DD:EE:01", "AA:BB:CC:DD:EE:02"
+	loadKnownGovees(&Config{Devices: []Device{{MAC: office, Name: "Office"}, {MAC: study, Name: "Study"}}})
+
+	start := time.Now()
+	mutex.Lock()
+	for mac, temperature := range map[string]float64{office: 21, study: 18} {
+		lastUpdateTime[mac] = time.Now()
+		deviceLastLoggedVals[mac] = lastLoggedValues{Temperature: temperature, Humidity: 40, Battery: 80}
+		setDeviceStatusLocked(knownGovees[mac], "active")
+	}
+	mutex.Unlock()
+	recordHistory("Office", 21, 40, nil)
+	recordHistory("Study", 18, 40, nil)
+	recordAdvertisement(office, -50, time.Now())
+	recordAdvertisement(office, -50, time.Now())
+	recordAdvertisement(study, -80, time.Now())
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	// The two devices swap names, and the study passes its old name to the office
+	loadKnownGovees(&Config{Devices: []Device{{MAC: office, Name: "Study"}, {MAC: study, Name: "Office"}}})
+
+	for name, want := range map[string]float64{"Study": 21, "Office": 18} {
+		if got := testutil.ToFloat64(temperatureGauge.WithLabelValues(name)); got != want {
+			t.Errorf("%s temperature = %v, want %v", name, got, want)
+		}
+		if got := getStatusValue(t, name, "active"); got != 1 {
+			t.Errorf("%s active status = %v, want 1", name, got)
+		}
+		points, err := store.Query(name, start.Add(-time.Hour), time.Now().Add(time.Minute), time.Minute)
+		if err != nil || len(points) != 1 || points[0].Temperature != want {
+			t.Errorf("history of %s = %+v (%v), want one point at %v", name, points, err, want)
+		}
+	}
+	// Advertisement counters continue under the new names
+	for name, want := range map[string]float64{"Study": 2, "Office": 1} {
+		if got := testutil.ToFloat64(advertisementsReceivedCounter.WithLabelValues(name)); got != want {
+			t.Errorf("%s advertisements received = %v, want %v", name, got, want)
+		}
+	}
+	if got, ok := lastRSSI(office); !ok || got != -50 {
+		t.Errorf("office RSSI = %d, want -50", got)
+	}
+
+	// A chain where the office moves on and the study takes its name
+	loadKnownGovees(&Config{Devices: []Device{{MAC: office, Name: "Attic"}, {MAC: study, Name: "Study"}}})
+	if got := testutil.ToFloat64(temperatureGauge.WithLabelValues("Study")); got != 18 {
+		t.Errorf("Study temperature after chain = %v, want 18", got)
+	}
+	if temperatureGauge.DeleteLabelValues("Office") {
+		t.Error("series of Office should have been removed")
+	}
+	points, err := store.Query("Attic", start.Add(-time.Hour), time.Now().Add(time.Minute), time.Minute)
+	if err != nil || len(points) != 1 || points[0].Temperature != 21 {
+		t.Errorf("history of Attic = %+v (%v), want the office's point", points, err)
+	}
+}
+
 func TestLoadKnownGoveesDisplayNames(t *testing.T) {
 	testConfig := &Config{
 		Devices: []Device{
@@ -226,6 +389,34 @@ func TestLoadKnownGoveesDisplayNames(t *testing.T) {
 	}
 }
 
+func TestLoadKnownGoveesModels(t *testing.T) {
+	testConfig := &Config{
+		Devices: []Device{
+			{MAC: "AA:BB:CC:DD:EE:01", Name: "Freezer", Model: "h5179"},
+			{MAC: "AA:BB:CC:DD:EE:02", Name: "Cellar", Model: "GVH5074"},
+			{MAC: "AA:BB:CC:DD:EE:03", Name: "Attic", Model: "H9999"},
+			{MAC: "AA:BB:CC:DD:EE:04", Name: "Hall"},
+		},
+	}
+
+	loadKnownGovees(testConfig)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	expected := map[string]string{
+		"AA:BB:CC:DD:EE:01": "H5179",
+		"AA:BB:CC:DD:EE:02": "H5074",
+		"AA:BB:CC:DD:EE:03": "", // unsupported -> auto-detect
+		"AA:BB:CC:DD:EE:04": "",
+	}
+	for mac, want := range expected {
+		if got := knownGovees[mac].Model; got != want {
+			t.Errorf("device %s model = %q, want %q", mac, got, want)
+		}
+	}
+}
+
 func TestParseGoveeData(t *testing.T) {
 	// Set up test cases
 	tests := []struct {
@@ -264,6 +455,24 @@ func TestParseGoveeData(t *testing.T) {
 			wantBat:  100,
 			wantErr:  false,
 		},
+		{
+			name:     "With calibration",
+			data:     []byte{0x01, 0x01, 0x56, 0x32, 0x64}, // 8.7°C * 2 gain = 17.4°C, 60.2% clamped to 100% after +45 offset
+			govee:    KnownGovee{Name: "Test7", HumidityOffset: 45, TempCalibration: &calibration{gain: 2}},
+			wantTemp: 17.4,
+			wantHum:  100,
+			wantBat:  100,
+			wantErr:  false,
+		},
+		{
+			name:     "H5074 little endian model",
+			data:     []byte{0x00, 0x29, 0x09, 0xBF, 0x15, 0x5A, 0x02, 0x00, 0x00}, // 23.45°C, 55.67%, 90% battery
+			govee:    KnownGovee{Name: "Test6", Model: "H5074"},
+			wantTemp: 23.45,
+			wantHum:  55.67,
+			wantBat:  90,
+			wantErr:  false,
+		},
 		{
 			name:    "Invalid data length",
 			data:    []byte{0x01, 0x02, 0x03},
@@ -338,6 +547,9 @@ func TestParseGoveeData(t *testing.T) {
 }
 
 func TestCheckForStaleMetrics(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
 	// Set up test metrics
 	temperatureGauge = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{Name: "test_temp"},
@@ -354,9 +566,10 @@ func TestCheckForStaleMetrics(t *testing.T) {
 
 	// Set up test devices
 	mutex.Lock()
-	lastUpdateTime = make(map[string]time.Time)
-	lastUpdateTime["Fresh"] = time.Now()
-	lastUpdateTime["Stale"] = time.Now().Add(-6 * time.Minute)
+	knownGovees["AA:BB:CC:DD:EE:01"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Fresh"}
+	knownGovees["AA:BB:CC:DD:EE:02"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:02", Name: "Stale"}
+	lastUpdateTime["AA:BB:CC:DD:EE:01"] = time.Now()
+	lastUpdateTime["AA:BB:CC:DD:EE:02"] = time.Now().Add(-6 * time.Minute)
 	mutex.Unlock()
 
 	// Set some initial metrics
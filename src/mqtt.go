@@ -0,0 +1,426 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// mqttQueueSize is the number of messages buffered while the broker is slow;
+	// further messages are dropped rather than stalling the BLE scanner
+	mqttQueueSize = 256
+
+	// mqttPublishTimeout bounds how long a single publish may wait for the broker
+	mqttPublishTimeout = 10 * time.Second
+
+	// mqttReloadDrainTimeout bounds how long a config reload waits for the old
+	// connection to publish its queue; the rest is dropped
+	mqttReloadDrainTimeout = 2 * time.Second
+
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+)
+
+// mqttStatePayload is the JSON published on the state topic for every accepted reading
+type mqttStatePayload struct {
+	Temperature float64   `json:"temperature"`
+	Humidity    float64   `json:"humidity"`
+	Battery     int       `json:"battery"`
+	RSSI        *int16    `json:"rssi,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// mqttStatusPayload is the JSON published on the status topic when a device changes status
+type mqttStatusPayload struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// mqttMessage is one queued publish
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+}
+
+// mqttPublishClient is the subset of mqtt.Client the publisher needs, so tests
+// can substitute a fake broker connection
+type mqttPublishClient interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+	Disconnect(quiesce uint)
+}
+
+// newMQTTClient connects to the broker in the background; the client keeps
+// retrying, so a broker that is down at startup does not block the exporter
+var newMQTTClient = func(opts *mqtt.ClientOptions) mqttPublishClient {
+	client := mqtt.NewClient(opts)
+	client.Connect()
+	return client
+}
+
+// mqttPublisher owns the broker connection and publishes queued messages in order
+type mqttPublisher struct {
+	settings MQTTConfig
+	qos      byte
+	client   mqttPublishClient
+	queue    chan mqttMessage
+	done     chan struct{}
+	abort    chan struct{} // Closed to drop the rest of the queue
+
+	dropMu     sync.Mutex
+	dropLogged bool
+
+	haMu        sync.Mutex
+	haTopics    map[string]struct{} // Retained Home Assistant discovery topics published
+	haStatePath string              // Where haTopics is recorded; empty to keep it in memory
+}
+
+var (
+	mqttPublisherMu = &sync.RWMutex{}
+	activeMQTT      *mqttPublisher
+)
+
+// mqttQoS validates the configured QoS level
+func mqttQoS(qos int) byte {
+	if qos < 0 || qos > 2 {
+		log.Printf("MQTT: Invalid QoS %d, using 0", qos)
+		return 0
+	}
+	return byte(qos)
+}
+
+// mqttClientID returns the configured client ID or one derived from the hostname
+func mqttClientID(settings MQTTConfig) string {
+	if settings.ClientID != "" {
+		return settings.ClientID
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		return "govee-exporter"
+	}
+	return "govee-exporter-" + hostname
+}
+
+// mqttTLSConfig builds the TLS settings, or returns nil when none are configured
+func mqttTLSConfig(settings MQTTConfig) (*tls.Config, error) {
+	t := settings.TLS
+	if t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" && !t.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	config := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// topicValue makes a value safe to use as a single MQTT topic level
+func topicValue(value string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(value)
+}
+
+// renderTopic fills the {{name}}, {{displayName}}, {{group}}, {{model}} and
+// {{mac}} placeholders of a topic template for a device
+func renderTopic(template string, govee KnownGovee) string {
+	group := govee.Group
+	if group == "" {
+		group = ungroupedName
+	}
+	displayName := govee.DisplayName
+	if displayName == "" {
+		displayName = govee.Name
+	}
+	model := govee.Model
+	if model == "" {
+		model = defaultModel
+	}
+	return strings.NewReplacer(
+		"{{name}}", topicValue(govee.Name),
+		"{{displayName}}", topicValue(displayName),
+		"{{group}}", topicValue(group),
+		"{{model}}", topicValue(model),
+		"{{mac}}", topicValue(govee.MAC),
+	).Replace(template)
+}
+
+// startMQTTPublisher connects to the broker and starts the publish loop. The
+// Home Assistant discovery topics published earlier are read from haStatePath,
+// so the first sync clears those that are no longer wanted.
+func startMQTTPublisher(settings MQTTConfig, haStatePath string) (*mqttPublisher, error) {
+	tlsConfig, err := mqttTLSConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &mqttPublisher{
+		settings:    settings,
+		qos:         mqttQoS(settings.QoS),
+		queue:       make(chan mqttMessage, mqttQueueSize),
+		done:        make(chan struct{}),
+		abort:       make(chan struct{}),
+		haTopics:    loadHomeAssistantTopics(haStatePath),
+		haStatePath: haStatePath,
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(settings.Broker).
+		SetClientID(mqttClientID(settings)).
+		SetUsername(settings.Username).
+		SetPassword(settings.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetMaxReconnectInterval(time.Minute).
+		SetOrderMatters(false)
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if settings.AvailabilityTopic != "" {
+		opts.SetWill(settings.AvailabilityTopic, mqttOffline, p.qos, true)
+	}
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		log.Printf("MQTT: Connected to %s", settings.Broker)
+		if settings.AvailabilityTopic != "" {
+			client.Publish(settings.AvailabilityTopic, p.qos, true, mqttOnline)
+		}
+	})
+	opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+		log.Printf("MQTT: Connection lost: %v", err)
+	})
+
+	p.client = newMQTTClient(opts)
+	go p.run()
+	return p, nil
+}
+
+// run publishes queued messages until the queue is closed or abort is closed
+func (p *mqttPublisher) run() {
+	defer close(p.done)
+
+	failing := false
+	for msg := range p.queue {
+		select {
+		case <-p.abort:
+			return
+		default:
+		}
+
+		token := p.client.Publish(msg.topic, p.qos, msg.retain, msg.payload)
+		timer := time.NewTimer(mqttPublishTimeout)
+		var err error
+		select {
+		case <-token.Done():
+			err = token.Error()
+		case <-timer.C:
+			err = fmt.Errorf("timed out after %v", mqttPublishTimeout)
+		case <-p.abort:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+
+		// Log the first failure of a run, not every message while the broker is away
+		if err != nil && !failing {
+			log.Printf("MQTT: Failed to publish to %s: %v", msg.topic, err)
+		}
+		failing = err != nil
+	}
+}
+
+// enqueue queues a message without blocking the caller
+func (p *mqttPublisher) enqueue(msg mqttMessage) {
+	select {
+	case p.queue <- msg:
+		p.dropMu.Lock()
+		p.dropLogged = false
+		p.dropMu.Unlock()
+	default:
+		p.dropMu.Lock()
+		if !p.dropLogged {
+			log.Printf("MQTT: Publish queue full, dropping messages")
+			p.dropLogged = true
+		}
+		p.dropMu.Unlock()
+	}
+}
+
+// stop drains the queue, marks the exporter offline and disconnects. Paho holds
+// publishes while the broker is down, so the drain ends with ctx and whatever
+// is still queued is dropped.
+func (p *mqttPublisher) stop(ctx context.Context) {
+	close(p.queue)
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		close(p.abort)
+		<-p.done
+		log.Printf("MQTT: Dropped %d queued messages on disconnect", len(p.queue))
+	}
+	if p.settings.AvailabilityTopic != "" {
+		token := p.client.Publish(p.settings.AvailabilityTopic, p.qos, true, mqttOffline)
+		select {
+		case <-token.Done():
+		case <-ctx.Done():
+		}
+	}
+	p.client.Disconnect(250)
+}
+
+// publishReading queues the state message for an accepted reading
+func (p *mqttPublisher) publishReading(govee KnownGovee, temperature, humidity float64, battery int, now time.Time) {
+	payload := mqttStatePayload{
+		Temperature: temperature,
+		Humidity:    humidity,
+		Battery:     battery,
+		Timestamp:   now,
+	}
+	if rssi, ok := lastRSSI(govee.MAC); ok {
+		payload.RSSI = &rssi
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("MQTT: Failed to encode reading for '%s': %v", govee.Name, err)
+		return
+	}
+	p.enqueue(mqttMessage{topic: renderTopic(p.settings.Topic, govee), payload: data, retain: p.settings.Retain})
+}
+
+// publishStatus queues the status message for a device status change
+func (p *mqttPublisher) publishStatus(govee KnownGovee, status string, now time.Time) {
+	if p.settings.StatusTopic == "" {
+		return
+	}
+	data, err := json.Marshal(mqttStatusPayload{Status: status, Timestamp: now})
+	if err != nil {
+		log.Printf("MQTT: Failed to encode status for '%s': %v", govee.Name, err)
+		return
+	}
+	p.enqueue(mqttMessage{topic: renderTopic(p.settings.StatusTopic, govee), payload: data, retain: p.settings.Retain})
+}
+
+// applyMQTTConfig starts, restarts or stops the publisher to match the config
+func applyMQTTConfig(config *Config) {
+	mqttPublisherMu.Lock()
+	previous := activeMQTT
+	if previous != nil && config.MQTT.Enabled && previous.settings == config.MQTT {
+		mqttPublisherMu.Unlock()
+		return
+	}
+	activeMQTT = nil
+	mqttPublisherMu.Unlock()
+
+	// Drain the old connection outside the lock so readings are never blocked on it
+	if previous != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), mqttReloadDrainTimeout)
+		previous.stop(ctx)
+		cancel()
+		if !config.MQTT.Enabled {
+			log.Println("MQTT: Disabled")
+		}
+	}
+	if !config.MQTT.Enabled {
+		return
+	}
+
+	haStatePath := ""
+	if config.DataDir != "" {
+		haStatePath = filepath.Join(config.DataDir, haDiscoveryStateFile)
+	}
+	publisher, err := startMQTTPublisher(config.MQTT, haStatePath)
+	if err != nil {
+		log.Printf("MQTT: Failed to start publisher: %v", err)
+		return
+	}
+	// Take over the discovery topics of the previous connection, so its entries
+	// are cleared when a removed device or a new prefix leaves them unwanted
+	if previous != nil {
+		for topic := range previous.homeAssistantTopics() {
+			publisher.haTopics[topic] = struct{}{}
+		}
+	}
+	mqttPublisherMu.Lock()
+	activeMQTT = publisher
+	mqttPublisherMu.Unlock()
+	log.Printf("MQTT: Enabled (broker: %s, topic: %s)", config.MQTT.Broker, config.MQTT.Topic)
+
+	publishHomeAssistantDiscovery()
+}
+
+// stopMQTT marks the exporter offline and disconnects from the broker on
+// shutdown, giving up on queued messages when ctx ends
+func stopMQTT(ctx context.Context) {
+	mqttPublisherMu.Lock()
+	previous := activeMQTT
+	activeMQTT = nil
+	mqttPublisherMu.Unlock()
+
+	if previous != nil {
+		previous.stop(ctx)
+	}
+}
+
+// publishMQTTReading publishes an accepted reading if MQTT is enabled
+func publishMQTTReading(govee KnownGovee, temperature, humidity float64, battery int, now time.Time) {
+	mqttPublisherMu.RLock()
+	defer mqttPublisherMu.RUnlock()
+
+	if activeMQTT != nil {
+		activeMQTT.publishReading(govee, temperature, humidity, battery, now)
+	}
+}
+
+// mqttDeviceLocked fills in the model a device's readings are decoded as when none
+// is configured, so {{model}} in status and Home Assistant topics matches the
+// state topic. Caller must hold mutex.
+func mqttDeviceLocked(govee KnownGovee) KnownGovee {
+	if govee.Model == "" {
+		govee.Model = deviceModels[govee.MAC]
+	}
+	return govee
+}
+
+// publishMQTTStatusLocked publishes a device status change if MQTT is enabled.
+// Caller must hold mutex.
+func publishMQTTStatusLocked(name, status string, now time.Time) {
+	mqttPublisherMu.RLock()
+	defer mqttPublisherMu.RUnlock()
+
+	if activeMQTT == nil {
+		return
+	}
+	for _, govee := range knownGovees {
+		if govee.Name == name {
+			if govee.Virtual == nil {
+				activeMQTT.publishStatus(mqttDeviceLocked(govee), status, now)
+			}
+			return
+		}
+	}
+}
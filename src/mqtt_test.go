@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// fakeToken is an already completed mqtt.Token
+type fakeToken struct{ err error }
+
+func (t fakeToken) Wait() bool                     { return true }
+func (t fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (t fakeToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+func (t fakeToken) Error() error { return t.err }
+
+// pendingToken is an mqtt.Token that never completes, like a publish while the
+// broker is down
+type pendingToken struct{}
+
+func (pendingToken) Wait() bool                       { select {} }
+func (pendingToken) WaitTimeout(d time.Duration) bool { time.Sleep(d); return false }
+func (pendingToken) Done() <-chan struct{}            { return nil }
+func (pendingToken) Error() error                     { return nil }
+
+type publishedMessage struct {
+	topic   string
+	qos     byte
+	retain  bool
+	payload string
+}
+
+// fakeMQTTClient records publishes instead of talking to a broker
+type fakeMQTTClient struct {
+	mu           sync.Mutex
+	published    []publishedMessage
+	disconnected bool
+	brokerDown   bool // Publishes never complete
+}
+
+func (c *fakeMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var body string
+	switch p := payload.(type) {
+	case string:
+		body = p
+	case []byte:
+		body = string(p)
+	}
+	c.published = append(c.published, publishedMessage{topic: topic, qos: qos, retain: retained, payload: body})
+	if c.brokerDown {
+		return pendingToken{}
+	}
+	return fakeToken{}
+}
+
+func (c *fakeMQTTClient) Disconnect(uint) {
+	c.mu.Lock()
+	c.disconnected = true
+	c.mu.Unlock()
+}
+
+func (c *fakeMQTTClient) messages() []publishedMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]publishedMessage(nil), c.published...)
+}
+
+// withFakeMQTT enables MQTT with settings against a fake client and returns it
+// along with the options the publisher connected with
+func withFakeMQTT(t *testing.T, settings MQTTConfig) (*fakeMQTTClient, *mqtt.ClientOptions) {
+	t.Helper()
+	client := &fakeMQTTClient{}
+	var opts *mqtt.ClientOptions
+	orig := newMQTTClient
+	newMQTTClient = func(o *mqtt.ClientOptions) mqttPublishClient {
+		opts = o
+		return client
+	}
+	t.Cleanup(func() {
+		stopMQTT(context.Background())
+		newMQTTClient = orig
+	})
+
+	config := &Config{}
+	config.MQTT = settings
+	config.MQTT.Enabled = true
+	applyMQTTConfig(config)
+	return client, opts
+}
+
+func TestRenderTopic(t *testing.T) {
+	tests := []struct {
+		template string
+		govee    KnownGovee
+		want     string
+	}{
+		{"govee/{{group}}/{{name}}/state", KnownGovee{Name: "Office", Group: "Upstairs"}, "govee/Upstairs/Office/state"},
+		{"govee/{{group}}/{{name}}/state", KnownGovee{Name: "Office"}, "govee/Ungrouped/Office/state"},
+		{"govee/{{name}}/state", KnownGovee{Name: "Kids/Room #1+"}, "govee/Kids_Room _1_/state"},
+		{"{{model}}/{{displayName}}", KnownGovee{Name: "Office"}, "H5075/Office"},
+		{"{{model}}/{{displayName}}", KnownGovee{Name: "Office", DisplayName: "Desk", Model: "H5179"}, "H5179/Desk"},
+		{"govee/{{mac}}/state", KnownGovee{MAC: "A4:C1:38:00:00:01", Name: "Office"}, "govee/A4:C1:38:00:00:01/state"},
+	}
+	for _, tt := range tests {
+		if got := renderTopic(tt.template, tt.govee); got != tt.want {
+			t.Errorf("renderTopic(%q, %+v) = %q, want %q", tt.template, tt.govee, got, tt.want)
+		}
+	}
+}
+
+func TestMQTTPublishesReadingsAndStatus(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	deleteRadioMetrics("Office")
+	t.Cleanup(func() { deleteRadioMetrics("Office") })
+
+	client, opts := withFakeMQTT(t, MQTTConfig{
+		Broker:            "tcp://broker:1883",
+		QoS:               1,
+		Retain:            true,
+		Topic:             "govee/{{group}}/{{name}}/state",
+		StatusTopic:       "govee/{{name}}/status",
+		AvailabilityTopic: "govee/availability",
+	})
+
+	if !opts.WillEnabled || opts.WillTopic != "govee/availability" || string(opts.WillPayload) != mqttOffline || !opts.WillRetained {
+		t.Errorf("last will = %v %q %q retained=%v", opts.WillEnabled, opts.WillTopic, opts.WillPayload, opts.WillRetained)
+	}
+
+	govee := KnownGovee{MAC: "AA:BB:CC:DD:EE:FF", Name: "Office", Group: "Upstairs"}
+	mutex.Lock()
+	knownGovees["AA:BB:CC:DD:EE:FF"] = govee
+	mutex.Unlock()
+
+	recordAdvertisement(govee.MAC, -67, time.Now())
+	if !parseGoveeData(govee, []byte{0x00, 0x03, 0x4B, 0x5E, 0x64, 0x00}) {
+		t.Fatal("reading was rejected")
+	}
+	stopMQTT(context.Background())
+
+	msgs := client.messages()
+	if len(msgs) != 3 {
+		t.Fatalf("published %d messages, want status, state and offline: %+v", len(msgs), msgs)
+	}
+
+	status, state, offline := msgs[0], msgs[1], msgs[2]
+	if status.topic != "govee/Office/status" || !status.retain || status.qos != 1 {
+		t.Errorf("status message = %+v", status)
+	}
+	var statusPayload mqttStatusPayload
+	if err := json.Unmarshal([]byte(status.payload), &statusPayload); err != nil || statusPayload.Status != "active" {
+		t.Errorf("status payload = %s (%v)", status.payload, err)
+	}
+
+	if state.topic != "govee/Upstairs/Office/state" || !state.retain || state.qos != 1 {
+		t.Errorf("state message = %+v", state)
+	}
+	var statePayload mqttStatePayload
+	if err := json.Unmarshal([]byte(state.payload), &statePayload); err != nil {
+		t.Fatalf("decode state payload %s: %v", state.payload, err)
+	}
+	if statePayload.Temperature != 21.5 || statePayload.Humidity != 90.2 || statePayload.Battery != 100 ||
+		statePayload.RSSI == nil || *statePayload.RSSI != -67 || statePayload.Timestamp.IsZero() {
+		t.Errorf("state payload = %s", state.payload)
+	}
+
+	if offline.topic != "govee/availability" || offline.payload != mqttOffline || !offline.retain {
+		t.Errorf("offline message = %+v", offline)
+	}
+	if !client.disconnected {
+		t.Error("client was not disconnected")
+	}
+}
+
+func TestMQTTStatusTopicUsesDecodedModel(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	client, _ := withFakeMQTT(t, MQTTConfig{Broker: "tcp://broker:1883", Topic: "govee/{{model}}/{{name}}/state", StatusTopic: "govee/{{model}}/{{name}}/status"})
+
+	mutex.Lock()
+	knownGovees["AA:BB:CC:DD:EE:FF"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:FF", Name: "Freezer"}
+	deviceModels["AA:BB:CC:DD:EE:FF"] = "H5179"
+	setDeviceStatusLocked(knownGovees["AA:BB:CC:DD:EE:FF"], "stale")
+	mutex.Unlock()
+	stopMQTT(context.Background())
+
+	if msgs := client.messages(); len(msgs) == 0 || msgs[0].topic != "govee/H5179/Freezer/status" {
+		t.Errorf("messages = %+v, want the status on the topic of the decoded model", msgs)
+	}
+}
+
+func TestApplyMQTTConfigRestartsOnChange(t *testing.T) {
+	first, _ := withFakeMQTT(t, MQTTConfig{Broker: "tcp://a:1883", Topic: "a/{{name}}"})
+
+	mqttPublisherMu.RLock()
+	before := activeMQTT
+	mqttPublisherMu.RUnlock()
+
+	// Unchanged settings keep the connection
+	config := &Config{}
+	config.MQTT = before.settings
+	applyMQTTConfig(config)
+	mqttPublisherMu.RLock()
+	same := activeMQTT == before
+	mqttPublisherMu.RUnlock()
+	if !same || first.disconnected {
+		t.Fatal("publisher restarted although settings did not change")
+	}
+
+	// Disabling stops it
+	applyMQTTConfig(&Config{})
+	mqttPublisherMu.RLock()
+	stopped := activeMQTT == nil
+	mqttPublisherMu.RUnlock()
+	if !stopped || !first.disconnected {
+		t.Error("publisher still running after MQTT was disabled")
+	}
+}
+
+func TestMQTTStopDropsQueueWhenBrokerIsDown(t *testing.T) {
+	client, _ := withFakeMQTT(t, MQTTConfig{Broker: "tcp://a:1883", Topic: "govee/{{name}}", AvailabilityTopic: "govee/availability"})
+	client.mu.Lock()
+	client.brokerDown = true
+	client.mu.Unlock()
+
+	for i := 0; i < 5; i++ {
+		publishMQTTReading(KnownGovee{Name: "Office"}, 21, 45, 90, time.Now())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	stopMQTT(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stop took %v with the broker down, want it bounded by the context", elapsed)
+	}
+	if !client.disconnected {
+		t.Error("client was not disconnected")
+	}
+	if n := len(client.messages()); n > 2 {
+		t.Errorf("%d messages published after the first one hung, want the rest dropped", n)
+	}
+}
+
+func TestMQTTQoS(t *testing.T) {
+	for qos, want := range map[int]byte{0: 0, 1: 1, 2: 2, 3: 0, -1: 0} {
+		if got := mqttQoS(qos); got != want {
+			t.Errorf("mqttQoS(%d) = %d, want %d", qos, got, want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Magnus coefficients over water (Alduchov & Eskridge, 1996), valid from -40°C to 50°C
+const (
+	magnusA  = 17.625
+	magnusB  = 243.04 // °C
+	magnusC  = 6.1094 // hPa
+	kelvin   = 273.15
+	waterR   = 461.5 // specific gas constant of water vapour, J/(kg·K)
+	minValid = 1e-6  // relative humidity below this has no defined dew point
+)
+
+// saturationVapourPressure returns the saturation vapour pressure in hPa
+func saturationVapourPressure(temperature float64) float64 {
+	return magnusC * math.Exp(magnusA*temperature/(magnusB+temperature))
+}
+
+// vapourPressure returns the actual vapour pressure in hPa
+func vapourPressure(temperature, humidity float64) float64 {
+	return humidity / 100.0 * saturationVapourPressure(temperature)
+}
+
+// dewPoint returns the dew point in °C using the Magnus formula
+func dewPoint(temperature, humidity float64) float64 {
+	if humidity < minValid {
+		return math.NaN()
+	}
+	gamma := math.Log(humidity/100.0) + magnusA*temperature/(magnusB+temperature)
+	return magnusB * gamma / (magnusA - gamma)
+}
+
+// absoluteHumidity returns the water vapour density in g/m³
+func absoluteHumidity(temperature, humidity float64) float64 {
+	// e [hPa] * 100 -> Pa; divide by Rv*T for kg/m³; * 1000 -> g/m³
+	return vapourPressure(temperature, humidity) * 100.0 / (waterR * (temperature + kelvin)) * 1000.0
+}
+
+// vapourPressureDeficit returns the vapour pressure deficit in kPa
+func vapourPressureDeficit(temperature, humidity float64) float64 {
+	return (saturationVapourPressure(temperature) - vapourPressure(temperature, humidity)) / 10.0
+}
+
+// heatIndex returns the NWS heat index in °C (Rothfusz regression with Steadman's
+// simple formula below 80°F and the NWS low/high humidity adjustments)
+func heatIndex(temperature, humidity float64) float64 {
+	t := temperature*9.0/5.0 + 32.0
+
+	hi := 0.5 * (t + 61.0 + (t-68.0)*1.2 + humidity*0.094)
+	if (hi+t)/2.0 >= 80.0 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*humidity -
+			0.22475541*t*humidity - 0.00683783*t*t -
+			0.05481717*humidity*humidity + 0.00122874*t*t*humidity +
+			0.00085282*t*humidity*humidity - 0.00000199*t*t*humidity*humidity
+
+		if humidity < 13.0 && t >= 80.0 && t <= 112.0 {
+			hi -= (13.0 - humidity) / 4.0 * math.Sqrt((17.0-math.Abs(t-95.0))/17.0)
+		} else if humidity > 85.0 && t >= 80.0 && t <= 87.0 {
+			hi += (humidity - 85.0) / 10.0 * (87.0 - t) / 5.0
+		}
+	}
+
+	return (hi - 32.0) * 5.0 / 9.0
+}
+
+// humidex returns the Canadian humidex in °C
+func humidex(temperature, humidity float64) float64 {
+	return temperature + 0.5555*(vapourPressure(temperature, humidity)-10.0)
+}
+
+// derivedMetric is one psychrometric quantity exported for sensors and Open-Meteo
+type derivedMetric struct {
+	enabled func(DerivedMetricsConfig) bool
+	compute func(temperature, humidity float64) float64
+	device  *prometheus.GaugeVec
+	outdoor *prometheus.GaugeVec
+}
+
+func newDerivedMetric(name, help string, enabled func(DerivedMetricsConfig) bool, compute func(float64, float64) float64) derivedMetric {
+	return derivedMetric{
+		enabled: enabled,
+		compute: compute,
+		device: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "govee_h5075_" + name,
+				Help: help + " derived from Govee sensor readings",
+			},
+			[]string{"name"},
+		),
+		// A label-less vector so the series can be removed when disabled
+		outdoor: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "openmeteo_" + name,
+				Help: help + " derived from OpenMeteo API data",
+			},
+			nil,
+		),
+	}
+}
+
+var derivedMetrics = []derivedMetric{
+	newDerivedMetric("dew_point", "Dew point (°C)",
+		func(c DerivedMetricsConfig) bool { return c.DewPoint }, dewPoint),
+	newDerivedMetric("absolute_humidity", "Absolute humidity (g/m³)",
+		func(c DerivedMetricsConfig) bool { return c.AbsoluteHumidity }, absoluteHumidity),
+	newDerivedMetric("vapour_pressure_deficit", "Vapour pressure deficit (kPa)",
+		func(c DerivedMetricsConfig) bool { return c.VapourPressureDeficit }, vapourPressureDeficit),
+	newDerivedMetric("heat_index", "Heat index (°C)",
+		func(c DerivedMetricsConfig) bool { return c.HeatIndex }, heatIndex),
+	newDerivedMetric("humidex", "Humidex (°C)",
+		func(c DerivedMetricsConfig) bool { return c.Humidex }, humidex),
+}
+
+// derivedMetricsCollectors returns every derived gauge vector for registration
+func derivedMetricsCollectors() []prometheus.Collector {
+	collectors := make([]prometheus.Collector, 0, 2*len(derivedMetrics))
+	for _, m := range derivedMetrics {
+		collectors = append(collectors, m.device, m.outdoor)
+	}
+	return collectors
+}
+
+// defaultDerivedMetricsConfig enables every derived metric
+func defaultDerivedMetricsConfig() DerivedMetricsConfig {
+	return DerivedMetricsConfig{
+		DewPoint:              defaultDerivedEnabled,
+		AbsoluteHumidity:      defaultDerivedEnabled,
+		VapourPressureDeficit: defaultDerivedEnabled,
+		HeatIndex:             defaultDerivedEnabled,
+		Humidex:               defaultDerivedEnabled,
+	}
+}
+
+// currentDerivedMetricsConfig returns the derived metric toggles of the live config
+func currentDerivedMetricsConfig() DerivedMetricsConfig {
+	currentConfigMu.RLock()
+	defer currentConfigMu.RUnlock()
+	if currentConfig == nil {
+		return defaultDerivedMetricsConfig()
+	}
+	return currentConfig.Metrics.Derived
+}
+
+// updateDerivedMetrics publishes the enabled derived metrics for a sensor reading
+// and removes the disabled ones
+func updateDerivedMetrics(name string, temperature, humidity float64, settings DerivedMetricsConfig) {
+	for _, m := range derivedMetrics {
+		if !m.enabled(settings) {
+			m.device.DeleteLabelValues(name)
+			continue
+		}
+		if value := m.compute(temperature, humidity); !math.IsNaN(value) {
+			m.device.WithLabelValues(name).Set(value)
+		}
+	}
+}
+
+// updateOutdoorDerivedMetrics publishes the enabled derived metrics for the Open-Meteo reading
+func updateOutdoorDerivedMetrics(temperature, humidity float64, settings DerivedMetricsConfig) {
+	for _, m := range derivedMetrics {
+		if !m.enabled(settings) {
+			m.outdoor.Reset()
+			continue
+		}
+		if value := m.compute(temperature, humidity); !math.IsNaN(value) {
+			m.outdoor.WithLabelValues().Set(value)
+		}
+	}
+}
+
+// markDerivedMetricsStale reports NaN for the enabled derived metrics of a sensor
+func markDerivedMetricsStale(name string, settings DerivedMetricsConfig) {
+	for _, m := range derivedMetrics {
+		if m.enabled(settings) {
+			m.device.WithLabelValues(name).Set(math.NaN())
+		}
+	}
+}
+
+// deleteDerivedMetrics removes all derived metrics of a sensor
+func deleteDerivedMetrics(name string) {
+	for _, m := range derivedMetrics {
+		m.device.DeleteLabelValues(name)
+	}
+}
+
+// applyDerivedMetricsConfig drops series of derived metrics disabled by a config reload
+func applyDerivedMetricsConfig(settings DerivedMetricsConfig) {
+	for _, m := range derivedMetrics {
+		if !m.enabled(settings) {
+			m.device.Reset()
+			m.outdoor.Reset()
+		}
+	}
+}
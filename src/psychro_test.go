@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestPsychrometricFormulas(t *testing.T) {
+	tests := []struct {
+		name        string
+		fn          func(float64, float64) float64
+		temperature float64
+		humidity    float64
+		want        float64
+		tolerance   float64
+	}{
+		// Reference values from standard psychrometric tables
+		{"Dew point 20°C 50%", dewPoint, 20, 50, 9.3, 0.1},
+		{"Dew point 30°C 80%", dewPoint, 30, 80, 26.2, 0.1},
+		{"Dew point at saturation", dewPoint, 15, 100, 15, 1e-9},
+		{"Dew point below freezing", dewPoint, -10, 70, -14.5, 0.2},
+		{"Absolute humidity 20°C 50%", absoluteHumidity, 20, 50, 8.65, 0.05},
+		{"Absolute humidity 30°C 100%", absoluteHumidity, 30, 100, 30.4, 0.2},
+		{"VPD 20°C 50%", vapourPressureDeficit, 20, 50, 1.17, 0.01},
+		{"VPD at saturation", vapourPressureDeficit, 25, 100, 0, 1e-9},
+		// NWS heat index chart: 90°F/70% -> 106°F, 80°F/40% -> 80°F
+		{"Heat index 90°F 70%", heatIndex, 32.2222, 70, 41.1, 0.3},
+		{"Heat index 80°F 40%", heatIndex, 26.6667, 40, 26.7, 0.3},
+		{"Heat index mild", heatIndex, 20, 50, 19.4, 0.1},
+		// Environment Canada humidex: 30°C with 15°C dew point -> 34
+		{"Humidex 30°C", humidex, 30, 39.3, 34, 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.fn(tt.temperature, tt.humidity)
+			if math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("got %.3f, want %.3f ± %.3f", got, tt.want, tt.tolerance)
+			}
+		})
+	}
+}
+
+func TestDewPointUndefinedForZeroHumidity(t *testing.T) {
+	if got := dewPoint(20, 0); !math.IsNaN(got) {
+		t.Fatalf("dewPoint(20, 0) = %v, want NaN", got)
+	}
+}
+
+func TestUpdateDerivedMetricsRespectsToggles(t *testing.T) {
+	t.Cleanup(func() { deleteDerivedMetrics("Derived") })
+
+	settings := defaultDerivedMetricsConfig()
+	settings.HeatIndex = false
+	settings.Humidex = false
+	updateDerivedMetrics("Derived", 20, 50, settings)
+
+	// DeleteLabelValues reports whether the series existed
+	want := []bool{true, true, true, false, false}
+	for i, m := range derivedMetrics {
+		if got := m.device.DeleteLabelValues("Derived"); got != want[i] {
+			t.Errorf("derived metric %d exported = %v, want %v", i, got, want[i])
+		}
+	}
+}
+
+func TestUpdateOutdoorDerivedMetrics(t *testing.T) {
+	t.Cleanup(func() { applyDerivedMetricsConfig(DerivedMetricsConfig{}) })
+
+	updateOutdoorDerivedMetrics(20, 50, defaultDerivedMetricsConfig())
+	if got := testutil.ToFloat64(derivedMetrics[0].outdoor.WithLabelValues()); math.Abs(got-9.3) > 0.1 {
+		t.Errorf("openmeteo_dew_point = %v, want ~9.3", got)
+	}
+
+	applyDerivedMetricsConfig(DerivedMetricsConfig{})
+	if n := testutil.CollectAndCount(derivedMetrics[0].outdoor); n != 0 {
+		t.Errorf("disabled outdoor dew point still has %d series", n)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rssiGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "govee_rssi_dbm",
+			Help: "Signal strength of the last advertisement received from each sensor",
+		},
+		[]string{"name"},
+	)
+
+	smoothedRSSIGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "govee_rssi_smoothed_dbm",
+			Help: "Exponentially smoothed signal strength of each sensor",
+		},
+		[]string{"name"},
+	)
+
+	advertisementIntervalGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "govee_advertisement_interval_seconds",
+			Help: "Estimated interval between advertisements received from each sensor",
+		},
+		[]string{"name"},
+	)
+
+	advertisementsReceivedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "govee_advertisements_received_total",
+			Help: "Advertisements received from each configured sensor",
+		},
+		[]string{"name"},
+	)
+
+	advertisementsAcceptedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "govee_advertisements_accepted_total",
+			Help: "Advertisements that produced a valid reading",
+		},
+		[]string{"name"},
+	)
+
+	advertisementsRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "govee_advertisements_rejected_total",
+			Help: "Advertisements that could not be decoded or failed validation",
+		},
+		[]string{"name"},
+	)
+)
+
+// radioSmoothingFactor is the weight of a new sample in the RSSI and interval
+// moving averages
+const radioSmoothingFactor = 0.2
+
+// radioStats tracks the signal and advertisement rate of one sensor
+type radioStats struct {
+	lastSeen     time.Time
+	scanWindow   uint64
+	rssi         int16 // last reported RSSI; 0 if never reported
+	smoothedRSSI float64
+	interval     time.Duration // zero until two advertisements are heard in one scan window
+
+	// Advertisement totals, carried over to the new name when the sensor is renamed
+	received, accepted, rejected float64
+}
+
+var (
+	radioStatsByDevice = make(map[string]*radioStats) // Keyed by MAC
+	radioStatsMu       = &sync.Mutex{}
+
+	// currentScanWindow changes at the start of every BLE scan, so the sleep between
+	// scans is never mistaken for a gap between advertisements
+	currentScanWindow atomic.Uint64
+)
+
+// beginScanWindow marks the start of a new BLE scan
+func beginScanWindow() {
+	currentScanWindow.Add(1)
+}
+
+// recordAdvertisement updates the signal and rate metrics for an advertisement
+// received from a configured sensor. An RSSI of 0 means the platform did not report one.
+// The name is looked up under mutex, so an advertisement that races a rename
+// is never counted under the old name.
+func recordAdvertisement(mac string, rssi int16, now time.Time) {
+	window := currentScanWindow.Load()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	govee, ok := knownGovees[mac]
+	if !ok {
+		return
+	}
+	name := govee.Name
+	advertisementsReceivedCounter.WithLabelValues(name).Inc()
+
+	radioStatsMu.Lock()
+	defer radioStatsMu.Unlock()
+	stats, exists := radioStatsByDevice[mac]
+	if !exists {
+		stats = &radioStats{}
+		radioStatsByDevice[mac] = stats
+	}
+	stats.received++
+
+	if rssi != 0 {
+		if stats.smoothedRSSI == 0 {
+			stats.smoothedRSSI = float64(rssi)
+		} else {
+			stats.smoothedRSSI += radioSmoothingFactor * (float64(rssi) - stats.smoothedRSSI)
+		}
+		stats.rssi = rssi
+		rssiGauge.WithLabelValues(name).Set(float64(rssi))
+		smoothedRSSIGauge.WithLabelValues(name).Set(stats.smoothedRSSI)
+	}
+
+	if exists && stats.scanWindow == window && now.After(stats.lastSeen) {
+		gap := now.Sub(stats.lastSeen)
+		if stats.interval == 0 {
+			stats.interval = gap
+		} else {
+			stats.interval += time.Duration(radioSmoothingFactor * float64(gap-stats.interval))
+		}
+		advertisementIntervalGauge.WithLabelValues(name).Set(stats.interval.Seconds())
+	}
+
+	stats.lastSeen = now
+	stats.scanWindow = window
+}
+
+// recordAdvertisementResult counts whether an advertisement produced a reading
+func recordAdvertisementResult(mac string, accepted bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	govee, ok := knownGovees[mac]
+	if !ok {
+		return
+	}
+
+	radioStatsMu.Lock()
+	defer radioStatsMu.Unlock()
+	stats, ok := radioStatsByDevice[mac]
+	if !ok {
+		stats = &radioStats{}
+		radioStatsByDevice[mac] = stats
+	}
+	if accepted {
+		stats.accepted++
+		advertisementsAcceptedCounter.WithLabelValues(govee.Name).Inc()
+	} else {
+		stats.rejected++
+		advertisementsRejectedCounter.WithLabelValues(govee.Name).Inc()
+	}
+}
+
+// deleteRadioGauges removes the signal and interval gauges of a stale sensor.
+// Counters are kept so rates stay continuous when it comes back.
+func deleteRadioGauges(name string) {
+	rssiGauge.DeleteLabelValues(name)
+	smoothedRSSIGauge.DeleteLabelValues(name)
+	advertisementIntervalGauge.DeleteLabelValues(name)
+}
+
+// deleteRadioMetrics removes all radio series labelled with a sensor name
+func deleteRadioMetrics(name string) {
+	deleteRadioGauges(name)
+	advertisementsReceivedCounter.DeleteLabelValues(name)
+	advertisementsAcceptedCounter.DeleteLabelValues(name)
+	advertisementsRejectedCounter.DeleteLabelValues(name)
+}
+
+// forgetRadioStats drops the radio state of a sensor that is no longer configured
+func forgetRadioStats(mac string) {
+	radioStatsMu.Lock()
+	delete(radioStatsByDevice, mac)
+	radioStatsMu.Unlock()
+}
+
+// renameRadioMetrics exports the advertisement counters of a renamed sensor under
+// its new name with the totals so far, so they continue rather than restart from
+// zero. The gauges follow with the next advertisement. The caller has deleted the
+// series of the old name.
+func renameRadioMetrics(govee KnownGovee) {
+	radioStatsMu.Lock()
+	defer radioStatsMu.Unlock()
+	stats, ok := radioStatsByDevice[govee.MAC]
+	if !ok {
+		return
+	}
+	advertisementsReceivedCounter.WithLabelValues(govee.Name).Add(stats.received)
+	advertisementsAcceptedCounter.WithLabelValues(govee.Name).Add(stats.accepted)
+	advertisementsRejectedCounter.WithLabelValues(govee.Name).Add(stats.rejected)
+}
+
+// lastRSSI returns the most recent RSSI reported for a sensor
+func lastRSSI(mac string) (int16, bool) {
+	radioStatsMu.Lock()
+	defer radioStatsMu.Unlock()
+
+	stats, ok := radioStatsByDevice[mac]
+	if !ok || stats.rssi == 0 {
+		return 0, false
+	}
+	return stats.rssi, true
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"tinygo.org/x/bluetooth"
+)
+
+// fakeAdvertisement implements bluetooth.AdvertisementPayload by embedding the
+// interface and overriding only the methods scanCallback uses.
+type fakeAdvertisement struct {
+	bluetooth.AdvertisementPayload
+	localName string
+	elements  []bluetooth.ManufacturerDataElement
+}
+
+func (a fakeAdvertisement) LocalName() string { return a.localName }
+func (a fakeAdvertisement) ManufacturerData() []bluetooth.ManufacturerDataElement {
+	return a.elements
+}
+
+func fakeScanResult(t *testing.T, mac string, rssi int16, elements ...bluetooth.ManufacturerDataElement) bluetooth.ScanResult {
+	t.Helper()
+	addr, err := bluetooth.ParseMAC(mac)
+	if err != nil {
+		t.Fatalf("parse MAC %s: %v", mac, err)
+	}
+	return bluetooth.ScanResult{
+		Address:              bluetooth.Address{MACAddress: bluetooth.MACAddress{MAC: addr}},
+		RSSI:                 rssi,
+		AdvertisementPayload: fakeAdvertisement{elements: elements},
+	}
+}
+
+func TestRecordAdvertisementSmoothing(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	deleteRadioMetrics("Radio")
+	t.Cleanup(func() { deleteRadioMetrics("Radio") })
+
+	const mac = "A4:C1:38:00:00:08"
+	mutex.Lock()
+	knownGovees[mac] = KnownGovee{MAC: mac, Name: "Radio"}
+	mutex.Unlock()
+
+	beginScanWindow()
+	start := time.Now()
+	recordAdvertisement(mac, -60, start)
+	recordAdvertisement(mac, -70, start.Add(2*time.Second))
+	recordAdvertisement(mac, 0, start.Add(4*time.Second)) // RSSI not reported
+
+	if got := testutil.ToFloat64(rssiGauge.WithLabelValues("Radio")); got != -70 {
+		t.Errorf("last RSSI = %v, want -70", got)
+	}
+	if got := testutil.ToFloat64(smoothedRSSIGauge.WithLabelValues("Radio")); got != -62 {
+		t.Errorf("smoothed RSSI = %v, want -62", got)
+	}
+	if got := testutil.ToFloat64(advertisementIntervalGauge.WithLabelValues("Radio")); got != 2 {
+		t.Errorf("interval = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(advertisementsReceivedCounter.WithLabelValues("Radio")); got != 3 {
+		t.Errorf("received = %v, want 3", got)
+	}
+
+	// The gap across a scan window boundary is the scan sleep, not an advertisement interval
+	beginScanWindow()
+	recordAdvertisement(mac, -70, start.Add(60*time.Second))
+	if got := testutil.ToFloat64(advertisementIntervalGauge.WithLabelValues("Radio")); got != 2 {
+		t.Errorf("interval after new scan window = %v, want 2", got)
+	}
+
+	recordAdvertisement(mac, -70, start.Add(64*time.Second))
+	if got := testutil.ToFloat64(advertisementIntervalGauge.WithLabelValues("Radio")); got != 2.4 {
+		t.Errorf("smoothed interval = %v, want 2.4", got)
+	}
+}
+
+func TestScanCallbackCountsAdvertisements(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	deleteRadioMetrics("Porch")
+	t.Cleanup(func() {
+		deleteRadioMetrics("Porch")
+		readingsRejectedCounter.DeletePartialMatch(prometheus.Labels{"name": "Porch"})
+	})
+
+	mutex.Lock()
+	knownGovees["A4:C1:38:00:00:09"] = KnownGovee{MAC: "A4:C1:38:00:00:09", Name: "Porch"}
+	mutex.Unlock()
+
+	valid := bluetooth.ManufacturerDataElement{CompanyID: goveeManufacturerID, Data: []byte{0x00, 0x01, 0x56, 0x32, 0x64, 0x00}}
+	invalid := bluetooth.ManufacturerDataElement{CompanyID: goveeManufacturerID, Data: []byte{0x00, 0x00, 0x00, 0x00, 0x64, 0x00}}
+	beacon := bluetooth.ManufacturerDataElement{CompanyID: 0x004C, Data: []byte{0x02, 0x15}}
+
+	scanCallback(fakeScanResult(t, "A4:C1:38:00:00:09", -55, beacon, valid))
+	scanCallback(fakeScanResult(t, "A4:C1:38:00:00:09", -57, invalid))
+	scanCallback(fakeScanResult(t, "A4:C1:38:00:00:09", -59, beacon))
+
+	if got := testutil.ToFloat64(advertisementsReceivedCounter.WithLabelValues("Porch")); got != 3 {
+		t.Errorf("received = %v, want 3", got)
+	}
+	if got := testutil.ToFloat64(advertisementsAcceptedCounter.WithLabelValues("Porch")); got != 1 {
+		t.Errorf("accepted = %v, want 1", got)
+	}
+	// The beacon frames are ignored, so only the invalid payload is rejected
+	if got := testutil.ToFloat64(advertisementsRejectedCounter.WithLabelValues("Porch")); got != 1 {
+		t.Errorf("rejected = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(readingsRejectedCounter.WithLabelValues("Porch", rejectNoDecoder)); got != 0 {
+		t.Errorf("rejected without a decoder = %v, want 0 for beacon frames", got)
+	}
+
+	// A Govee payload under the company ID of another model has no decoder
+	mutex.Lock()
+	knownGovees["A4:C1:38:00:00:09"] = KnownGovee{MAC: "A4:C1:38:00:00:09", Name: "Porch", Model: "H5179"}
+	mutex.Unlock()
+	scanCallback(fakeScanResult(t, "A4:C1:38:00:00:09", -59, valid))
+	if got := testutil.ToFloat64(readingsRejectedCounter.WithLabelValues("Porch", rejectNoDecoder)); got != 1 {
+		t.Errorf("rejected without a decoder = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(rssiGauge.WithLabelValues("Porch")); got != -59 {
+		t.Errorf("RSSI = %v, want -59", got)
+	}
+}
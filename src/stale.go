@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Stale policies: what happens to a device's reading series when it goes stale
+const (
+	stalePolicyDelete = "delete" // Remove the series
+	stalePolicyKeep   = "keep"   // Keep exporting the last value
+	stalePolicyNaN    = "nan"    // Keep the series but report NaN
+)
+
+var lastSeenGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "govee_h5075_last_seen_timestamp_seconds",
+		Help: "Unix time of the last accepted reading from the device",
+	},
+	[]string{"name"},
+)
+
+// staleMissCounts counts the consecutive status checks that found a device past
+// its stale threshold and grace period, keyed by MAC. Guarded by mutex.
+var staleMissCounts = make(map[string]int)
+
+// normalizeStalePolicy validates a stale policy, returning fallback for an empty
+// value and logging invalid ones
+func normalizeStalePolicy(policy, fallback, context string) string {
+	switch p := strings.ToLower(strings.TrimSpace(policy)); p {
+	case "":
+		return fallback
+	case stalePolicyDelete, stalePolicyKeep, stalePolicyNaN:
+		return p
+	default:
+		log.Printf("Warning: Invalid stalePolicy '%s' for %s, using '%s'", policy, context, fallback)
+		return fallback
+	}
+}
+
+// normalizeStaleMisses validates a staleMisses setting, returning fallback for
+// zero and logging negative values
+func normalizeStaleMisses(misses, fallback int, context string) int {
+	switch {
+	case misses == 0:
+		return fallback
+	case misses < 0:
+		log.Printf("Warning: Invalid staleMisses %d for %s, using %d", misses, context, fallback)
+		return fallback
+	default:
+		return misses
+	}
+}
+
+// parseStaleDuration parses an optional staleness duration, returning fallback
+// for an empty value and logging invalid ones
+func parseStaleDuration(s string, fallback time.Duration, context, key string) time.Duration {
+	if strings.TrimSpace(s) == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		log.Printf("Warning: Invalid %s '%s' for %s, using %s", key, s, context, fallback)
+		return fallback
+	}
+	return d
+}
+
+// nextDeviceStatusLocked computes the status of a device with hysteresis: a seen
+// device only goes stale once StaleMisses consecutive checks found it past its
+// threshold plus grace period, and keeps its previous status until then.
+// Caller must hold mutex.
+func nextDeviceStatusLocked(govee KnownGovee, staleThreshold time.Duration, now time.Time) string {
+	if govee.StaleThreshold > 0 {
+		staleThreshold = govee.StaleThreshold
+	}
+	status := deviceStatusLocked(govee.MAC, staleThreshold, now)
+	if status != "stale" {
+		delete(staleMissCounts, govee.MAC)
+		return status
+	}
+
+	previous := deviceStatuses[govee.MAC]
+	if previous == "" || previous == "never_seen" {
+		previous = "active"
+	}
+	if now.Sub(lastUpdateTime[govee.MAC]) <= staleThreshold+govee.StaleGracePeriod {
+		return previous
+	}
+	staleMissCounts[govee.MAC]++
+	if staleMissCounts[govee.MAC] < max(govee.StaleMisses, 1) {
+		return previous
+	}
+	return "stale"
+}
+
+// applyStalePolicyLocked updates the reading series of a device that went stale.
+// Virtual devices have no battery or derived series to mark. Caller must hold mutex.
+func applyStalePolicyLocked(govee KnownGovee) {
+	name := govee.Name
+	switch govee.StalePolicy {
+	case stalePolicyKeep:
+	case stalePolicyNaN:
+		temperatureGauge.WithLabelValues(name).Set(math.NaN())
+		humidityGauge.WithLabelValues(name).Set(math.NaN())
+		if govee.Virtual == nil {
+			batteryGauge.WithLabelValues(name).Set(math.NaN())
+			markDerivedMetricsStale(name, currentDerivedMetricsConfig())
+		}
+	default:
+		deleteReadingMetrics(name)
+	}
+}
+
+// deleteReadingMetrics removes the reading series of a device
+func deleteReadingMetrics(name string) {
+	temperatureGauge.DeleteLabelValues(name)
+	humidityGauge.DeleteLabelValues(name)
+	batteryGauge.DeleteLabelValues(name)
+	deleteDerivedMetrics(name)
+}
+
+// setLastSeen exports the time of a device's last accepted reading
+func setLastSeen(name string, now time.Time) {
+	lastSeenGauge.WithLabelValues(name).Set(float64(now.UnixNano()) / 1e9)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNormalizeStalePolicy(t *testing.T) {
+	tests := []struct {
+		policy, fallback, want string
+	}{
+		{"", stalePolicyDelete, stalePolicyDelete},
+		{"", stalePolicyKeep, stalePolicyKeep},
+		{"NaN", stalePolicyDelete, stalePolicyNaN},
+		{" keep ", stalePolicyDelete, stalePolicyKeep},
+		{"forget", stalePolicyNaN, stalePolicyNaN},
+	}
+	for _, tt := range tests {
+		if got := normalizeStalePolicy(tt.policy, tt.fallback, "test"); got != tt.want {
+			t.Errorf("normalizeStalePolicy(%q, %q) = %q, want %q", tt.policy, tt.fallback, got, tt.want)
+		}
+	}
+}
+
+func TestStalePolicies(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Cleanup(func() {
+		for _, name := range []string{"Deleted", "Kept", "Blank"} {
+			deleteReadingMetrics(name)
+			lastSeenGauge.DeleteLabelValues(name)
+		}
+	})
+
+	config := &Config{}
+	config.Metrics.StaleThreshold = "5m"
+	config.Metrics.StalePolicy = "keep"
+	config.Devices = []Device{
+		{MAC: "AA:BB:CC:DD:EE:01", Name: "Deleted", StalePolicy: "delete"},
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "Kept"},
+		{MAC: "AA:BB:CC:DD:EE:03", Name: "Blank", StalePolicy: "nan"},
+	}
+	loadKnownGovees(config)
+
+	lastSeen := time.Now().Add(-10 * time.Minute)
+	mutex.Lock()
+	for mac, govee := range knownGovees {
+		lastUpdateTime[mac] = lastSeen
+		temperatureGauge.WithLabelValues(govee.Name).Set(21.5)
+		setLastSeen(govee.Name, lastSeen)
+	}
+	mutex.Unlock()
+
+	checkForStaleMetrics(config)
+
+	// DeleteLabelValues reports whether the series still existed
+	if temperatureGauge.DeleteLabelValues("Deleted") {
+		t.Error("Deleted temperature series should have been removed")
+	}
+	if got := testutil.ToFloat64(temperatureGauge.WithLabelValues("Kept")); got != 21.5 {
+		t.Errorf("Kept temperature = %v, want the last value 21.5", got)
+	}
+	if got := testutil.ToFloat64(temperatureGauge.WithLabelValues("Blank")); !math.IsNaN(got) {
+		t.Errorf("Blank temperature = %v, want NaN", got)
+	}
+	want := float64(lastSeen.UnixNano()) / 1e9
+	if got := testutil.ToFloat64(lastSeenGauge.WithLabelValues("Deleted")); got != want {
+		t.Errorf("last seen = %v, want %v regardless of the policy", got, want)
+	}
+}
+
+func TestStaleHysteresis(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	now := time.Now()
+	mutex.Lock()
+	knownGovees["AA:BB:CC:DD:EE:01"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Office"}
+	knownGovees["AA:BB:CC:DD:EE:02"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:02", Name: "Garden", StaleThreshold: 15 * time.Minute, StaleMisses: 2, StaleGracePeriod: 5 * time.Minute}
+	lastUpdateTime["AA:BB:CC:DD:EE:01"] = now.Add(-10 * time.Minute)
+	lastUpdateTime["AA:BB:CC:DD:EE:02"] = now.Add(-10 * time.Minute)
+	setDeviceStatusLocked(knownGovees["AA:BB:CC:DD:EE:01"], "active")
+	setDeviceStatusLocked(knownGovees["AA:BB:CC:DD:EE:02"], "active")
+
+	statuses := func(now time.Time) (string, string) {
+		updateAllDeviceStatusesLocked(5*time.Minute, now)
+		return deviceStatuses["AA:BB:CC:DD:EE:01"], deviceStatuses["AA:BB:CC:DD:EE:02"]
+	}
+
+	// Garden has its own threshold, Office uses the global one
+	if office, garden := statuses(now); office != "stale" || garden != "active" {
+		t.Fatalf("statuses = %s/%s, want stale/active", office, garden)
+	}
+	// Past the threshold but within the grace period: not a miss
+	if _, garden := statuses(now.Add(8 * time.Minute)); garden != "active" || staleMissCounts["AA:BB:CC:DD:EE:02"] != 0 {
+		t.Fatalf("Garden = %s with %d misses within the grace period", garden, staleMissCounts["AA:BB:CC:DD:EE:02"])
+	}
+	// The first miss is tolerated, the second one marks the device stale
+	if _, garden := statuses(now.Add(11 * time.Minute)); garden != "active" {
+		t.Fatalf("Garden = %s after one miss, want active", garden)
+	}
+	if _, garden := statuses(now.Add(12 * time.Minute)); garden != "stale" {
+		t.Fatalf("Garden = %s after two misses, want stale", garden)
+	}
+
+	// A reading resets the misses
+	lastUpdateTime["AA:BB:CC:DD:EE:02"] = now.Add(12 * time.Minute)
+	setDeviceStatusLocked(knownGovees["AA:BB:CC:DD:EE:02"], "active")
+	if _, garden := statuses(now.Add(13 * time.Minute)); garden != "active" || staleMissCounts["AA:BB:CC:DD:EE:02"] != 0 {
+		t.Fatalf("Garden = %s with %d misses after a reading", garden, staleMissCounts["AA:BB:CC:DD:EE:02"])
+	}
+	mutex.Unlock()
+
+	transitions := func(name, from, to string) float64 {
+		return testutil.ToFloat64(deviceStatusTransitionsCounter.WithLabelValues(name, from, to))
+	}
+	if got := transitions("Garden", "active", "stale"); got != 1 {
+		t.Errorf("Garden active->stale transitions = %v, want 1", got)
+	}
+	if got := transitions("Garden", "stale", "active"); got != 1 {
+		t.Errorf("Garden stale->active transitions = %v, want 1", got)
+	}
+	if got := transitions("Office", "active", "stale"); got != 1 {
+		t.Errorf("Office active->stale transitions = %v, want 1", got)
+	}
+}
+
+func TestLoadKnownGoveesResolvesStaleness(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	misses := 4
+	config := &Config{}
+	config.Metrics.StaleThreshold = "5m"
+	config.Metrics.StaleMisses = 2
+	config.Metrics.StaleGracePeriod = "1m"
+	config.Devices = []Device{
+		{MAC: "AA:BB:CC:DD:EE:01", Name: "Office"},
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "Garden", StaleThreshold: "15m", StaleMisses: &misses, StaleGracePeriod: "soon"},
+	}
+	loadKnownGovees(config)
+
+	mutex.Lock()
+	office, garden := knownGovees["AA:BB:CC:DD:EE:01"], knownGovees["AA:BB:CC:DD:EE:02"]
+	mutex.Unlock()
+	if office.StaleThreshold != 0 || office.StaleMisses != 2 || office.StaleGracePeriod != time.Minute {
+		t.Errorf("Office staleness = %v/%d/%v, want 0/2/1m", office.StaleThreshold, office.StaleMisses, office.StaleGracePeriod)
+	}
+	// An invalid grace period falls back to the global one
+	if garden.StaleThreshold != 15*time.Minute || garden.StaleMisses != 4 || garden.StaleGracePeriod != time.Minute {
+		t.Errorf("Garden staleness = %v/%d/%v, want 15m/4/1m", garden.StaleThreshold, garden.StaleMisses, garden.StaleGracePeriod)
+	}
+}
+
+func TestStaleCheckerFollowsReloadedInterval(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	config := &Config{}
+	config.Metrics.RefreshInterval = "1h"
+	config.Metrics.StaleThreshold = "1m"
+	withCurrentConfig(t, config)
+
+	mutex.Lock()
+	knownGovees["AA:BB:CC:DD:EE:01"] = KnownGovee{MAC: "AA:BB:CC:DD:EE:01", Name: "Porch"}
+	lastUpdateTime["AA:BB:CC:DD:EE:01"] = time.Now().Add(-time.Hour)
+	deviceStatuses["AA:BB:CC:DD:EE:01"] = "active"
+	mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		startStaleMetricsChecker(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// Lowering the interval applies at once, not after the hour the old ticker waits
+	reloaded := *config
+	reloaded.Metrics.RefreshInterval = "10ms"
+	withCurrentConfig(t, &reloaded)
+	notifyStaleChecker()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mutex.Lock()
+		status := deviceStatuses["AA:BB:CC:DD:EE:01"]
+		mutex.Unlock()
+		if status == "stale" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %s, want stale once the reloaded interval applies", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Thresholds are the warning thresholds that apply to one device
+type Thresholds struct {
+	TemperatureMin  float64 `json:"temperatureMin"`
+	TemperatureMax  float64 `json:"temperatureMax"`
+	TemperatureLow  float64 `json:"temperatureLow"`
+	TemperatureHigh float64 `json:"temperatureHigh"`
+	HumidityLow     float64 `json:"humidityLow"`
+	HumidityHigh    float64 `json:"humidityHigh"`
+	BatteryLow      float64 `json:"batteryLow"`
+}
+
+// thresholdGauge exports one resolved threshold per device
+type thresholdGauge struct {
+	gauge *prometheus.GaugeVec
+	value func(Thresholds) float64
+}
+
+func newThresholdGauge(name, help string, value func(Thresholds) float64) thresholdGauge {
+	return thresholdGauge{
+		gauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "govee_threshold_" + name,
+				Help: help + " that applies to the device",
+			},
+			[]string{"name"},
+		),
+		value: value,
+	}
+}
+
+var thresholdGauges = []thresholdGauge{
+	newThresholdGauge("temperature_low", "Low temperature threshold (°C)",
+		func(t Thresholds) float64 { return t.TemperatureLow }),
+	newThresholdGauge("temperature_high", "High temperature threshold (°C)",
+		func(t Thresholds) float64 { return t.TemperatureHigh }),
+	newThresholdGauge("humidity_low", "Low humidity threshold (%)",
+		func(t Thresholds) float64 { return t.HumidityLow }),
+	newThresholdGauge("humidity_high", "High humidity threshold (%)",
+		func(t Thresholds) float64 { return t.HumidityHigh }),
+	newThresholdGauge("battery_low", "Low battery threshold (%)",
+		func(t Thresholds) float64 { return t.BatteryLow }),
+}
+
+// thresholdCollectors returns the threshold gauges for registration
+func thresholdCollectors() []prometheus.Collector {
+	collectors := make([]prometheus.Collector, 0, len(thresholdGauges))
+	for _, g := range thresholdGauges {
+		collectors = append(collectors, g.gauge)
+	}
+	return collectors
+}
+
+// setThresholdMetrics exports the resolved thresholds of a device
+func setThresholdMetrics(name string, t Thresholds) {
+	for _, g := range thresholdGauges {
+		g.gauge.WithLabelValues(name).Set(g.value(t))
+	}
+}
+
+// deleteThresholdMetrics removes the threshold series of a device
+func deleteThresholdMetrics(name string) {
+	for _, g := range thresholdGauges {
+		g.gauge.DeleteLabelValues(name)
+	}
+}
+
+// globalThresholds returns the thresholds configured under the top-level thresholds key
+func globalThresholds(config *Config) Thresholds {
+	return Thresholds{
+		TemperatureMin:  config.Thresholds.Temperature.Min,
+		TemperatureMax:  config.Thresholds.Temperature.Max,
+		TemperatureLow:  config.Thresholds.Temperature.Low,
+		TemperatureHigh: config.Thresholds.Temperature.High,
+		HumidityLow:     config.Thresholds.Humidity.Low,
+		HumidityHigh:    config.Thresholds.Humidity.High,
+		BatteryLow:      config.Thresholds.Battery.Low,
+	}
+}
+
+// override replaces the thresholds that are set in o
+func (t Thresholds) override(o ThresholdOverrides) Thresholds {
+	for _, f := range []struct {
+		dst *float64
+		src *float64
+	}{
+		{&t.TemperatureMin, o.Temperature.Min},
+		{&t.TemperatureMax, o.Temperature.Max},
+		{&t.TemperatureLow, o.Temperature.Low},
+		{&t.TemperatureHigh, o.Temperature.High},
+		{&t.HumidityLow, o.Humidity.Low},
+		{&t.HumidityHigh, o.Humidity.High},
+		{&t.BatteryLow, o.Battery.Low},
+	} {
+		if f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	return t
+}
+
+// groupThresholdOverrides maps group names to their threshold overrides
+func groupThresholdOverrides(config *Config) map[string]ThresholdOverrides {
+	groups := make(map[string]ThresholdOverrides, len(config.Groups))
+	for _, group := range config.Groups {
+		if group.Name == "" {
+			log.Println("Warning: Skipping group with missing name")
+			continue
+		}
+		if _, ok := groups[group.Name]; ok {
+			log.Printf("Warning: Group '%s' is configured more than once, using the last entry", group.Name)
+		}
+		groups[group.Name] = group.Thresholds
+	}
+	return groups
+}
+
+// resolveGroupThresholds applies the overrides of a group and of the groups it
+// is nested in, outermost first, to the global thresholds
+func resolveGroupThresholds(global Thresholds, groups map[string]ThresholdOverrides, group string) Thresholds {
+	t := global
+	for _, name := range groupAncestors(group) {
+		t = t.override(groups[name])
+	}
+	return t
+}
+
+// resolveThresholds applies the group and then the device overrides to the global thresholds
+func resolveThresholds(global Thresholds, groups map[string]ThresholdOverrides, device Device) Thresholds {
+	return resolveGroupThresholds(global, groups, device.Group).override(device.Thresholds)
+}
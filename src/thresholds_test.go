@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spf13/viper"
+)
+
+const thresholdsTestYAML = `
+thresholds:
+  temperature:
+    min: -20
+    max: 40
+    low: 0
+    high: 35
+  humidity:
+    low: 30
+    high: 70
+  battery:
+    low: 5
+groups:
+  - name: Cellar
+    thresholds:
+      temperature:
+        low: 10
+        high: 16
+      humidity:
+        high: 80
+  - name: Cellar/Wine rack
+    thresholds:
+      humidity:
+        low: 50
+devices:
+  - mac: "AA:BB:CC:DD:EE:01"
+    name: Office
+  - mac: "AA:BB:CC:DD:EE:02"
+    name: Wine
+    group: Cellar
+  - mac: "AA:BB:CC:DD:EE:03"
+    name: Freezer
+    group: Cellar
+    thresholds:
+      temperature:
+        min: -30
+        low: -25
+        high: 0
+      battery:
+        low: 0
+  - mac: "AA:BB:CC:DD:EE:04"
+    name: Rack
+    group: Cellar/Wine rack
+`
+
+func TestThresholdResolution(t *testing.T) {
+	t.Chdir(t.TempDir())
+	viper.Reset()
+	if err := os.WriteFile("config.yaml", []byte(thresholdsTestYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, _, err := initConfig()
+	if err != nil {
+		t.Fatalf("initConfig: %v", err)
+	}
+
+	global := globalThresholds(config)
+	groups := groupThresholdOverrides(config)
+	resolved := make(map[string]Thresholds)
+	for _, device := range config.Devices {
+		resolved[device.Name] = resolveThresholds(global, groups, device)
+	}
+
+	want := map[string]Thresholds{
+		"Office":  global,
+		"Wine":    {TemperatureMin: -20, TemperatureMax: 40, TemperatureLow: 10, TemperatureHigh: 16, HumidityLow: 30, HumidityHigh: 80, BatteryLow: 5},
+		"Freezer": {TemperatureMin: -30, TemperatureMax: 40, TemperatureLow: -25, TemperatureHigh: 0, HumidityLow: 30, HumidityHigh: 80, BatteryLow: 0},
+		"Rack":    {TemperatureMin: -20, TemperatureMax: 40, TemperatureLow: 10, TemperatureHigh: 16, HumidityLow: 50, HumidityHigh: 80, BatteryLow: 5},
+	}
+	for name, w := range want {
+		if resolved[name] != w {
+			t.Errorf("%s thresholds = %+v, want %+v", name, resolved[name], w)
+		}
+	}
+}
+
+func TestLoadKnownGoveesExportsThresholds(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+
+	high := 16.0
+	config := apiTestConfig()
+	config.Groups = []Group{{Name: "Cellar"}}
+	config.Groups[0].Thresholds.Temperature.High = &high
+	config.Devices = []Device{
+		{MAC: "AA:BB:CC:DD:EE:01", Name: "Office"},
+		{MAC: "AA:BB:CC:DD:EE:02", Name: "Wine", Group: "Cellar"},
+	}
+	loadKnownGovees(config)
+
+	if got := testutil.ToFloat64(thresholdGauges[1].gauge.WithLabelValues("Wine")); got != 16 {
+		t.Errorf("Wine temperature_high = %v, want 16", got)
+	}
+	if got := testutil.ToFloat64(thresholdGauges[1].gauge.WithLabelValues("Office")); got != 35 {
+		t.Errorf("Office temperature_high = %v, want 35", got)
+	}
+
+	// Removing a device removes its threshold series
+	config.Devices = config.Devices[:1]
+	loadKnownGovees(config)
+	for _, g := range thresholdGauges {
+		if n := testutil.CollectAndCount(g.gauge); n != 1 {
+			t.Errorf("%d series left after removing Wine, want 1", n)
+		}
+	}
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openMeteoInput names the Open-Meteo reading in virtual device expressions
+const openMeteoInput = "openmeteo"
+
+// virtualKeyPrefix marks the knownGovees keys of virtual devices; a MAC never starts with it
+const virtualKeyPrefix = "virtual:"
+
+// virtualDeviceKey returns the knownGovees key of a virtual device
+func virtualDeviceKey(name string) string {
+	return virtualKeyPrefix + name
+}
+
+// virtualInputs supplies the current values that virtual expressions refer to
+type virtualInputs interface {
+	value(name, metric string) (float64, bool)
+}
+
+// virtualNode is one node of a compiled expression. eval reports false when an
+// input the node needs has no current value.
+type virtualNode interface {
+	eval(inputs virtualInputs, metric string) (float64, bool)
+}
+
+type virtualNumber float64
+
+func (n virtualNumber) eval(virtualInputs, string) (float64, bool) {
+	return float64(n), true
+}
+
+// virtualRef is a device name or openmeteo. An empty metric follows the metric
+// being computed.
+type virtualRef struct {
+	name, metric string
+}
+
+func (r virtualRef) eval(inputs virtualInputs, metric string) (float64, bool) {
+	if r.metric != "" {
+		metric = r.metric
+	}
+	return inputs.value(r.name, metric)
+}
+
+type virtualNegate struct {
+	operand virtualNode
+}
+
+func (n virtualNegate) eval(inputs virtualInputs, metric string) (float64, bool) {
+	v, ok := n.operand.eval(inputs, metric)
+	return -v, ok
+}
+
+type virtualBinary struct {
+	op          byte
+	left, right virtualNode
+}
+
+func (b virtualBinary) eval(inputs virtualInputs, metric string) (float64, bool) {
+	l, ok := b.left.eval(inputs, metric)
+	if !ok {
+		return 0, false
+	}
+	r, ok := b.right.eval(inputs, metric)
+	if !ok {
+		return 0, false
+	}
+	switch b.op {
+	case '+':
+		return l + r, true
+	case '-':
+		return l - r, true
+	case '*':
+		return l * r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l / r, true
+	}
+}
+
+// virtualCall aggregates its arguments, skipping those without a current value,
+// so avg(Office, Attic) carries on with Office alone while Attic is stale
+type virtualCall struct {
+	fn   string
+	args []virtualNode
+}
+
+// virtualFunctions are the aggregates an expression can call
+var virtualFunctions = map[string]func(values []float64) float64{
+	"avg": func(values []float64) float64 { return virtualSum(values) / float64(len(values)) },
+	"min": slices.Min[[]float64],
+	"max": slices.Max[[]float64],
+	"sum": virtualSum,
+}
+
+func virtualSum(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum
+}
+
+func (c virtualCall) eval(inputs virtualInputs, metric string) (float64, bool) {
+	values := make([]float64, 0, len(c.args))
+	for _, arg := range c.args {
+		if v, ok := arg.eval(inputs, metric); ok {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return 0, false
+	}
+	return virtualFunctions[c.fn](values), true
+}
+
+// virtualExpression is a compiled virtual device expression
+type virtualExpression struct {
+	source string
+	root   virtualNode
+	refs   []string // Device names and openmeteo it refers to, sorted
+}
+
+// evaluate computes the expression for a metric; the result is false when an
+// input is missing or the result is not a finite number
+func (e *virtualExpression) evaluate(inputs virtualInputs, metric string) (float64, bool) {
+	v, ok := e.root.eval(inputs, metric)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// virtualToken is a lexical token: a number, a name (bare or quoted) or one of + - * / ( ) , .
+type virtualToken struct {
+	kind byte // 'n' number, 'a' name, or the operator itself
+	text string
+	pos  int
+}
+
+// tokenizeVirtual splits an expression into tokens
+func tokenizeVirtual(src string) ([]virtualToken, error) {
+	var tokens []virtualToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("+-*/(),.", c) >= 0:
+			tokens = append(tokens, virtualToken{kind: c, text: string(c), pos: i})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote at position %d", i+1)
+			}
+			tokens = append(tokens, virtualToken{kind: 'a', text: src[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, virtualToken{kind: 'n', text: src[i:j], pos: i})
+			i = j
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			tokens = append(tokens, virtualToken{kind: 'a', text: src[i:j], pos: i})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected '%c' at position %d", c, i+1)
+		}
+	}
+	return tokens, nil
+}
+
+// virtualParser is a recursive descent parser for virtual device expressions:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | name [ "." metric ] | function "(" expr { "," expr } ")" | "(" expr ")"
+type virtualParser struct {
+	tokens []virtualToken
+	pos    int
+	refs   map[string]bool
+}
+
+func (p *virtualParser) peek() *virtualToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *virtualParser) accept(kind byte) bool {
+	if t := p.peek(); t != nil && t.kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// unexpected describes the token at the current position
+func (p *virtualParser) unexpected() error {
+	t := p.peek()
+	if t == nil {
+		return fmt.Errorf("unexpected end of expression")
+	}
+	return fmt.Errorf("unexpected '%s' at position %d", t.text, t.pos+1)
+}
+
+func (p *virtualParser) expr() (virtualNode, error) {
+	node, err := p.term()
+	for err == nil {
+		t := p.peek()
+		if t == nil || (t.kind != '+' && t.kind != '-') {
+			break
+		}
+		p.pos++
+		var right virtualNode
+		right, err = p.term()
+		node = virtualBinary{op: t.kind, left: node, right: right}
+	}
+	return node, err
+}
+
+func (p *virtualParser) term() (virtualNode, error) {
+	node, err := p.unary()
+	for err == nil {
+		t := p.peek()
+		if t == nil || (t.kind != '*' && t.kind != '/') {
+			break
+		}
+		p.pos++
+		var right virtualNode
+		right, err = p.unary()
+		node = virtualBinary{op: t.kind, left: node, right: right}
+	}
+	return node, err
+}
+
+func (p *virtualParser) unary() (virtualNode, error) {
+	if p.accept('-') {
+		operand, err := p.unary()
+		return virtualNegate{operand: operand}, err
+	}
+	return p.primary()
+}
+
+func (p *virtualParser) primary() (virtualNode, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, p.unexpected()
+	}
+	switch t.kind {
+	case 'n':
+		p.pos++
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", t.text, t.pos+1)
+		}
+		return virtualNumber(v), nil
+	case '(':
+		p.pos++
+		node, err := p.expr()
+		if err == nil && !p.accept(')') {
+			err = p.unexpected()
+		}
+		return node, err
+	case 'a':
+		p.pos++
+		if p.accept('(') {
+			return p.call(t)
+		}
+		ref := virtualRef{name: t.text}
+		if p.accept('.') {
+			metric := p.peek()
+			if metric == nil || metric.kind != 'a' || (metric.text != alertMetricTemperature && metric.text != alertMetricHumidity) {
+				return nil, fmt.Errorf("expected temperature or humidity after '%s.'", t.text)
+			}
+			p.pos++
+			ref.metric = metric.text
+		}
+		p.refs[ref.name] = true
+		return ref, nil
+	}
+	return nil, p.unexpected()
+}
+
+// call parses the arguments of a function whose name and "(" were consumed
+func (p *virtualParser) call(name *virtualToken) (virtualNode, error) {
+	if _, ok := virtualFunctions[name.text]; !ok {
+		return nil, fmt.Errorf("unknown function '%s' at position %d", name.text, name.pos+1)
+	}
+	c := virtualCall{fn: name.text}
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+		if p.accept(')') {
+			return c, nil
+		}
+		if !p.accept(',') {
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// compileVirtualExpression parses an expression over device names, openmeteo,
+// numbers, + - * /, parentheses and the avg, min, max and sum functions
+func compileVirtualExpression(src string) (*virtualExpression, error) {
+	tokens, err := tokenizeVirtual(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &virtualParser{tokens: tokens, refs: make(map[string]bool)}
+	root, err := p.expr()
+	if err == nil && p.pos < len(tokens) {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]string, 0, len(p.refs))
+	for name := range p.refs {
+		refs = append(refs, name)
+	}
+	sort.Strings(refs)
+	return &virtualExpression{source: strings.TrimSpace(src), root: root, refs: refs}, nil
+}
+
+// virtualSensor computes the readings of a virtual device
+type virtualSensor struct {
+	temperature *virtualExpression
+	humidity    *virtualExpression
+	inputs      map[string]bool // Device names and openmeteo either expression refers to
+}
+
+// compileVirtualDevice compiles the temperature and humidity expressions of a virtual device
+func compileVirtualDevice(device VirtualDevice) (*virtualSensor, error) {
+	sources := map[string]string{alertMetricTemperature: device.Expression, alertMetricHumidity: device.Expression}
+	if device.Temperature != "" {
+		sources[alertMetricTemperature] = device.Temperature
+	}
+	if device.Humidity != "" {
+		sources[alertMetricHumidity] = device.Humidity
+	}
+
+	v := &virtualSensor{inputs: make(map[string]bool)}
+	for _, metric := range []string{alertMetricTemperature, alertMetricHumidity} {
+		if strings.TrimSpace(sources[metric]) == "" {
+			return nil, fmt.Errorf("needs an expression, or both temperature and humidity")
+		}
+		expr, err := compileVirtualExpression(sources[metric])
+		if err != nil {
+			return nil, fmt.Errorf("%s expression: %w", metric, err)
+		}
+		for _, ref := range expr.refs {
+			v.inputs[ref] = true
+		}
+		if metric == alertMetricTemperature {
+			v.temperature = expr
+		} else {
+			v.humidity = expr
+		}
+	}
+	return v, nil
+}
+
+// evaluate computes a reading; it is false unless both metrics have a value
+func (v *virtualSensor) evaluate(inputs virtualInputs) (lastLoggedValues, bool) {
+	temperature, ok := v.temperature.evaluate(inputs, alertMetricTemperature)
+	if !ok {
+		return lastLoggedValues{}, false
+	}
+	humidity, ok := v.humidity.evaluate(inputs, alertMetricHumidity)
+	if !ok {
+		return lastLoggedValues{}, false
+	}
+	return lastLoggedValues{Temperature: temperature, Humidity: humidity}, true
+}
+
+// describe formats the expressions for logs and the API
+func (v *virtualSensor) describe() string {
+	if v.temperature.source == v.humidity.source {
+		return v.temperature.source
+	}
+	return "temperature " + v.temperature.source + ", humidity " + v.humidity.source
+}
+
+// liveVirtualInputs are the readings of the active physical devices by name,
+// plus the last Open-Meteo reading
+type liveVirtualInputs struct {
+	byName  map[string]lastLoggedValues
+	outdoor *lastLoggedValues
+}
+
+func (in liveVirtualInputs) value(name, metric string) (float64, bool) {
+	values, ok := in.byName[name]
+	if name == openMeteoInput {
+		if in.outdoor == nil {
+			return 0, false
+		}
+		values, ok = *in.outdoor, true
+	}
+	if !ok {
+		return 0, false
+	}
+	if metric == alertMetricHumidity {
+		return values.Humidity, true
+	}
+	return values.Temperature, true
+}
+
+// virtualInputsLocked collects the inputs of virtual expressions. A stale device
+// has no current value, so it drops out of them. Caller must hold mutex.
+func virtualInputsLocked(outdoor *lastLoggedValues) liveVirtualInputs {
+	inputs := liveVirtualInputs{byName: make(map[string]lastLoggedValues), outdoor: outdoor}
+	for mac, govee := range knownGovees {
+		if govee.Virtual != nil || deviceStatuses[mac] != "active" {
+			continue
+		}
+		if values, ok := deviceLastLoggedVals[mac]; ok {
+			inputs.byName[govee.Name] = values
+		}
+	}
+	return inputs
+}
+
+// currentOpenMeteoValues returns the last Open-Meteo reading while the integration is enabled
+func currentOpenMeteoValues() *lastLoggedValues {
+	openMeteoConfigMu.RLock()
+	defer openMeteoConfigMu.RUnlock()
+	if openMeteoConfig == nil || !openMeteoConfig.OpenMeteo.Enabled || lastOpenMeteoValues == nil {
+		return nil
+	}
+	values := *lastOpenMeteoValues
+	return &values
+}
+
+// updateVirtualDevices recomputes the virtual devices that refer to input, a
+// device name or openmeteo, after it produced a reading. A virtual device whose
+// inputs have no value is left alone, so it goes stale like a silent sensor.
+func updateVirtualDevices(input string, now time.Time) {
+	outdoor := currentOpenMeteoValues()
+
+	type virtualReading struct {
+		govee  KnownGovee
+		values lastLoggedValues
+	}
+	var readings []virtualReading
+
+	mutex.Lock()
+	var inputs *liveVirtualInputs
+	for _, govee := range knownGovees {
+		if govee.Virtual == nil || !govee.Virtual.inputs[input] {
+			continue
+		}
+		if inputs == nil {
+			live := virtualInputsLocked(outdoor)
+			inputs = &live
+		}
+		values, ok := govee.Virtual.evaluate(*inputs)
+		if !ok {
+			continue
+		}
+		recordVirtualReadingLocked(govee, values, now)
+		readings = append(readings, virtualReading{govee: govee, values: values})
+	}
+	mutex.Unlock()
+
+	for _, r := range readings {
+		recordHistory(r.govee.Name, r.values.Temperature, r.values.Humidity, nil)
+		evaluateReadingAlerts(r.govee, r.values, now)
+		publishEvent(eventReading, readingEvent{
+			Name:        r.govee.Name,
+			Temperature: r.values.Temperature,
+			Humidity:    r.values.Humidity,
+			Time:        now,
+		})
+	}
+}
+
+// recordVirtualReadingLocked stores and exports a computed reading the way
+// parseGoveeData does for a sensor. Caller must hold mutex.
+func recordVirtualReadingLocked(govee KnownGovee, values lastLoggedValues, now time.Time) {
+	deviceLastLoggedVals[govee.MAC] = values
+	if _, exists := deviceFirstSeen[govee.MAC]; !exists {
+		deviceFirstSeen[govee.MAC] = now
+	}
+	lastUpdateTime[govee.MAC] = now
+	delete(staleMissCounts, govee.MAC)
+
+	temperatureGauge.WithLabelValues(govee.Name).Set(values.Temperature)
+	humidityGauge.WithLabelValues(govee.Name).Set(values.Humidity)
+	setLastSeen(govee.Name, now)
+	setDeviceStatusLocked(govee, "active")
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCompileVirtualExpression(t *testing.T) {
+	inputs := liveVirtualInputs{
+		byName: map[string]lastLoggedValues{
+			"Office":        {Temperature: 21, Humidity: 40},
+			"Attic":         {Temperature: 27, Humidity: 30},
+			"Chest Freezer": {Temperature: -18, Humidity: 70},
+		},
+		outdoor: &lastLoggedValues{Temperature: 12, Humidity: 85},
+	}
+
+	tests := []struct {
+		expr        string
+		temperature float64
+		humidity    float64
+		ok          bool
+	}{
+		{"avg(Office, Attic)", 24, 35, true},
+		{"Attic - openmeteo", 15, -55, true},
+		{"max(Office, Attic, Cellar)", 27, 40, true}, // Cellar has no value and is skipped
+		{"-(Office + 1) * 2 / 4", -11, -20.5, true},
+		{`"Chest Freezer" - 'Office'`, -39, 30, true},
+		{"Office.humidity", 40, 40, true},
+		{"sum(Office, 0.5)", 21.5, 40.5, true},
+		{"Office - Cellar", 0, 0, false}, // Arithmetic needs every input
+		{"min(Cellar)", 0, 0, false},
+		{"Office / (Attic - Attic)", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			expr, err := compileVirtualExpression(tt.expr)
+			if err != nil {
+				t.Fatalf("compile: %v", err)
+			}
+			temperature, ok := expr.evaluate(inputs, alertMetricTemperature)
+			humidity, _ := expr.evaluate(inputs, alertMetricHumidity)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && (math.Abs(temperature-tt.temperature) > 1e-9 || math.Abs(humidity-tt.humidity) > 1e-9) {
+				t.Errorf("= %g / %g, want %g / %g", temperature, humidity, tt.temperature, tt.humidity)
+			}
+		})
+	}
+
+	for expr, want := range map[string]string{
+		"":                    "empty expression",
+		"Office +":            "unexpected end",
+		"median(Office)":      "unknown function 'median'",
+		"avg(Office Attic)":   "unexpected 'Attic'",
+		"Office.battery":      "expected temperature or humidity",
+		`"Office`:             "unterminated quote",
+		"Office # comment":    "unexpected '#'",
+		"(Office":             "unexpected end",
+		"Office) + 1":         "unexpected ')'",
+		"1.2.3":               "invalid number",
+		"avg()":               "unexpected ')'",
+		"Office - - - Attic)": "unexpected ')'",
+	} {
+		if _, err := compileVirtualExpression(expr); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("compileVirtualExpression(%q) error = %v, want %q", expr, err, want)
+		}
+	}
+}
+
+func TestCompileVirtualDevice(t *testing.T) {
+	sensor, err := compileVirtualDevice(VirtualDevice{Name: "Bathrooms", Expression: "max(Bathroom, Ensuite)", Temperature: "avg(Bathroom, Ensuite)"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sensor.describe() != "temperature avg(Bathroom, Ensuite), humidity max(Bathroom, Ensuite)" {
+		t.Errorf("describe = %q", sensor.describe())
+	}
+	if !sensor.inputs["Bathroom"] || !sensor.inputs["Ensuite"] || len(sensor.inputs) != 2 {
+		t.Errorf("inputs = %v", sensor.inputs)
+	}
+
+	if _, err := compileVirtualDevice(VirtualDevice{Name: "Half", Temperature: "Office"}); err == nil {
+		t.Error("a virtual device without a humidity expression should be rejected")
+	}
+}
+
+func TestUpdateVirtualDevices(t *testing.T) {
+	resetState()
+	t.Cleanup(resetState)
+	t.Cleanup(func() {
+		for _, name := range []string{"Office", "Attic", "Indoor"} {
+			deleteReadingMetrics(name)
+			lastSeenGauge.DeleteLabelValues(name)
+		}
+	})
+
+	loadKnownGovees(&Config{
+		Devices: []Device{
+			{MAC: "AA:BB:CC:DD:EE:01", Name: "Office"},
+			{MAC: "AA:BB:CC:DD:EE:02", Name: "Attic"},
+		},
+		VirtualDevices: []VirtualDevice{{Name: "Indoor", Group: "House", Expression: "avg(Office, Attic)"}},
+	})
+
+	key := virtualDeviceKey("Indoor")
+	mutex.Lock()
+	indoor, ok := knownGovees[key]
+	if ok {
+		for mac, values := range map[string]lastLoggedValues{
+			"AA:BB:CC:DD:EE:01": {Temperature: 20, Humidity: 40, Battery: 90},
+			"AA:BB:CC:DD:EE:02": {Temperature: 26, Humidity: 30, Battery: 80},
+		} {
+			deviceLastLoggedVals[mac] = values
+			lastUpdateTime[mac] = time.Now()
+			setDeviceStatusLocked(knownGovees[mac], "active")
+		}
+	}
+	mutex.Unlock()
+	if !ok || indoor.Virtual == nil || indoor.Group != "House" {
+		t.Fatalf("virtual device not loaded: %+v", indoor)
+	}
+	if getStatusValue(t, "Indoor", "never_seen") != 1 {
+		t.Error("virtual device should start as never_seen")
+	}
+
+	// Devices that are not inputs do not trigger an update
+	updateVirtualDevices("Cellar", time.Now())
+	mutex.Lock()
+	_, updated := deviceLastLoggedVals[key]
+	mutex.Unlock()
+	if updated {
+		t.Error("virtual device updated for an unrelated device")
+	}
+
+	updateVirtualDevices("Office", time.Now())
+	if got := testutil.ToFloat64(temperatureGauge.WithLabelValues("Indoor")); got != 23 {
+		t.Errorf("Indoor temperature = %g, want 23", got)
+	}
+	if got := testutil.ToFloat64(humidityGauge.WithLabelValues("Indoor")); got != 35 {
+		t.Errorf("Indoor humidity = %g, want 35", got)
+	}
+	if getStatusValue(t, "Indoor", "active") != 1 {
+		t.Error("virtual device should be active after an update")
+	}
+
+	// A stale input drops out of the average
+	mutex.Lock()
+	setDeviceStatusLocked(knownGovees["AA:BB:CC:DD:EE:02"], "stale")
+	mutex.Unlock()
+	updateVirtualDevices("Office", time.Now())
+	if got := testutil.ToFloat64(temperatureGauge.WithLabelValues("Indoor")); got != 20 {
+		t.Errorf("Indoor temperature with Attic stale = %g, want 20", got)
+	}
+
+	for _, device := range snapshotDevices() {
+		if device.Name != "Indoor" {
+			continue
+		}
+		if device.MAC != "" || device.Virtual != "avg(Office, Attic)" || device.Reading == nil || device.Reading.Battery != nil {
+			t.Errorf("API view of virtual device = %+v", device)
+		}
+		if device.Thresholds == nil || device.Thresholds.Battery != "" {
+			t.Errorf("virtual device thresholds = %+v, want no battery evaluation", device.Thresholds)
+		}
+	}
+}
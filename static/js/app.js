@@ -172,12 +172,17 @@ async function fetchMetrics() {
         // Get current layout mode
         const currentLayout = document.documentElement.getAttribute('data-layout') || 'auto';
         
-        // Helper function to calculate group averages
+        // Helper function to calculate group averages over the cards shown in the
+        // group. Like the exporter's group means, stale and missing devices are left
+        // out, and so are virtual devices, whose inputs are already counted.
         function calculateGroupAverages(roomsInGroup) {
             let tempSum = 0, tempCount = 0;
             let humidSum = 0, humidCount = 0;
             
             roomsInGroup.forEach(({ data }) => {
+                const status = data.status || 'active';
+                if (data.isVirtual) return;
+                if ((status === 'stale' || status === 'never_seen') && !data.isWeatherStation) return;
                 if (typeof data.temperature !== 'undefined') {
                     tempSum += data.temperature;
                     tempCount++;
@@ -211,7 +216,7 @@ async function fetchMetrics() {
                 // Low battery warning only for active devices (not stale/missing)
                 return !isStale && !data.isWeatherStation && 
                        typeof battery !== 'undefined' && 
-                       battery <= BATTERY_LOW_THRESHOLD;
+                       battery <= (data.thresholds || getThresholds()).batteryLow;
             });
         }
         
@@ -436,5 +441,11 @@ document.addEventListener('DOMContentLoaded', () => {
     // Initial fetch and periodic updates
     fetchMetrics();
     resetRefreshInterval();
+
+    // Refresh as soon as the exporter reports new readings
+    connectLiveUpdates(() => {
+        fetchMetrics();
+        resetRefreshInterval();
+    });
 });
 
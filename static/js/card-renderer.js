@@ -1,9 +1,9 @@
 // CardRenderer - Single source of truth for all card rendering logic
 
 // Helper function to normalize temperature
-function normalizeTemp(temp) {
-    const tempRange = MAX_TEMPERATURE - MIN_TEMPERATURE;
-    const normalizedTemp = ((temp - MIN_TEMPERATURE) / tempRange) * 100;
+function normalizeTemp(temp, thresholds = getThresholds()) {
+    const tempRange = thresholds.temperatureMax - thresholds.temperatureMin;
+    const normalizedTemp = ((temp - thresholds.temperatureMin) / tempRange) * 100;
     return Math.max(0, Math.min(100, normalizedTemp));
 }
 
@@ -15,7 +15,7 @@ function escapeHtml(str) {
 }
 
 // Helper function to create metric element
-function createMetricElement(label, value, unit, type, previousValue = null, showPlaceholder = false) {
+function createMetricElement(label, value, unit, type, previousValue = null, showPlaceholder = false, thresholds = getThresholds()) {
     if (showPlaceholder) {
         return `
         <div class="metric ${type}" data-value="-">
@@ -28,20 +28,20 @@ function createMetricElement(label, value, unit, type, previousValue = null, sho
             <div class="progress-bar" 
                  role="progressbar" 
                  aria-valuenow="0" 
-                 aria-valuemin="${type === 'temperature' ? MIN_TEMPERATURE : '0'}" 
-                 aria-valuemax="${type === 'temperature' ? MAX_TEMPERATURE : '100'}"
+                 aria-valuemin="${type === 'temperature' ? thresholds.temperatureMin : '0'}" 
+                 aria-valuemax="${type === 'temperature' ? thresholds.temperatureMax : '100'}"
                  aria-label="${label} level unavailable">
                 <div class="progress" style="width: 0%"></div>
             </div>
         </div>
     `;
     }
-    const percentage = type === 'temperature' ? normalizeTemp(value) : Math.max(0, value);
-    const showBatteryWarning = type === 'battery' && value <= BATTERY_LOW_THRESHOLD;
-    const showFreezingWarning = type === 'temperature' && value < TEMPERATURE_LOW_THRESHOLD;
-    const showHotWarning = type === 'temperature' && value > TEMPERATURE_HIGH_THRESHOLD;
-    const showHighHumidityWarning = type === 'humidity' && value > HUMIDITY_HIGH_THRESHOLD;
-    const showLowHumidityWarning = type === 'humidity' && value < HUMIDITY_LOW_THRESHOLD;
+    const percentage = type === 'temperature' ? normalizeTemp(value, thresholds) : Math.max(0, value);
+    const showBatteryWarning = type === 'battery' && value <= thresholds.batteryLow;
+    const showFreezingWarning = type === 'temperature' && value < thresholds.temperatureLow;
+    const showHotWarning = type === 'temperature' && value > thresholds.temperatureHigh;
+    const showHighHumidityWarning = type === 'humidity' && value > thresholds.humidityHigh;
+    const showLowHumidityWarning = type === 'humidity' && value < thresholds.humidityLow;
     const hasChanged = previousValue !== null && Math.abs(value - previousValue) >= 0.1;
     const changeClass = hasChanged ? 'changed' : '';
     
@@ -108,8 +108,8 @@ function createMetricElement(label, value, unit, type, previousValue = null, sho
             <div class="progress-bar" 
                  role="progressbar" 
                  aria-valuenow="${value}" 
-                 aria-valuemin="${type === 'temperature' ? MIN_TEMPERATURE : '0'}" 
-                 aria-valuemax="${type === 'temperature' ? MAX_TEMPERATURE : '100'}"
+                 aria-valuemin="${type === 'temperature' ? thresholds.temperatureMin : '0'}" 
+                 aria-valuemax="${type === 'temperature' ? thresholds.temperatureMax : '100'}"
                  aria-label="${label} level">
                 <div class="progress" style="width: ${percentage}%"></div>
             </div>
@@ -120,12 +120,13 @@ function createMetricElement(label, value, unit, type, previousValue = null, sho
 // Helper function to create compact metrics
 function createCompactMetrics(data, excludeStatusChip = false) {
     const metrics = [];
+    const thresholds = data.thresholds || getThresholds();
     
     // Temperature
     if (typeof data.temperature !== 'undefined') {
         const temp = data.temperature.toFixed(1);
-        const showFreezingWarning = data.temperature < TEMPERATURE_LOW_THRESHOLD;
-        const showHotWarning = data.temperature > TEMPERATURE_HIGH_THRESHOLD;
+        const showFreezingWarning = data.temperature < thresholds.temperatureLow;
+        const showHotWarning = data.temperature > thresholds.temperatureHigh;
         
         let warningClass = '';
         let ariaLabel = 'Temperature';
@@ -149,8 +150,8 @@ function createCompactMetrics(data, excludeStatusChip = false) {
     // Humidity
     if (typeof data.humidity !== 'undefined') {
         const humid = data.humidity.toFixed(1);
-        const showHighHumidityWarning = data.humidity > HUMIDITY_HIGH_THRESHOLD;
-        const showLowHumidityWarning = data.humidity < HUMIDITY_LOW_THRESHOLD;
+        const showHighHumidityWarning = data.humidity > thresholds.humidityHigh;
+        const showLowHumidityWarning = data.humidity < thresholds.humidityLow;
         
         let warningClass = '';
         let ariaLabel = 'Humidity';
@@ -174,7 +175,7 @@ function createCompactMetrics(data, excludeStatusChip = false) {
     // Battery
     if (typeof data.battery !== 'undefined') {
         const batt = Math.round(data.battery);
-        const showBatteryWarning = batt <= BATTERY_LOW_THRESHOLD;
+        const showBatteryWarning = batt <= thresholds.batteryLow;
         
         let warningClass = '';
         let ariaLabel = 'Battery';
@@ -221,9 +222,10 @@ class CardRenderer {
         
         // Check for low battery (only if not stale/missing - those take priority)
         const battery = deviceData.battery;
+        const thresholds = deviceData.thresholds || getThresholds();
         const isLowBattery = !isStale && !isWeatherStation && 
                             typeof battery !== 'undefined' && 
-                            battery <= BATTERY_LOW_THRESHOLD;
+                            battery <= thresholds.batteryLow;
         
         const shouldShowPlaceholderMetrics = isStale && !isWeatherStation && !hasMetrics && isDesktop;
         const shouldAddNoMetricsClass = !hasMetrics && !shouldShowPlaceholderMetrics;
@@ -271,12 +273,12 @@ class CardRenderer {
         `;
     }
     
-    // Create placeholder metrics HTML
-    createPlaceholderMetrics() {
+    // Create placeholder metrics HTML (virtual devices have no battery)
+    createPlaceholderMetrics(isVirtual = false) {
         return `
             ${createMetricElement('Temperature', 0, '°C', 'temperature', null, true)}
             ${createMetricElement('Humidity', 0, '%', 'humidity', null, true)}
-            ${createMetricElement('Battery', 0, '%', 'battery', null, true)}
+            ${isVirtual ? '' : createMetricElement('Battery', 0, '%', 'battery', null, true)}
         `;
     }
     
@@ -304,9 +306,9 @@ class CardRenderer {
         
         // Metrics block
         const metricsBlock = context.hasMetrics ? `
-            ${typeof deviceData.temperature !== 'undefined' ? createMetricElement('Temperature', deviceData.temperature.toFixed(1), '°C', 'temperature', previousValues.temperature) : ''}
-            ${typeof deviceData.humidity !== 'undefined' ? createMetricElement('Humidity', deviceData.humidity.toFixed(1), '%', 'humidity', previousValues.humidity) : ''}
-            ${typeof deviceData.battery !== 'undefined' ? createMetricElement('Battery', Math.round(deviceData.battery), '%', 'battery', previousValues.battery) : ''}
+            ${typeof deviceData.temperature !== 'undefined' ? createMetricElement('Temperature', deviceData.temperature.toFixed(1), '°C', 'temperature', previousValues.temperature, false, deviceData.thresholds) : ''}
+            ${typeof deviceData.humidity !== 'undefined' ? createMetricElement('Humidity', deviceData.humidity.toFixed(1), '%', 'humidity', previousValues.humidity, false, deviceData.thresholds) : ''}
+            ${typeof deviceData.battery !== 'undefined' ? createMetricElement('Battery', Math.round(deviceData.battery), '%', 'battery', previousValues.battery, false, deviceData.thresholds) : ''}
         ` : '';
         
         // Warning chip for desktop layout
@@ -325,7 +327,7 @@ class CardRenderer {
         
         // For desktop: show placeholder metrics for stale devices without metrics
         const finalMetricsBlock = context.shouldShowPlaceholderMetrics 
-            ? this.createPlaceholderMetrics()
+            ? this.createPlaceholderMetrics(deviceData.isVirtual)
             : metricsBlock;
         
         return `
@@ -526,7 +528,7 @@ class CardRenderer {
                 }
                 
                 if (progressBar) {
-                    const newWidth = normalizeTemp(deviceData.temperature);
+                    const newWidth = normalizeTemp(deviceData.temperature, deviceData.thresholds);
                     progressBar.style.width = `${newWidth}%`;
                 }
             }
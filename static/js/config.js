@@ -2,6 +2,9 @@
 const CONFIG = window.DASHBOARD_CONFIG || {};
 const DEVICE_GROUPS = CONFIG.DEVICE_GROUPS || {};
 const DEVICE_DISPLAY_NAMES = CONFIG.DEVICE_DISPLAY_NAMES || {};
+const DEVICE_THRESHOLDS = CONFIG.DEVICE_THRESHOLDS || {};
+// Virtual devices computed by the exporter, mapped to their expressions
+const VIRTUAL_DEVICES = CONFIG.VIRTUAL_DEVICES || {};
 
 const getDisplayName = (name) => DEVICE_DISPLAY_NAMES[name] || name;
 
@@ -13,5 +16,18 @@ const TEMPERATURE_HIGH_THRESHOLD = CONFIG.TEMPERATURE_HIGH_THRESHOLD || 35;
 const HUMIDITY_LOW_THRESHOLD = CONFIG.HUMIDITY_LOW_THRESHOLD || 30;
 const HUMIDITY_HIGH_THRESHOLD = CONFIG.HUMIDITY_HIGH_THRESHOLD || 70;
 const BATTERY_LOW_THRESHOLD = CONFIG.BATTERY_LOW_THRESHOLD || 5;
+
+const GLOBAL_THRESHOLDS = {
+    temperatureMin: MIN_TEMPERATURE,
+    temperatureMax: MAX_TEMPERATURE,
+    temperatureLow: TEMPERATURE_LOW_THRESHOLD,
+    temperatureHigh: TEMPERATURE_HIGH_THRESHOLD,
+    humidityLow: HUMIDITY_LOW_THRESHOLD,
+    humidityHigh: HUMIDITY_HIGH_THRESHOLD,
+    batteryLow: BATTERY_LOW_THRESHOLD
+};
+
+// Thresholds resolved by the server for a device (device > group > global)
+const getThresholds = (name) => ({ ...GLOBAL_THRESHOLDS, ...DEVICE_THRESHOLDS[name] });
 const CONNECTION_TIMEOUT = 5000;
 
@@ -0,0 +1,40 @@
+// Live updates from the exporter's Server-Sent Events stream
+
+// Refetch once per burst of events, since one scan delivers many readings
+const LIVE_UPDATE_DEBOUNCE = 1000;
+const LIVE_UPDATE_EVENTS = ['reading', 'status', 'openmeteo', 'config_reload'];
+
+let liveUpdateTimeoutId = null;
+
+function scheduleLiveUpdate(onUpdate) {
+    if (liveUpdateTimeoutId) return;
+    liveUpdateTimeoutId = setTimeout(() => {
+        liveUpdateTimeoutId = null;
+        onUpdate();
+    }, LIVE_UPDATE_DEBOUNCE);
+}
+
+// Subscribe to /api/events and call onUpdate when readings or statuses change.
+// Polling keeps running as a fallback; if the stream is unavailable (e.g. mock
+// server) it is closed instead of retried forever.
+function connectLiveUpdates(onUpdate) {
+    if (!('EventSource' in window)) return null;
+
+    const source = new EventSource('/api/events');
+    let opened = false;
+
+    source.addEventListener('open', () => {
+        opened = true;
+    });
+    source.addEventListener('error', () => {
+        if (!opened) {
+            source.close();
+        }
+    });
+
+    LIVE_UPDATE_EVENTS.forEach(type => {
+        source.addEventListener(type, () => scheduleLiveUpdate(onUpdate));
+    });
+
+    return source;
+}
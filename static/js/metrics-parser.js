@@ -1,5 +1,17 @@
 // Metrics parsing from Prometheus format
 
+// Parse a label set such as `building="B2",name="Office"` into an object.
+// Series may carry custom labels besides `name`, in any order.
+function parseLabels(text) {
+    const labels = {};
+    const labelPattern = /(\w+)="((?:[^"\\]|\\.)*)"/g;
+    let match;
+    while ((match = labelPattern.exec(text)) !== null) {
+        labels[match[1]] = match[2].replace(/\\(.)/g, (_, c) => (c === 'n' ? '\n' : c));
+    }
+    return labels;
+}
+
 function parseMetrics(text) {
     const rooms = {};
     const statusByDevice = {};
@@ -18,25 +30,29 @@ function parseMetrics(text) {
         }
 
         // Parse device status metrics
-        const statusMatch = line.match(/govee_device_status\{name="([^"]+)",status="([^"]+)"\}\s+([-\d.]+)/);
+        const statusMatch = line.match(/^govee_device_status\{(.*)\}\s+([-\d.]+)/);
         if (statusMatch) {
-            const [, name, status, value] = statusMatch;
-            const numericValue = parseFloat(value);
-            if (numericValue >= 0.5) {
+            const { name, status } = parseLabels(statusMatch[1]);
+            const numericValue = parseFloat(statusMatch[2]);
+            if (name && status && numericValue >= 0.5) {
                 statusByDevice[name] = status;
             }
             return;
         }
         
         // Parse Govee sensor metrics
-        const match = line.match(/govee_h5075_(\w+){name="([^"]+)"}\s+([-\d.]+)/);
+        const match = line.match(/^govee_h5075_(\w+)\{(.*)\}\s+([-\d.]+)/);
         if (!match) return;
         
-        const [, metric, name, value] = match;
+        const [, metric, labelText, value] = match;
+        const { name } = parseLabels(labelText);
+        if (!name) return;
         if (!rooms[name]) {
             rooms[name] = {
                 group: DEVICE_GROUPS[name] || 'Ungrouped',
-                displayName: getDisplayName(name)
+                displayName: getDisplayName(name),
+                thresholds: getThresholds(name),
+                isVirtual: name in VIRTUAL_DEVICES
             };
         }
         rooms[name][metric] = parseFloat(value);
@@ -47,7 +63,9 @@ function parseMetrics(text) {
         if (!rooms[name]) {
             rooms[name] = {
                 group: DEVICE_GROUPS[name] || 'Ungrouped',
-                displayName: getDisplayName(name)
+                displayName: getDisplayName(name),
+                thresholds: getThresholds(name),
+                isVirtual: name in VIRTUAL_DEVICES
             };
         }
         rooms[name].status = status;
@@ -68,6 +86,7 @@ function parseMetrics(text) {
             displayName: getDisplayName(name),
             temperature: weatherData.temperature,
             humidity: weatherData.humidity,
+            thresholds: getThresholds(name),
             // No battery for weather API data
             isWeatherStation: true
         };
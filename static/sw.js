@@ -46,6 +46,11 @@ self.addEventListener('fetch', (event) => {
   const { request } = event;
   const url = new URL(request.url);
 
+  // Leave API requests (including the /api/events stream) to the browser
+  if (url.pathname.startsWith('/api/')) {
+    return;
+  }
+
   // For metrics endpoint, always fetch from network (real-time data)
   if (url.pathname === '/metrics' || url.pathname === '/health') {
     event.respondWith(